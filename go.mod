@@ -3,6 +3,7 @@ module github.com/jgbaldwinbrown/pairviz
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/jgbaldwinbrown/covplots v0.1.3
 	github.com/jgbaldwinbrown/csvh v0.1.5
 	github.com/jgbaldwinbrown/fastats v0.1.7
@@ -13,11 +14,12 @@ require (
 	github.com/jgbaldwinbrown/slide v0.1.1
 	github.com/montanaflynn/stats v0.7.1
 	github.com/sajari/regression v1.0.1
+	golang.org/x/image v0.18.0
 	golang.org/x/sync v0.5.0
+	gonum.org/v1/gonum v0.14.0
 )
 
 require (
 	github.com/jgbaldwinbrown/shellout v0.0.0-20220929214905-4c5332e9ea51 // indirect
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
-	gonum.org/v1/gonum v0.14.0 // indirect
 )
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/jgbaldwinbrown/pairviz/go_pairviz/pkg"
+)
+
+func main() {
+	pairviz.FullChangePoint()
+}
@@ -0,0 +1,89 @@
+package pairviz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var ErrShortLine = errors.New("Line has too few columns")
+var ErrBadPolicy = errors.New("Unknown bad line policy")
+
+// A malformed input line, with its 1-based line number in the file
+type ParseError struct {
+	Line int64
+	Text string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %q: %v", e.Line, e.Text, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// What to do when an input line cannot be parsed
+type BadLinePolicy int
+
+const (
+	FailBad BadLinePolicy = iota
+	SkipBad
+	LogBad
+)
+
+// Parse a policy name: "fail", "skip", or "log"
+func ParseBadLinePolicy(name string) (BadLinePolicy, error) {
+	switch name {
+	case "", "fail": return FailBad, nil
+	case "skip": return SkipBad, nil
+	case "log": return LogBad, nil
+	default:
+	}
+	return FailBad, fmt.Errorf("ParseBadLinePolicy: %q: %w", name, ErrBadPolicy)
+}
+
+// Applies a BadLinePolicy to malformed lines, counting the skipped lines and
+// writing them to W if the policy is LogBad. A nil Rejecter fails on every bad
+// line. Safe for concurrent use.
+type Rejecter struct {
+	Policy BadLinePolicy
+	W io.Writer
+	mu sync.Mutex
+	skipped int64
+}
+
+func NewRejecter(policy BadLinePolicy, w io.Writer) *Rejecter {
+	return &Rejecter{Policy: policy, W: w}
+}
+
+// Handle one bad line; returns a *ParseError if the line should stop the run
+func (r *Rejecter) Reject(lineno int64, line []string, err error) error {
+	perr := &ParseError{Line: lineno, Text: strings.Join(line, "\t"), Err: err}
+	if r == nil || r.Policy == FailBad {
+		return perr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped++
+	if r.Policy == LogBad && r.W != nil {
+		if _, e := fmt.Fprintln(r.W, perr.Text); e != nil {
+			return fmt.Errorf("Reject: %w", e)
+		}
+	}
+	return nil
+}
+
+// The number of lines skipped so far
+func (r *Rejecter) Skipped() int64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.skipped
+}
@@ -0,0 +1,62 @@
+package pairviz
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const gBadLineIn = `## pairs format v1.0.0
+#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_W501	3	+	-	UU
+r2	X_ISO1	2x	X_ISO1	4	+	-	UU
+r3	X_ISO1
+r4	X_ISO1	2	X_ISO1	4	+	-	UU
+`
+
+func TestBadLinePolicies(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+
+	for _, threads := range []int{1, 3} {
+		flags.Threads = threads
+		flags.Rejecter = nil
+		_, e := WinStats(flags, strings.NewReader(gBadLineIn))
+		var perr *ParseError
+		if !errors.As(e, &perr) || perr.Line != 4 || !errors.Is(e, strconv.ErrSyntax) {
+			t.Errorf("threads %v: fail policy gave error %v", threads, e)
+		}
+
+		var rejects strings.Builder
+		flags.Rejecter = NewRejecter(LogBad, &rejects)
+		stats, e := WinStats(flags, strings.NewReader(gBadLineIn))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if flags.Rejecter.Skipped() != 2 {
+			t.Errorf("threads %v: skipped %v != 2", threads, flags.Rejecter.Skipped())
+		}
+		if !strings.Contains(rejects.String(), "r2\tX_ISO1\t2x") || !strings.Contains(rejects.String(), "r3\tX_ISO1\n") {
+			t.Errorf("threads %v: rejects %q wrong", threads, rejects.String())
+		}
+		if x := (*stats.Hits.Hits["X"])[0]; x.SelfHits != 2 || x.PairHits != 2 {
+			t.Errorf("threads %v: hits %v wrong", threads, x)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	if _, e := ParseFlags([]string{"-n", "x"}); !errors.Is(e, ErrMissingFlag) {
+		t.Errorf("missing window flags gave error %v", e)
+	}
+	if _, e := ParseFlags([]string{"-c", "-bad", "drop"}); !errors.Is(e, ErrBadPolicy) {
+		t.Errorf("bad policy gave error %v", e)
+	}
+	f, e := ParseFlags([]string{"-w", "10", "-s", "5", "-bad", "skip"})
+	if e != nil || f.WinSize != 10 || f.BadLines != "skip" {
+		t.Errorf("flags %v, error %v", f, e)
+	}
+}
@@ -0,0 +1,190 @@
+package pairviz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrBandEdges = errors.New("Band edges must be increasing, with at least two edges")
+
+// Hits for pairs whose reads are between Min (inclusive) and Max (exclusive)
+// base pairs apart
+type DistBand struct {
+	Min int64
+	Max int64
+	Hits Hits
+	GenomeHits GenomeHits
+}
+
+// Parse comma-separated distance band edges; the last edge may be "inf"
+func ParseBandEdges(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Split(s, ",")
+	edges := make([]int64, 0, len(fields))
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "inf" && i == len(fields) - 1 {
+			edges = append(edges, math.MaxInt64)
+			continue
+		}
+		edge, err := strconv.ParseInt(field, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ParseBandEdges: %w", err)
+		}
+		edges = append(edges, edge)
+	}
+	if len(edges) < 2 {
+		return nil, fmt.Errorf("ParseBandEdges: %q: %w", s, ErrBandEdges)
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			return nil, fmt.Errorf("ParseBandEdges: %q: %w", s, ErrBandEdges)
+		}
+	}
+	return edges, nil
+}
+
+// Make empty distance bands from the band edges in flags
+func NewDistBands(flags Flags) []DistBand {
+	if len(flags.BandEdges) < 2 {
+		return nil
+	}
+	bands := make([]DistBand, len(flags.BandEdges) - 1)
+	for i, _ := range bands {
+		bands[i].Min = flags.BandEdges[i]
+		bands[i].Max = flags.BandEdges[i+1]
+		bands[i].Hits.Init(flags.WinSize, flags.WinStep)
+		bands[i].GenomeHits.Init(flags.WinSize, flags.WinStep)
+	}
+	return bands
+}
+
+// The band containing a pair distance, or nil if it is in no band
+func (stats *AllWinStats) Band(dist int64) *DistBand {
+	for i, _ := range stats.Bands {
+		if dist >= stats.Bands[i].Min && dist < stats.Bands[i].Max {
+			return &stats.Bands[i]
+		}
+	}
+	return nil
+}
+
+// Use the chromosome lengths of the full statistics so that band windows
+// span the same coordinates
+func (b *DistBand) ShareChromLens(stats *AllWinStats) {
+	b.Hits.ChromLens = stats.Hits.ChromLens
+	for genome, ghits := range b.GenomeHits.Ghits {
+		ghits.ChromLens = stats.GenomeHits.Genome(genome).ChromLens
+	}
+}
+
+// The hits in one window, or an empty HitSet if the window has no hits
+func (h *Hits) Win(chrom string, index int) HitSet {
+	wins, ok := h.Hits[chrom]
+	if !ok || index >= len(*wins) {
+		return HitSet{}
+	}
+	return (*wins)[index]
+}
+
+// Format a band edge, writing the unbounded edge as "inf"
+func BandEdgeString(edge int64) string {
+	if edge == math.MaxInt64 {
+		return "inf"
+	}
+	return strconv.FormatInt(edge, 10)
+}
+
+// The distance band of one window, only included in JSON output for banded
+// statistics
+type BandJsonStat struct {
+	BandMin JsonFloat
+	BandMax JsonFloat
+}
+
+// Add the distance band to j
+func (j *JsonOutStat) AddBand(b *DistBand) {
+	max := JsonFloat(b.Max)
+	if b.Max == math.MaxInt64 {
+		max = JsonFloat(math.Inf(1))
+	}
+	j.BandJsonStat = &BandJsonStat{BandMin: JsonFloat(b.Min), BandMax: max}
+}
+
+// Write the statistics for each distance band of each window in long format,
+// with one row or record per window per band
+func FprintBandStats(w io.Writer, stats AllWinStats, separategenomes bool, readlen int64, jsonOut bool) error {
+	if jsonOut {
+		return FprintBandStatsJson(w, stats)
+	}
+	FprintBandStatsPlain(w, stats, separategenomes, readlen)
+	return nil
+}
+
+// Write the band statistics for every window of every genome as JSON
+func FprintBandStatsJson(w io.Writer, stats AllWinStats) error {
+	enc := json.NewEncoder(w)
+	for _, genome := range sortedKeys(stats.GenomeHits.Ghits) {
+		genomeentries := stats.GenomeHits.Ghits[genome]
+		for _, chrom := range sortedKeys(genomeentries.Hits) {
+			for index, _ := range *genomeentries.Hits[chrom] {
+				start, end := genomeentries.WinSpan(chrom, int64(index))
+				for i, _ := range stats.Bands {
+					band := &stats.Bands[i]
+					win := band.GenomeHits.Genome(genome).Win(chrom, index)
+					j := MakeJsonOutStat(genome, chrom, stats.Name, stats.ReadTotals, start, end, genomeentries.WinSize, genomeentries.WinStep, win)
+					if stats.Orient {
+						j.AddFacing(win)
+					}
+					if len(stats.CI.Methods) > 0 {
+						j.AddCI(win, stats.CI)
+					}
+					j.AddBand(band)
+					if err := enc.Encode(j); err != nil {
+						return fmt.Errorf("FprintBandStatsJson: %w", err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Write the band statistics for every window as tab-separated text,
+// optionally with separate rows for each genome
+func FprintBandStatsPlain(w io.Writer, stats AllWinStats, separategenomes bool, readlen int64) {
+	cols := StatCols{Fpkm: stats.Fpkm, ReadLen: readlen, Orient: stats.Orient, CI: stats.CI}
+	FprintHeaderCols(w, cols, stats.Name != "", []string{"band_min", "band_max"})
+	fprintHits := func(label string, hits *Hits, bandhits func(*DistBand) *Hits) {
+		for _, chrom := range sortedKeys(hits.Hits) {
+			for index, _ := range *hits.Hits[chrom] {
+				start, end := hits.WinSpan(chrom, int64(index))
+				for i, _ := range stats.Bands {
+					band := &stats.Bands[i]
+					win := bandhits(band).Win(chrom, index)
+					FprintStatsRow(w, chrom + label, start, end, hits.WinSize, hits.WinStep, win, stats.ReadTotals, cols)
+					fmt.Fprintf(w, "\t%s\t%s", BandEdgeString(band.Min), BandEdgeString(band.Max))
+					if stats.Name != "" {
+						fmt.Fprintf(w, "\t%s", stats.Name)
+					}
+					fmt.Fprintln(w, "")
+				}
+			}
+		}
+	}
+
+	if !separategenomes {
+		fprintHits("", &stats.Hits, func(b *DistBand) *Hits { return &b.Hits })
+		return
+	}
+	for _, genome := range sortedKeys(stats.GenomeHits.Ghits) {
+		fprintHits("_" + genome, stats.GenomeHits.Ghits[genome], func(b *DistBand) *Hits { return b.GenomeHits.Genome(genome) })
+	}
+}
@@ -0,0 +1,66 @@
+package pairviz
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBandEdges(t *testing.T) {
+	edges, e := ParseBandEdges("0, 100,1000,inf")
+	if e != nil || !reflect.DeepEqual(edges, []int64{0, 100, 1000, math.MaxInt64}) {
+		t.Errorf("edges %v, error %v", edges, e)
+	}
+	for _, bad := range []string{"100", "0,100,50", "0,inf,100"} {
+		if _, e := ParseBandEdges(bad); e == nil {
+			t.Errorf("%q parsed without error", bad)
+		}
+	}
+	if _, e := ParseBandEdges("5,1"); !errors.Is(e, ErrBandEdges) {
+		t.Errorf("decreasing edges gave error %v", e)
+	}
+}
+
+const gBandIn = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_ISO1	3	+	-	UU
+r2	X_ISO1	2	X_W501	8	+	-	UU
+r3	X_ISO1	4	X_W501	25	+	-	UU
+r4	X_ISO1	5	X_ISO1	50	+	-	UU
+`
+
+func TestBandWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+	flags.BandEdges = []int64{0, 5, 30}
+
+	for _, threads := range []int{1, 2} {
+		flags.Threads = threads
+		stats, e := WinStats(flags, strings.NewReader(gBandIn))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(stats.Bands) != 2 {
+			t.Fatalf("threads %v: %v bands", threads, len(stats.Bands))
+		}
+		short := stats.Bands[0].Hits.Win("X", 0)
+		long := stats.Bands[1].Hits.Win("X", 0)
+		if short.SelfHits != 2 || short.PairHits != 0 || long.PairHits != 3 || long.SelfHits != 0 {
+			t.Errorf("threads %v: short %v, long %v wrong", threads, short, long)
+		}
+		if all := stats.Hits.Win("X", 0); all.SelfHits != 3 || all.PairHits != 3 {
+			t.Errorf("threads %v: all %v wrong", threads, all)
+		}
+
+		var buf bytes.Buffer
+		FprintBandStatsPlain(&buf, stats, false, -1)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 + 6 * 2 || !strings.Contains(lines[0], "\tband_min\tband_max\t") {
+			t.Errorf("threads %v: band output wrong:\n%v", threads, buf.String())
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package pairviz
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// A minimal bigWig writer following the layout of the UCSC bbi format
+// (version 4): bedGraph data sections compressed with zlib, a chromosome B+
+// tree, R tree indices, and zoom levels for fast display of large regions.
+
+const (
+	bigWigMagic uint32 = 0x888FFC26
+	bptMagic uint32 = 0x78CA8C91
+	cirTreeMagic uint32 = 0x2468ACE0
+	bigWigVersion = 4
+	bigWigItemsPerSlot = 1024
+	bigWigBlockSize = 256
+	bigWigMaxZooms = 10
+	bigWigZoomIncrement = 4
+	bigWigHeaderSize = 64
+	bigWigZoomHeaderSize = 24
+)
+
+var ErrBigWigRange = errors.New("Track interval does not fit in a bigWig file")
+
+// The fixed header at the start of a bigWig file
+type bbiHeader struct {
+	Magic uint32
+	Version uint16
+	ZoomLevels uint16
+	ChromTreeOffset uint64
+	FullDataOffset uint64
+	FullIndexOffset uint64
+	FieldCount uint16
+	DefinedFieldCount uint16
+	AutoSqlOffset uint64
+	TotalSummaryOffset uint64
+	UncompressBufSize uint32
+	Reserved uint64
+}
+
+// The location of one zoom level, following the header
+type bbiZoomHeader struct {
+	Reduction uint32
+	Reserved uint32
+	DataOffset uint64
+	IndexOffset uint64
+}
+
+// A compressed block of a bigWig file, and the range it covers for the index
+type bbiBlock struct {
+	ChromId uint32
+	Start uint32
+	EndChromId uint32
+	End uint32
+	Offset uint64
+	Size uint64
+}
+
+// Summary statistics for a range of bases, as used by zoom levels and the
+// total summary
+type bbiSummary struct {
+	ChromId uint32
+	Start uint32
+	End uint32
+	ValidCount uint64
+	Min float64
+	Max float64
+	Sum float64
+	SumSquares float64
+}
+
+func (s *bbiSummary) Add(bases uint64, val float64) {
+	if s.ValidCount == 0 || val < s.Min {
+		s.Min = val
+	}
+	if s.ValidCount == 0 || val > s.Max {
+		s.Max = val
+	}
+	s.ValidCount += bases
+	s.Sum += val * float64(bases)
+	s.SumSquares += val * val * float64(bases)
+}
+
+// Records converted to the integer chromosome ids of the bigWig file
+type bbiRecord struct {
+	ChromId uint32
+	Start uint32
+	End uint32
+	Value float32
+}
+
+// A bigWig file being assembled in memory
+type bigWigBuilder struct {
+	buf bytes.Buffer
+	maxBlock int
+}
+
+func (b *bigWigBuilder) put(vals ...any) {
+	for _, v := range vals {
+		binary.Write(&b.buf, binary.LittleEndian, v)
+	}
+}
+
+func (b *bigWigBuilder) offset() uint64 {
+	return uint64(b.buf.Len())
+}
+
+func (b *bigWigBuilder) patch(at uint64, v any) {
+	var p bytes.Buffer
+	binary.Write(&p, binary.LittleEndian, v)
+	copy(b.buf.Bytes()[at:], p.Bytes())
+}
+
+// Compress and append one block, returning its location
+func (b *bigWigBuilder) putBlock(raw []byte) (offset, size uint64, err error) {
+	if len(raw) > b.maxBlock {
+		b.maxBlock = len(raw)
+	}
+	offset = b.offset()
+	zw := zlib.NewWriter(&b.buf)
+	if _, err = zw.Write(raw); err != nil {
+		return 0, 0, err
+	}
+	if err = zw.Close(); err != nil {
+		return 0, 0, err
+	}
+	return offset, b.offset() - offset, nil
+}
+
+// Write the data sections, at most bigWigItemsPerSlot records each, never
+// spanning two chromosomes
+func (b *bigWigBuilder) putData(recs []bbiRecord) ([]bbiBlock, error) {
+	var blocks []bbiBlock
+	for i := 0; i < len(recs); {
+		j := i
+		for j < len(recs) && j - i < bigWigItemsPerSlot && recs[j].ChromId == recs[i].ChromId {
+			j++
+		}
+		sec := recs[i:j]
+		var raw bytes.Buffer
+		end := sec[0].End
+		for _, rec := range sec {
+			if rec.End > end {
+				end = rec.End
+			}
+		}
+		// Section header: chromId, start, end, step, span, type (1 = bedGraph),
+		// reserved, item count
+		binary.Write(&raw, binary.LittleEndian, []uint32{sec[0].ChromId, sec[0].Start, end, 0, 0})
+		binary.Write(&raw, binary.LittleEndian, []uint8{1, 0})
+		binary.Write(&raw, binary.LittleEndian, uint16(len(sec)))
+		for _, rec := range sec {
+			binary.Write(&raw, binary.LittleEndian, rec.Start)
+			binary.Write(&raw, binary.LittleEndian, rec.End)
+			binary.Write(&raw, binary.LittleEndian, rec.Value)
+		}
+		offset, size, err := b.putBlock(raw.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, bbiBlock{ChromId: sec[0].ChromId, Start: sec[0].Start, EndChromId: sec[0].ChromId, End: end, Offset: offset, Size: size})
+		i = j
+	}
+	return blocks, nil
+}
+
+// Write zoom records in blocks, like the data sections
+func (b *bigWigBuilder) putZoomData(sums []bbiSummary) ([]bbiBlock, error) {
+	var blocks []bbiBlock
+	for i := 0; i < len(sums); {
+		j := i
+		for j < len(sums) && j - i < bigWigItemsPerSlot && sums[j].ChromId == sums[i].ChromId {
+			j++
+		}
+		sec := sums[i:j]
+		var raw bytes.Buffer
+		for _, s := range sec {
+			binary.Write(&raw, binary.LittleEndian, []uint32{s.ChromId, s.Start, s.End, uint32(s.ValidCount)})
+			binary.Write(&raw, binary.LittleEndian, []float32{float32(s.Min), float32(s.Max), float32(s.Sum), float32(s.SumSquares)})
+		}
+		offset, size, err := b.putBlock(raw.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, bbiBlock{ChromId: sec[0].ChromId, Start: sec[0].Start, EndChromId: sec[0].ChromId, End: sec[len(sec)-1].End, Offset: offset, Size: size})
+		i = j
+	}
+	return blocks, nil
+}
+
+// The range covered by a list of blocks, which must be sorted
+func blockSpan(blocks []bbiBlock) bbiBlock {
+	span := blocks[0]
+	span.EndChromId = blocks[len(blocks)-1].EndChromId
+	span.End = 0
+	for _, blk := range blocks {
+		if blk.EndChromId == span.EndChromId && blk.End > span.End {
+			span.End = blk.End
+		}
+	}
+	return span
+}
+
+// Write an R tree index of the blocks. Each level groups up to
+// bigWigBlockSize nodes of the level below; the root is written first.
+func (b *bigWigBuilder) putIndex(blocks []bbiBlock, endOffset uint64) {
+	// levels[0] are the blocks themselves, levels[n] the children of the root
+	levels := [][]bbiBlock{blocks}
+	for len(levels[len(levels)-1]) > bigWigBlockSize {
+		below := levels[len(levels)-1]
+		var level []bbiBlock
+		for i := 0; i < len(below); i += bigWigBlockSize {
+			level = append(level, blockSpan(below[i:min(i + bigWigBlockSize, len(below))]))
+		}
+		levels = append(levels, level)
+	}
+
+	b.put(cirTreeMagic, uint32(bigWigBlockSize), uint64(len(blocks)))
+	if len(blocks) == 0 {
+		b.put([]uint32{0, 0, 0, 0}, endOffset, uint32(bigWigItemsPerSlot), uint32(0))
+		b.put(uint8(1), uint8(0), uint16(0))
+		return
+	}
+	all := blockSpan(blocks)
+	b.put([]uint32{all.ChromId, all.Start, all.EndChromId, all.End}, endOffset, uint32(bigWigItemsPerSlot), uint32(0))
+
+	// Find the offset of every node before writing, from the node sizes
+	nodeCount := func(level int) int {
+		return (len(levels[level]) + bigWigBlockSize - 1) / bigWigBlockSize
+	}
+	nodeSize := func(level int, items int) uint64 {
+		if level == 0 {
+			return 4 + uint64(items) * 32
+		}
+		return 4 + uint64(items) * 24
+	}
+	starts := make([]uint64, len(levels))
+	pos := b.offset()
+	for level := len(levels) - 1; level >= 0; level-- {
+		starts[level] = pos
+		pos += uint64(nodeCount(level)) * nodeSize(level, bigWigBlockSize)
+	}
+
+	for level := len(levels) - 1; level >= 0; level-- {
+		items := levels[level]
+		for n := 0; n < nodeCount(level); n++ {
+			node := items[n * bigWigBlockSize:min((n+1) * bigWigBlockSize, len(items))]
+			leaf := uint8(0)
+			if level == 0 {
+				leaf = 1
+			}
+			b.put(leaf, uint8(0), uint16(len(node)))
+			for i, item := range node {
+				b.put([]uint32{item.ChromId, item.Start, item.EndChromId, item.End})
+				if level == 0 {
+					b.put(item.Offset, item.Size)
+				} else {
+					child := uint64(n * bigWigBlockSize + i)
+					b.put(starts[level-1] + child * nodeSize(level-1, bigWigBlockSize))
+				}
+			}
+			// Pad partial nodes to the full node size so offsets stay fixed
+			b.put(make([]byte, nodeSize(level, bigWigBlockSize - len(node)) - 4))
+		}
+	}
+}
+
+// Summarize records in bins of reduction bases
+func zoomSummaries(recs []bbiRecord, reduction uint32) []bbiSummary {
+	var sums []bbiSummary
+	for _, rec := range recs {
+		for start := rec.Start; start < rec.End; {
+			binStart := start / reduction * reduction
+			binEnd := binStart + reduction
+			if binEnd < binStart {
+				binEnd = math.MaxUint32
+			}
+			end := min(binEnd, rec.End)
+			n := len(sums)
+			if n == 0 || sums[n-1].ChromId != rec.ChromId || sums[n-1].Start != binStart {
+				sums = append(sums, bbiSummary{ChromId: rec.ChromId, Start: binStart, End: binStart})
+				n++
+			}
+			sums[n-1].Add(uint64(end - start), float64(rec.Value))
+			sums[n-1].End = end
+			start = end
+		}
+	}
+	return sums
+}
+
+// Convert the records of a track to chromosome ids, which are the indices of
+// the chromosomes in sorted order
+func bbiRecords(t *Track, chroms []string) ([]bbiRecord, error) {
+	ids := map[string]uint32{}
+	for i, chrom := range chroms {
+		ids[chrom] = uint32(i)
+	}
+	recs := make([]bbiRecord, 0, len(t.Records))
+	for _, rec := range t.Records {
+		if rec.Start < 0 || rec.End > math.MaxUint32 || rec.End <= rec.Start {
+			return nil, fmt.Errorf("bbiRecords: %v:%v-%v: %w", rec.Chrom, rec.Start, rec.End, ErrBigWigRange)
+		}
+		recs = append(recs, bbiRecord{ChromId: ids[rec.Chrom], Start: uint32(rec.Start), End: uint32(rec.End), Value: float32(rec.Value)})
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].ChromId != recs[j].ChromId {
+			return recs[i].ChromId < recs[j].ChromId
+		}
+		return recs[i].Start < recs[j].Start
+	})
+	return recs, nil
+}
+
+// Write the chromosome B+ tree as a single leaf node
+func (b *bigWigBuilder) putChromTree(chroms []string, sizes map[string]int64) error {
+	keySize := 1
+	for _, chrom := range chroms {
+		keySize = max(keySize, len(chrom))
+	}
+	blockSize := max(1, len(chroms))
+	b.put(bptMagic, uint32(blockSize), uint32(keySize), uint32(8), uint64(len(chroms)), uint64(0))
+	b.put(uint8(1), uint8(0), uint16(len(chroms)))
+	for i, chrom := range chroms {
+		size := sizes[chrom]
+		if size > math.MaxUint32 {
+			return fmt.Errorf("putChromTree: %v length %v: %w", chrom, size, ErrBigWigRange)
+		}
+		key := make([]byte, keySize)
+		copy(key, chrom)
+		b.put(key, uint32(i), uint32(size))
+	}
+	return nil
+}
+
+// Write a track as a bigWig file. Every chromosome in the track must have a
+// size in sizes.
+func WriteBigWig(w io.Writer, t *Track, sizes map[string]int64) error {
+	h := func(e error) error {
+		return fmt.Errorf("WriteBigWig: %w", e)
+	}
+	chroms := sortedKeys(sizes)
+	recs, err := bbiRecords(t, chroms)
+	if err != nil {
+		return h(err)
+	}
+
+	var total bbiSummary
+	for _, rec := range recs {
+		total.Add(uint64(rec.End - rec.Start), float64(rec.Value))
+	}
+
+	// Pick zoom levels starting at several times the mean interval size,
+	// keeping only levels that at least halve the number of summaries
+	var reductions []uint32
+	var zooms [][]bbiSummary
+	if len(recs) > 0 {
+		reduction := total.ValidCount / uint64(len(recs)) * bigWigZoomIncrement
+		prev := len(recs)
+		for len(reductions) < bigWigMaxZooms && reduction > 0 && reduction <= math.MaxUint32 {
+			sums := zoomSummaries(recs, uint32(reduction))
+			if len(sums) * 2 > prev {
+				break
+			}
+			reductions = append(reductions, uint32(reduction))
+			zooms = append(zooms, sums)
+			prev = len(sums)
+			reduction *= bigWigZoomIncrement
+		}
+	}
+
+	var b bigWigBuilder
+	b.buf.Write(make([]byte, bigWigHeaderSize + bigWigZoomHeaderSize * len(reductions)))
+
+	summaryOffset := b.offset()
+	b.put(total.ValidCount, total.Min, total.Max, total.Sum, total.SumSquares)
+
+	chromTreeOffset := b.offset()
+	if err = b.putChromTree(chroms, sizes); err != nil {
+		return h(err)
+	}
+
+	dataOffset := b.offset()
+	b.put(uint64(0))
+	blocks, err := b.putData(recs)
+	if err != nil {
+		return h(err)
+	}
+	b.patch(dataOffset, uint64(len(blocks)))
+	indexOffset := b.offset()
+	b.putIndex(blocks, indexOffset)
+
+	for i, sums := range zooms {
+		zoomDataOffset := b.offset()
+		b.put(uint32(len(sums)))
+		zblocks, err := b.putZoomData(sums)
+		if err != nil {
+			return h(err)
+		}
+		zoomIndexOffset := b.offset()
+		b.putIndex(zblocks, zoomIndexOffset)
+		b.patch(uint64(bigWigHeaderSize + bigWigZoomHeaderSize * i), bbiZoomHeader{
+			Reduction: reductions[i],
+			DataOffset: zoomDataOffset,
+			IndexOffset: zoomIndexOffset,
+		})
+	}
+
+	b.patch(0, bbiHeader{
+		Magic: bigWigMagic,
+		Version: bigWigVersion,
+		ZoomLevels: uint16(len(reductions)),
+		ChromTreeOffset: chromTreeOffset,
+		FullDataOffset: dataOffset,
+		FullIndexOffset: indexOffset,
+		TotalSummaryOffset: summaryOffset,
+		UncompressBufSize: uint32(b.maxBlock),
+	})
+
+	// The file ends with the magic number, as in UCSC bigWig files
+	b.put(bigWigMagic)
+
+	if _, err = w.Write(b.buf.Bytes()); err != nil {
+		return h(err)
+	}
+	return nil
+}
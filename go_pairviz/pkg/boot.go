@@ -0,0 +1,394 @@
+package pairviz
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The settings of a Poisson bootstrap over read pairs
+type BootFlags struct {
+	Reps int
+	Seed int64
+	Level float64
+}
+
+// Make the bootstrap settings requested by flags; Reps is 0 if no bootstrap
+// was requested
+func NewBootFlags(flags Flags) BootFlags {
+	return BootFlags{Reps: flags.BootReps, Seed: flags.BootSeed, Level: flags.CILevel}
+}
+
+// Advance a splitmix64 generator and return its next output
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Draw from a Poisson distribution with mean 1 by inverting its CDF
+func poisson1(u float64) uint32 {
+	p := math.Exp(-1)
+	cdf := p
+	k := uint32(0)
+	for u > cdf && k < 32 {
+		k++
+		p /= float64(k)
+		cdf += p
+	}
+	return k
+}
+
+// The Poisson(1) weights of one read pair in every replicate. The weights
+// depend only on the seed and the ordinal of the pair in the input, so they
+// do not change with the number of threads.
+func (b BootFlags) Weights(ordinal int64, out []uint32) []uint32 {
+	out = out[:0]
+	state := uint64(b.Seed) ^ uint64(ordinal) * 0xd1342543de82ef95
+	splitmix64(&state)
+	for i := 0; i < b.Reps; i++ {
+		u := float64(splitmix64(&state) >> 11) / (1 << 53)
+		out = append(out, poisson1(u))
+	}
+	return out
+}
+
+// The weighted counts of one window or region in one bootstrap replicate
+type BootCounts struct {
+	Pair uint32
+	Self uint32
+	Ovl uint32
+	NonOvl uint32
+}
+
+// The counts of one window or region in every replicate
+type BootReplicates []BootCounts
+
+// Add the weights of one pair to the counts of a hit type; hit types other
+// than self, paired, and overlap are not bootstrapped
+func (r BootReplicates) Add(hit_type HitType, weights []uint32) {
+	for i, w := range weights {
+		switch hit_type {
+		case S: r[i].Self += w
+		case P: r[i].Pair += w
+		case Ovl: r[i].Ovl += w
+		case NonOvl: r[i].NonOvl += w
+		default:
+			return
+		}
+	}
+}
+
+// Add the counts of another set of replicates to this one
+func (r BootReplicates) Merge(o BootReplicates) {
+	for i, c := range o {
+		r[i].Pair += c.Pair
+		r[i].Self += c.Self
+		r[i].Ovl += c.Ovl
+		r[i].NonOvl += c.NonOvl
+	}
+}
+
+// The replicate counts of every window of every chromosome; the counts of
+// window i are Wins[chrom][i * Reps:(i + 1) * Reps]
+type BootHits struct {
+	Reps int
+	Wins map[string][]BootCounts
+}
+
+func NewBootHits(reps int) *BootHits {
+	return &BootHits{Reps: reps, Wins: map[string][]BootCounts{}}
+}
+
+// The replicates of one window, or nil if it has no hits
+func (h *BootHits) Win(chrom string, index int) BootReplicates {
+	wins := h.Wins[chrom]
+	if (index + 1) * h.Reps > len(wins) {
+		return nil
+	}
+	return wins[index * h.Reps:(index + 1) * h.Reps]
+}
+
+// Add the weights of a hit to every window in wins
+func (h *BootHits) Add(chrom string, wins Range, hit_type HitType, weights []uint32) {
+	counts := h.Wins[chrom]
+	if wins.Start < 0 {
+		wins.Start = 0
+	}
+	if need := int(wins.End) * h.Reps; need > len(counts) {
+		counts = append(counts, make([]BootCounts, need - len(counts))...)
+		h.Wins[chrom] = counts
+	}
+	for i := wins.Start; i < wins.End; i += wins.Step {
+		BootReplicates(counts[int(i) * h.Reps:(int(i) + 1) * h.Reps]).Add(hit_type, weights)
+	}
+}
+
+// Add all replicate counts from o into h
+func (h *BootHits) Merge(o *BootHits) {
+	for chrom, ocounts := range o.Wins {
+		counts := h.Wins[chrom]
+		if len(ocounts) > len(counts) {
+			counts = append(counts, make([]BootCounts, len(ocounts) - len(counts))...)
+			h.Wins[chrom] = counts
+		}
+		BootReplicates(counts).Merge(ocounts)
+	}
+}
+
+// The bootstrap replicates of window statistics, for all genomes together and
+// for each genome
+type WinBoot struct {
+	BootFlags
+	// Added to the read count to get the ordinal of the current pair, for
+	// counting pairs in chunks
+	Offset int64
+	Hits *BootHits
+	GenomeHits map[string]*BootHits
+	weights []uint32
+}
+
+func NewWinBoot(b BootFlags) *WinBoot {
+	return &WinBoot{BootFlags: b, Hits: NewBootHits(b.Reps), GenomeHits: map[string]*BootHits{}}
+}
+
+// The replicates of one genome, creating them if necessary
+func (b *WinBoot) Genome(genome string) *BootHits {
+	h, ok := b.GenomeHits[genome]
+	if !ok {
+		h = NewBootHits(b.Reps)
+		b.GenomeHits[genome] = h
+	}
+	return h
+}
+
+// The replicates of one window of one genome, or nil if it has no hits
+func (b *WinBoot) GenomeWin(genome, chrom string, index int) BootReplicates {
+	if h, ok := b.GenomeHits[genome]; ok {
+		return h.Win(chrom, index)
+	}
+	return nil
+}
+
+// Add the weighted self or paired and overlap hits of a pair to the windows
+// of both reads; hits gives the window layout
+func (b *WinBoot) AddPair(flags Flags, pair Pair, ordinal int64, hits *Hits) {
+	b.weights = b.Weights(ordinal + b.Offset, b.weights)
+	add := func(hit_type HitType) {
+		for _, read := range []Read{pair.Read1, pair.Read2} {
+			wins := hits.WinsHit(read.Pos)
+			b.Hits.Add(read.Chrom, wins, hit_type, b.weights)
+			b.Genome(read.Parent).Add(read.Chrom, wins, hit_type, b.weights)
+		}
+	}
+	if pair.Read1.Parent == pair.Read2.Parent {
+		add(S)
+	} else {
+		add(P)
+	}
+	if flags.ReadLen != -1 {
+		if PairOverlaps(pair, flags.ReadLen) {
+			add(Ovl)
+		} else {
+			add(NonOvl)
+		}
+	}
+}
+
+// Add the replicates counted from another part of the input
+func (b *WinBoot) Merge(o *WinBoot) {
+	b.Hits.Merge(o.Hits)
+	for genome, h := range o.GenomeHits {
+		b.Genome(genome).Merge(h)
+	}
+}
+
+// The standard error and percentile interval of one statistic over the
+// replicates
+type BootSummary struct {
+	SE float64
+	Lo float64
+	Hi float64
+}
+
+// Summarize the replicate values of a statistic, ignoring NaN values from
+// replicates where it is undefined
+func (b BootFlags) Summarize(vals []float64) BootSummary {
+	finite := vals[:0]
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			finite = append(finite, v)
+		}
+	}
+	n := len(finite)
+	if n < 2 {
+		return BootSummary{math.NaN(), math.NaN(), math.NaN()}
+	}
+	sort.Float64s(finite)
+	mean := 0.0
+	for _, v := range finite {
+		mean += v
+	}
+	mean /= float64(n)
+	ss := 0.0
+	for _, v := range finite {
+		ss += (v - mean) * (v - mean)
+	}
+	quantile := func(q float64) float64 {
+		pos := q * float64(n - 1)
+		i := int(pos)
+		if i >= n - 1 {
+			return finite[n-1]
+		}
+		return finite[i] + (pos - float64(i)) * (finite[i+1] - finite[i])
+	}
+	alpha := 1 - b.Level
+	return BootSummary{math.Sqrt(ss / float64(n - 1)), quantile(alpha / 2), quantile(1 - alpha / 2)}
+}
+
+// The bootstrapped statistics, in output order
+const (
+	BootTargetHits = iota
+	BootAltHits
+	BootTargetProp
+	BootAltOvlProp
+	NumBootStats
+)
+
+// Summarize the paired and self hits and the paired and overlap proportions
+// over the replicates of one window or region; nil replicates have no hits
+func (b BootFlags) Stats(reps BootReplicates) (out [NumBootStats]BootSummary) {
+	if reps == nil {
+		reps = make(BootReplicates, b.Reps)
+	}
+	vals := make([]float64, len(reps))
+	for stat := 0; stat < NumBootStats; stat++ {
+		for i, c := range reps {
+			switch stat {
+			case BootTargetHits: vals[i] = float64(c.Pair)
+			case BootAltHits: vals[i] = float64(c.Self)
+			case BootTargetProp: vals[i] = float64(c.Pair) / (float64(c.Pair) + float64(c.Self))
+			case BootAltOvlProp: vals[i] = float64(c.Ovl) / (float64(c.Ovl) + float64(c.NonOvl))
+			default:
+			}
+		}
+		out[stat] = b.Summarize(vals)
+	}
+	return out
+}
+
+// Bootstrap standard errors and percentile intervals, only included in JSON
+// output when a bootstrap is requested
+type BootJsonStat struct {
+	BootReplicates int
+	BootLevel JsonFloat
+	TargetHitsBootSE JsonFloat
+	TargetHitsBootLo JsonFloat
+	TargetHitsBootHi JsonFloat
+	AltHitsBootSE JsonFloat
+	AltHitsBootLo JsonFloat
+	AltHitsBootHi JsonFloat
+	TargetPropBootSE JsonFloat
+	TargetPropBootLo JsonFloat
+	TargetPropBootHi JsonFloat
+	AltOvlPropBootSE JsonFloat
+	AltOvlPropBootLo JsonFloat
+	AltOvlPropBootHi JsonFloat
+}
+
+// Add the bootstrap statistics of one window or region to j
+func (j *JsonOutStat) AddBoot(b BootFlags, reps BootReplicates) {
+	s := b.Stats(reps)
+	f := func(stat int) (JsonFloat, JsonFloat, JsonFloat) {
+		return JsonFloat(s[stat].SE), JsonFloat(s[stat].Lo), JsonFloat(s[stat].Hi)
+	}
+	bj := &BootJsonStat{BootReplicates: b.Reps, BootLevel: JsonFloat(b.Level)}
+	bj.TargetHitsBootSE, bj.TargetHitsBootLo, bj.TargetHitsBootHi = f(BootTargetHits)
+	bj.AltHitsBootSE, bj.AltHitsBootLo, bj.AltHitsBootHi = f(BootAltHits)
+	bj.TargetPropBootSE, bj.TargetPropBootLo, bj.TargetPropBootHi = f(BootTargetProp)
+	bj.AltOvlPropBootSE, bj.AltOvlPropBootLo, bj.AltOvlPropBootHi = f(BootAltOvlProp)
+	j.BootJsonStat = bj
+}
+
+var bootColNames = [NumBootStats]string{"hits", "alt_hits", "pair_prop", "ovl_prop"}
+
+// The header columns of the bootstrap statistics; the overlap proportion is
+// only included with a read length
+func (b BootFlags) HeaderCols(readlen int64) string {
+	if b.Reps == 0 {
+		return ""
+	}
+	var s strings.Builder
+	for stat, name := range bootColNames {
+		if stat == BootAltOvlProp && readlen == -1 {
+			continue
+		}
+		fmt.Fprintf(&s, "\t%v_boot_se\t%v_boot_lo\t%v_boot_hi", name, name, name)
+	}
+	return s.String()
+}
+
+// Write the bootstrap columns of one window or region
+func FprintBootCols(w io.Writer, b BootFlags, reps BootReplicates, readlen int64) {
+	if b.Reps == 0 {
+		return
+	}
+	for stat, s := range b.Stats(reps) {
+		if stat == BootAltOvlProp && readlen == -1 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%.8g\t%.8g\t%.8g", s.SE, s.Lo, s.Hi)
+	}
+}
+
+// The bootstrap settings of stats, with no replicates if there is no
+// bootstrap
+func (stats AllWinStats) BootFlags() BootFlags {
+	if stats.Boot == nil {
+		return BootFlags{}
+	}
+	return stats.Boot.BootFlags
+}
+
+// Add the weighted self or paired and overlap hits of a pair to the
+// replicates of a region and of the genome of each read inside it, following
+// the same rules as IncrementRegionGenomes
+func IncrementRegionBoot(p Pair, r *Region, readlen int64, weights []uint32) {
+	if r.Boot == nil {
+		r.Boot = make(BootReplicates, len(weights))
+	}
+	hit_type := P
+	if p.Read1.Parent == p.Read2.Parent {
+		hit_type = S
+	}
+	ovl_type := HitType(-1)
+	if readlen != -1 {
+		ovl_type = NonOvl
+		if PairOverlaps(p, readlen) {
+			ovl_type = Ovl
+		}
+	}
+
+	r.Boot.Add(hit_type, weights)
+	r.Boot.Add(ovl_type, weights)
+	for _, genome := range regionPairGenomes(p, r) {
+		g := r.GenomeBootReps(genome, len(weights))
+		g.Add(hit_type, weights)
+		g.Add(ovl_type, weights)
+	}
+}
+
+// Get the replicates of a region for one genome, creating them if necessary
+func (r *Region) GenomeBootReps(genome string, reps int) BootReplicates {
+	if r.GenomeBoot == nil {
+		r.GenomeBoot = map[string]BootReplicates{}
+	}
+	if _, ok := r.GenomeBoot[genome]; !ok {
+		r.GenomeBoot[genome] = make(BootReplicates, reps)
+	}
+	return r.GenomeBoot[genome]
+}
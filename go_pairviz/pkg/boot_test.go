@@ -0,0 +1,126 @@
+package pairviz
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBootWeights(t *testing.T) {
+	b := BootFlags{Reps: 100, Seed: 7, Level: 0.9}
+	sum, sumsq, n := 0.0, 0.0, 0.0
+	var w []uint32
+	for i := int64(0); i < 1000; i++ {
+		w = b.Weights(i, w)
+		for _, x := range w {
+			sum += float64(x)
+			sumsq += float64(x) * float64(x)
+			n++
+		}
+	}
+	mean := sum / n
+	if math.Abs(mean - 1) > 0.02 || math.Abs(sumsq / n - mean * mean - 1) > 0.05 {
+		t.Errorf("weights not Poisson(1): mean %v, variance %v", mean, sumsq / n - mean * mean)
+	}
+	if reflect.DeepEqual(b.Weights(3, nil), b.Weights(4, nil)) || !reflect.DeepEqual(b.Weights(3, nil), b.Weights(3, nil)) {
+		t.Errorf("weights not determined by ordinal")
+	}
+
+	s := b.Summarize([]float64{5, 1, math.NaN(), 3, 2, 4})
+	if math.Abs(s.SE - math.Sqrt(2.5)) > 1e-9 || math.Abs(s.Lo - 1.2) > 1e-9 || math.Abs(s.Hi - 4.8) > 1e-9 {
+		t.Errorf("summary wrong: %v", s)
+	}
+}
+
+func TestBootWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 100
+	flags.WinStep = 50
+	flags.ReadLen = 150
+	flags.BootReps = 40
+	flags.BootSeed = 3
+	flags.CILevel = 0.95
+	in := makeParallelTestIn(3000)
+
+	serial, e := WinStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	flags.Threads = 3
+	parallel, e := winStatsParallel(flags, strings.NewReader(in), 101)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(serial.Boot.Hits, parallel.Boot.Hits) || !reflect.DeepEqual(serial.Boot.GenomeHits, parallel.Boot.GenomeHits) {
+		t.Errorf("parallel bootstrap differs from serial bootstrap")
+	}
+
+	flags.Threads = 1
+	flags.BootSeed = 4
+	reseeded, e := WinStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if reflect.DeepEqual(serial.Boot.Hits, reseeded.Boot.Hits) {
+		t.Errorf("bootstrap does not depend on seed")
+	}
+
+	// The replicate means should be close to the observed counts
+	for chrom, wins := range serial.Hits.Hits {
+		for i, win := range *wins {
+			mean := 0.0
+			for _, c := range serial.Boot.Hits.Win(chrom, i) {
+				mean += float64(c.Self)
+			}
+			mean /= float64(flags.BootReps)
+			if obs := float64(win.SelfHits); math.Abs(mean - obs) > 5 * math.Sqrt(obs / float64(flags.BootReps)) + 1 {
+				t.Errorf("%v %v: replicate mean %v far from %v", chrom, i, mean, obs)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	FprintWinStatsSeparateGenomes(&buf, serial, flags.ReadLen)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	header := strings.Split(lines[0], "\t")
+	if !strings.Contains(lines[0], "\tpair_prop_boot_se\tpair_prop_boot_lo\tpair_prop_boot_hi\tovl_prop_boot_se") {
+		t.Errorf("header wrong: %v", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if n := len(strings.Split(line, "\t")); n != len(header) {
+			t.Fatalf("%v columns in row, %v in header", n, len(header))
+		}
+	}
+}
+
+func TestBootRegionStats(t *testing.T) {
+	flags := gFlags
+	flags.ReadLen = 150
+	flags.BootReps = 30
+	flags.CILevel = 0.9
+	flags.Region = filepath.Join(t.TempDir(), "regions.bed")
+	if e := os.WriteFile(flags.Region, []byte("X\t100\t900\nX\t2000\t2500\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	stats, e := GetRegionStats(flags, strings.NewReader(makeParallelTestIn(2000)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, region := range stats.Regions {
+		if len(region.Boot) != flags.BootReps || len(region.GenomeBoot) != 2 {
+			t.Fatalf("region replicates missing: %v", region)
+		}
+	}
+
+	j := MakeRegionJsonOutStat("ISO1", stats, stats.Regions[0], *stats.Regions[0].GenomeHits["ISO1"])
+	if j.BootJsonStat == nil || j.BootReplicates != 30 || !(j.TargetHitsBootLo <= j.TargetHits && j.TargetHits <= j.TargetHitsBootHi) {
+		t.Errorf("region bootstrap JSON wrong: %v", j.BootJsonStat)
+	}
+	if j.TargetHitsBootSE <= 0 || j.AltOvlPropBootSE <= 0 {
+		t.Errorf("zero standard errors: %v", j.BootJsonStat)
+	}
+}
@@ -0,0 +1,738 @@
+package pairviz
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+)
+
+var ErrNoBrowseData = errors.New("No pairviz JSON output found")
+var ErrUnknownSample = errors.New("Unknown sample")
+var ErrUnknownChrom = errors.New("Unknown chromosome")
+var ErrUnknownTrack = errors.New("Unknown track")
+var ErrBadRange = errors.New("Start must be below end")
+
+// A float that is written to JSON as null if it is NaN or infinite, so that
+// the browser and notebooks can read it with a standard JSON parser
+type browseFloat float64
+
+func (f browseFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+// The windows of one sample on one chromosome, sorted by start, with one
+// column of values per metric. MaxWidth is the widest window, for finding the
+// windows that overlap a position.
+type BrowseWins struct {
+	Starts []int64
+	Ends []int64
+	Values map[string][]float64
+	MaxWidth int64
+}
+
+// One sample: the records of one input file, or the records with one Name in
+// a file with several names
+type BrowseSample struct {
+	Name string
+	Path string
+	Chroms []string
+	Wins map[string]*BrowseWins `json:"-"`
+}
+
+// One interval of a BED or bedGraph track; Value is the fourth column if it
+// is numeric, and Name is the fourth column otherwise
+type BrowseInterval struct {
+	Start int64
+	End int64
+	Name string `json:",omitempty"`
+	Value browseFloat
+}
+
+// A BED or bedGraph file to draw along with the samples
+type BrowseTrack struct {
+	Name string
+	Path string
+	Intervals map[string][]BrowseInterval `json:"-"`
+}
+
+type BrowseChrom struct {
+	Name string
+	Length int64
+}
+
+// An in-memory index of pairviz JSON outputs and tracks, built once and then
+// queried by region
+type BrowseIndex struct {
+	Samples []*BrowseSample
+	Chroms []BrowseChrom
+	Metrics []string
+	Tracks []*BrowseTrack
+
+	samples map[string]*BrowseSample
+	tracks map[string]*BrowseTrack
+	chromlens map[string]int64
+	chroms []string
+	// The input chromosome of each indexed chromosome, which is named
+	// <chrom>_<genome> when all genomes are indexed
+	bare map[string]string
+}
+
+// Options for building a BrowseIndex. Only records from Genome are used if it
+// is set, keeping the original chromosome names; otherwise chromosomes are
+// named <chrom>_<genome>. Only the metrics in Metrics are indexed if it is
+// set, and every numeric metric otherwise.
+type BrowseFlags struct {
+	Genome string
+	Metrics []string
+	ChromLens string
+}
+
+func NewBrowseIndex() *BrowseIndex {
+	return &BrowseIndex{
+		samples: map[string]*BrowseSample{},
+		tracks: map[string]*BrowseTrack{},
+		chromlens: map[string]int64{},
+		bare: map[string]string{},
+	}
+}
+
+// The numeric metrics of JsonOutStat, including the optional ones, other than
+// the window positions
+func browseMetrics() []string {
+	var metrics []string
+	for _, f := range reflect.VisibleFields(reflect.TypeOf(JsonOutStat{})) {
+		if f.Anonymous || f.Name == "Start" || f.Name == "End" {
+			continue
+		}
+		if _, err := metricIndex(f.Name); err == nil {
+			metrics = append(metrics, f.Name)
+		}
+	}
+	return metrics
+}
+
+func (x *BrowseIndex) addChrom(chrom, bare string, end int64) {
+	l, ok := x.chromlens[chrom]
+	if !ok {
+		x.chroms = append(x.chroms, chrom)
+		x.bare[chrom] = bare
+	}
+	if end > l {
+		x.chromlens[chrom] = end
+	}
+}
+
+// Add the records of one pairviz JSON output as the sample name, or as one
+// sample per Name, named <name>:<Name>, if the records have names
+func (x *BrowseIndex) AddSample(name, path string, it iter.Seq2[JsonOutStat, error], flags BrowseFlags) error {
+	metrics := flags.Metrics
+	if len(metrics) == 0 {
+		metrics = browseMetrics()
+	}
+	indices := make([][]int, len(metrics))
+	for i, m := range metrics {
+		var err error
+		if indices[i], err = metricIndex(m); err != nil {
+			return fmt.Errorf("AddSample: %w", err)
+		}
+	}
+
+	byname := map[string]*BrowseSample{}
+	var order []*BrowseSample
+	for j, err := range it {
+		if err != nil {
+			return fmt.Errorf("AddSample: %v: %w", path, err)
+		}
+		if flags.Genome != "" && j.Genome != flags.Genome {
+			continue
+		}
+		chrom := j.Chr + "_" + j.Genome
+		if flags.Genome != "" {
+			chrom = j.Chr
+		}
+
+		s, ok := byname[j.Name]
+		if !ok {
+			sname := name
+			if j.Name != "" {
+				sname = name + ":" + j.Name
+			}
+			if _, dup := x.samples[sname]; dup {
+				return fmt.Errorf("AddSample: %q: duplicate sample", sname)
+			}
+			s = &BrowseSample{Name: sname, Path: path, Wins: map[string]*BrowseWins{}}
+			byname[j.Name] = s
+			order = append(order, s)
+		}
+		w, ok := s.Wins[chrom]
+		if !ok {
+			w = &BrowseWins{Values: map[string][]float64{}}
+			s.Wins[chrom] = w
+			s.Chroms = append(s.Chroms, chrom)
+		}
+		w.Starts = append(w.Starts, j.Start)
+		w.Ends = append(w.Ends, j.End)
+		for i, m := range metrics {
+			v, err := jsonMetricIndex(j, m, indices[i])
+			if err != nil {
+				v = math.NaN()
+			}
+			col := w.Values[m]
+			if col == nil && !math.IsNaN(v) {
+				col = make([]float64, len(w.Starts) - 1, len(w.Starts))
+				for k := range col {
+					col[k] = math.NaN()
+				}
+			}
+			if col != nil {
+				w.Values[m] = append(col, v)
+			}
+		}
+		x.addChrom(chrom, j.Chr, j.End)
+	}
+
+	for _, s := range order {
+		for _, w := range s.Wins {
+			w.sort()
+		}
+		x.Samples = append(x.Samples, s)
+		x.samples[s.Name] = s
+	}
+	return nil
+}
+
+// Sort windows by start, padding metric columns that ended early with NaN
+func (w *BrowseWins) sort() {
+	n := len(w.Starts)
+	for m, col := range w.Values {
+		for len(col) < n {
+			col = append(col, math.NaN())
+		}
+		w.Values[m] = col
+	}
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(i, j int) bool { return w.Starts[perm[i]] < w.Starts[perm[j]] })
+	reorder := func(a []int64) []int64 {
+		b := make([]int64, n)
+		for i, p := range perm {
+			b[i] = a[p]
+		}
+		return b
+	}
+	w.Starts, w.Ends = reorder(w.Starts), reorder(w.Ends)
+	for m, col := range w.Values {
+		sorted := make([]float64, n)
+		for i, p := range perm {
+			sorted[i] = col[p]
+		}
+		w.Values[m] = sorted
+	}
+	for i := range w.Starts {
+		if width := w.Ends[i] - w.Starts[i]; width > w.MaxWidth {
+			w.MaxWidth = width
+		}
+	}
+}
+
+// Add a BED or bedGraph file as a track
+func (x *BrowseIndex) AddTrack(name, path string, r io.Reader) error {
+	if _, dup := x.tracks[name]; dup {
+		return fmt.Errorf("AddTrack: %q: duplicate track", name)
+	}
+	t := &BrowseTrack{Name: name, Path: path, Intervals: map[string][]BrowseInterval{}}
+	s := fasttsv.NewScanner(r)
+	lineno := int64(0)
+	for s.Scan() {
+		lineno++
+		line := s.Line()
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") || strings.HasPrefix(line[0], "track") || strings.HasPrefix(line[0], "browser") {
+			continue
+		}
+		region, err := ParseRegion(line)
+		if err != nil {
+			return fmt.Errorf("AddTrack: %v: %w", path, &ParseError{Line: lineno, Text: strings.Join(line, "\t"), Err: err})
+		}
+		iv := BrowseInterval{Start: region.Start, End: region.End, Value: browseFloat(math.NaN())}
+		if v, err := strconv.ParseFloat(region.Name, 64); err == nil {
+			iv.Value = browseFloat(v)
+		} else {
+			iv.Name = region.Name
+		}
+		t.Intervals[region.Chrom] = append(t.Intervals[region.Chrom], iv)
+	}
+	if err := s.InScanner.Err(); err != nil {
+		return fmt.Errorf("AddTrack: %v: %w", path, err)
+	}
+	for _, ivs := range t.Intervals {
+		sort.SliceStable(ivs, func(i, j int) bool { return ivs[i].Start < ivs[j].Start })
+	}
+	x.Tracks = append(x.Tracks, t)
+	x.tracks[name] = t
+	return nil
+}
+
+// Finish the index after adding samples and tracks: order the chromosomes,
+// by the chromosome lengths file if there is one, and list the metrics that
+// have values. A chromosome of the file matches the <chrom>_<genome> of
+// every genome.
+func (x *BrowseIndex) Finish(flags BrowseFlags) error {
+	if len(x.Samples) == 0 {
+		return ErrNoBrowseData
+	}
+	chroms := x.chroms
+	if flags.ChromLens != "" {
+		var err error
+		if chroms, err = readChromOrder(flags.ChromLens, x.chroms, x.chromlens, x.bare); err != nil {
+			return fmt.Errorf("Finish: %w", err)
+		}
+	}
+	x.chroms = chroms
+	x.Chroms = nil
+	for _, chrom := range chroms {
+		x.Chroms = append(x.Chroms, BrowseChrom{chrom, x.chromlens[chrom]})
+	}
+
+	present := map[string]bool{}
+	for _, s := range x.Samples {
+		for _, w := range s.Wins {
+			for m := range w.Values {
+				present[m] = true
+			}
+		}
+	}
+	x.Metrics = nil
+	for _, m := range browseMetrics() {
+		if present[m] {
+			x.Metrics = append(x.Metrics, m)
+		}
+	}
+	return nil
+}
+
+// The name of a sample or track file: its path below the directory, without
+// extensions
+func browseName(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." {
+		rel = filepath.Base(path)
+	}
+	base := filepath.Base(rel)
+	if i := strings.Index(base, "."); i > 0 {
+		base = base[:i]
+	}
+	return filepath.ToSlash(filepath.Join(filepath.Dir(rel), base))
+}
+
+func hasAnySuffix(path string, suffixes ...string) bool {
+	for _, s := range suffixes {
+		if strings.HasSuffix(path, s) || strings.HasSuffix(path, s + ".gz") {
+			return true
+		}
+	}
+	return false
+}
+
+// Build an index of every pairviz JSON output (.json) in the directories or
+// files in paths, searching directories recursively, along with the BED and
+// bedGraph files (.bed, .bedgraph, .bg) as tracks
+func LoadBrowseIndex(paths []string, flags BrowseFlags) (*BrowseIndex, error) {
+	x := NewBrowseIndex()
+	add := func(dir, path string) error {
+		switch {
+		case hasAnySuffix(path, ".json"):
+			r, err := OpenMaybeGz(path)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return x.AddSample(browseName(dir, path), path, ParsePairvizOut(r), flags)
+		case hasAnySuffix(path, ".bed", ".bedgraph", ".bg"):
+			r, err := OpenMaybeGz(path)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return x.AddTrack(browseName(dir, path), path, r)
+		default:
+		}
+		return nil
+	}
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("LoadBrowseIndex: %w", err)
+		}
+		if !info.IsDir() {
+			if err := add(filepath.Dir(p), p); err != nil {
+				return nil, fmt.Errorf("LoadBrowseIndex: %w", err)
+			}
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return add(p, path)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("LoadBrowseIndex: %w", err)
+		}
+	}
+	if err := x.Finish(flags); err != nil {
+		return nil, fmt.Errorf("LoadBrowseIndex: %w", err)
+	}
+	return x, nil
+}
+
+// A request for the values of some samples and metrics in one region. Bins
+// above 0 averages the windows into at most that many bins of equal width.
+type BrowseQuery struct {
+	Samples []string
+	Metrics []string
+	Chrom string
+	Start int64
+	End int64
+	Bins int
+}
+
+// The values of one sample and metric in a region; each value covers Starts[i]
+// to Ends[i]
+type BrowseSeries struct {
+	Sample string
+	Metric string
+	Starts []int64
+	Ends []int64
+	Values []browseFloat
+}
+
+type BrowseResult struct {
+	Chrom string
+	Start int64
+	End int64
+	Binned bool
+	Series []BrowseSeries
+}
+
+// Fill in the defaults of a query: every sample, the first metric, and the
+// whole chromosome
+func (x *BrowseIndex) checkQuery(q *BrowseQuery) error {
+	if q.Chrom == "" {
+		q.Chrom = x.chroms[0]
+	}
+	l, ok := x.chromlens[q.Chrom]
+	if !ok {
+		return fmt.Errorf("%q: %w", q.Chrom, ErrUnknownChrom)
+	}
+	if q.End <= 0 {
+		q.End = l
+	}
+	if q.Start < 0 {
+		q.Start = 0
+	}
+	if q.Start >= q.End {
+		return ErrBadRange
+	}
+	if len(q.Samples) == 0 {
+		for _, s := range x.Samples {
+			q.Samples = append(q.Samples, s.Name)
+		}
+	}
+	for _, s := range q.Samples {
+		if _, ok := x.samples[s]; !ok {
+			return fmt.Errorf("%q: %w", s, ErrUnknownSample)
+		}
+	}
+	if len(q.Metrics) == 0 && len(x.Metrics) > 0 {
+		q.Metrics = x.Metrics[:1]
+	}
+	for _, m := range q.Metrics {
+		if _, err := metricIndex(m); err != nil {
+			return err
+		}
+		if !slices.Contains(x.Metrics, m) {
+			return fmt.Errorf("%q: not indexed: %w", m, ErrBadMetric)
+		}
+	}
+	return nil
+}
+
+// The indices of the windows that overlap start to end
+func (w *BrowseWins) overlapping(start, end int64) (int, int) {
+	lo := sort.Search(len(w.Starts), func(i int) bool { return w.Starts[i] > start - w.MaxWidth })
+	hi := sort.Search(len(w.Starts), func(i int) bool { return w.Starts[i] >= end })
+	for lo < hi && w.Ends[lo] <= start {
+		lo++
+	}
+	return lo, hi
+}
+
+// Get the values of each sample and metric in a region
+func (x *BrowseIndex) Query(q BrowseQuery) (BrowseResult, error) {
+	if err := x.checkQuery(&q); err != nil {
+		return BrowseResult{}, fmt.Errorf("Query: %w", err)
+	}
+	res := BrowseResult{Chrom: q.Chrom, Start: q.Start, End: q.End}
+	for _, sname := range q.Samples {
+		w := x.samples[sname].Wins[q.Chrom]
+		for _, m := range q.Metrics {
+			series := BrowseSeries{Sample: sname, Metric: m, Starts: []int64{}, Ends: []int64{}, Values: []browseFloat{}}
+			if w != nil && w.Values[m] != nil {
+				lo, hi := w.overlapping(q.Start, q.End)
+				if q.Bins > 0 && hi - lo > q.Bins {
+					res.Binned = true
+					binWindows(&series, w, m, lo, hi, q)
+				} else {
+					series.Starts = w.Starts[lo:hi]
+					series.Ends = w.Ends[lo:hi]
+					for _, v := range w.Values[m][lo:hi] {
+						series.Values = append(series.Values, browseFloat(v))
+					}
+				}
+			}
+			res.Series = append(res.Series, series)
+		}
+	}
+	return res, nil
+}
+
+// Average windows lo to hi into q.Bins bins of equal width by their
+// midpoints, leaving out bins with no windows
+func binWindows(series *BrowseSeries, w *BrowseWins, metric string, lo, hi int, q BrowseQuery) {
+	width := float64(q.End - q.Start) / float64(q.Bins)
+	sums := make([]float64, q.Bins)
+	counts := make([]int, q.Bins)
+	wins := make([]int, q.Bins)
+	for i := lo; i < hi; i++ {
+		mid := float64(w.Starts[i] + w.Ends[i]) / 2
+		b := int((mid - float64(q.Start)) / width)
+		if b < 0 {
+			b = 0
+		}
+		if b >= q.Bins {
+			b = q.Bins - 1
+		}
+		wins[b]++
+		if v := w.Values[metric][i]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+			sums[b] += v
+			counts[b]++
+		}
+	}
+	for b := range sums {
+		if wins[b] == 0 {
+			continue
+		}
+		series.Starts = append(series.Starts, q.Start + int64(float64(b) * width))
+		series.Ends = append(series.Ends, q.Start + int64(float64(b + 1) * width))
+		series.Values = append(series.Values, browseFloat(sums[b] / float64(counts[b])))
+	}
+}
+
+type BrowseTrackResult struct {
+	Name string
+	Intervals []BrowseInterval
+}
+
+// Get the intervals of tracks that overlap a region, or of every track if
+// names is empty
+func (x *BrowseIndex) TrackIntervals(names []string, chrom string, start, end int64) ([]BrowseTrackResult, error) {
+	if len(names) == 0 {
+		for _, t := range x.Tracks {
+			names = append(names, t.Name)
+		}
+	}
+	out := []BrowseTrackResult{}
+	for _, name := range names {
+		t, ok := x.tracks[name]
+		if !ok {
+			return nil, fmt.Errorf("TrackIntervals: %q: %w", name, ErrUnknownTrack)
+		}
+		res := BrowseTrackResult{Name: name, Intervals: []BrowseInterval{}}
+		ivs := t.Intervals[chrom]
+		hi := sort.Search(len(ivs), func(i int) bool { return ivs[i].Start >= end })
+		for _, iv := range ivs[:hi] {
+			if iv.End > start {
+				res.Intervals = append(res.Intervals, iv)
+			}
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// Split repeated and comma-separated query parameters
+func queryList(vals []string) []string {
+	var out []string
+	for _, v := range vals {
+		for _, s := range strings.Split(v, ",") {
+			if s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+func queryInt(vals map[string][]string, key string, def int64) (int64, error) {
+	v := vals[key]
+	if len(v) == 0 || v[0] == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(v[0], 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %w", key, err)
+	}
+	return i, nil
+}
+
+func writeBrowseJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func browseError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	if errors.Is(err, ErrUnknownSample) || errors.Is(err, ErrUnknownChrom) || errors.Is(err, ErrUnknownTrack) || errors.Is(err, ErrBadMetric) {
+		code = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// An HTTP handler serving the browser page at / and the JSON endpoints:
+//
+//	/api/index: the samples, chromosomes, metrics, and tracks
+//	/api/windows?sample=&metric=&chrom=&start=&end=&bins=: a BrowseResult
+//	/api/tracks?track=&chrom=&start=&end=: the intervals of tracks
+//
+// sample, metric, and track may be repeated or comma-separated. bins is
+// defBins if it is not given; 0 turns off binning.
+func (x *BrowseIndex) Handler(defBins int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, browsePage)
+	})
+	mux.HandleFunc("/api/index", func(w http.ResponseWriter, r *http.Request) {
+		writeBrowseJson(w, x)
+	})
+	mux.HandleFunc("/api/windows", func(w http.ResponseWriter, r *http.Request) {
+		vals := r.URL.Query()
+		q := BrowseQuery{Samples: queryList(vals["sample"]), Metrics: queryList(vals["metric"]), Chrom: vals.Get("chrom")}
+		var err error
+		var bins int64
+		if q.Start, err = queryInt(vals, "start", 0); err != nil {
+			browseError(w, err)
+			return
+		}
+		if q.End, err = queryInt(vals, "end", 0); err != nil {
+			browseError(w, err)
+			return
+		}
+		if bins, err = queryInt(vals, "bins", int64(defBins)); err != nil {
+			browseError(w, err)
+			return
+		}
+		q.Bins = int(bins)
+		res, err := x.Query(q)
+		if err != nil {
+			browseError(w, err)
+			return
+		}
+		writeBrowseJson(w, res)
+	})
+	mux.HandleFunc("/api/tracks", func(w http.ResponseWriter, r *http.Request) {
+		vals := r.URL.Query()
+		chrom := vals.Get("chrom")
+		if _, ok := x.chromlens[chrom]; !ok {
+			browseError(w, fmt.Errorf("%q: %w", chrom, ErrUnknownChrom))
+			return
+		}
+		start, err := queryInt(vals, "start", 0)
+		if err != nil {
+			browseError(w, err)
+			return
+		}
+		end, err := queryInt(vals, "end", x.chromlens[chrom])
+		if err != nil {
+			browseError(w, err)
+			return
+		}
+		tracks, err := x.TrackIntervals(queryList(vals["track"]), chrom, start, end)
+		if err != nil {
+			browseError(w, err)
+			return
+		}
+		writeBrowseJson(w, tracks)
+	})
+	return mux
+}
+
+func FullBrowse() {
+	var flags BrowseFlags
+	addr := flag.String("addr", "localhost:8080", "Address to serve the browser on")
+	metrics := flag.String("m", "", "Comma-separated metrics to index (default: every numeric field)")
+	bins := flag.Int("bins", 2000, "Default number of bins to average the windows of a region into when there are more windows than bins; 0 to never bin")
+	flag.StringVar(&flags.Genome, "G", "", "Only use this genome, keeping the original chromosome names (default: all genomes, with chromosomes named <chrom>_<genome>)")
+	flag.StringVar(&flags.ChromLens, "L", "", "Chromosome lengths .bed file, also used for the chromosome order; its names match the chromosome of every genome")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] dir_or_file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	usage := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(2)
+		}
+	}
+	if flag.NArg() == 0 {
+		usage(errors.New("No directories or files given"))
+	}
+	if *metrics != "" {
+		flags.Metrics = strings.Split(*metrics, ",")
+		for _, m := range flags.Metrics {
+			_, e := metricIndex(m)
+			usage(e)
+		}
+	}
+
+	h := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	x, e := LoadBrowseIndex(flag.Args(), flags)
+	h(e)
+	fmt.Fprintf(os.Stderr, "Serving %v samples, %v chromosomes, and %v tracks at http://%v/\n", len(x.Samples), len(x.Chroms), len(x.Tracks), *addr)
+	h(http.ListenAndServe(*addr, x.Handler(*bins)))
+}
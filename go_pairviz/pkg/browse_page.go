@@ -0,0 +1,390 @@
+package pairviz
+
+// The page served by the browser. It only uses the JSON endpoints of
+// BrowseIndex.Handler, so it works without network access.
+const browsePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pairviz browser</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 0; display: flex; height: 100vh; }
+#side { width: 260px; padding: 8px; border-right: 1px solid #ccc; overflow-y: auto; flex: none; }
+#main { flex: 1; padding: 8px; overflow: auto; }
+#side select { width: 100%; }
+#side h3 { margin: 10px 0 4px 0; font-size: 13px; }
+#bar input[type=number] { width: 110px; }
+#bar { margin-bottom: 6px; }
+#plot { border: 1px solid #ccc; user-select: none; }
+#legend span { display: inline-block; margin-right: 12px; }
+#legend i { display: inline-block; width: 14px; height: 3px; margin-right: 4px; vertical-align: middle; }
+#status { color: #a00; margin: 4px 0; }
+#apiurl { color: #555; word-break: break-all; }
+</style>
+</head>
+<body>
+<div id="side">
+<h3>Samples</h3>
+<input id="filter" placeholder="filter samples" style="width:100%">
+<select id="samples" multiple size="14"></select>
+<button id="allsamples">All</button> <button id="nosamples">None</button>
+<h3>Metrics</h3>
+<select id="metrics" multiple size="10"></select>
+<h3>Tracks</h3>
+<div id="tracks"></div>
+<h3>Display</h3>
+<label><input type="checkbox" id="log"> Log-scale y axis</label><br>
+<label><input type="checkbox" id="points"> Points instead of lines</label>
+</div>
+<div id="main">
+<div id="bar">
+<select id="chrom"></select>
+<input type="number" id="start" min="0"> -
+<input type="number" id="end" min="1">
+<button id="go">Go</button>
+<button id="zoomin">Zoom in</button>
+<button id="zoomout">Zoom out</button>
+<button id="left">&larr;</button>
+<button id="right">&rarr;</button>
+<button id="whole">Whole chromosome</button>
+</div>
+<div id="status"></div>
+<svg id="plot" width="1000" height="420"></svg>
+<div id="legend"></div>
+<p>Drag across the plot to zoom into a region; double-click to zoom out.</p>
+<p>Data for this view: <a id="apiurl" href="#"></a></p>
+</div>
+<script>
+"use strict";
+var NS = "http://www.w3.org/2000/svg";
+var palette = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"];
+var index = null;
+var view = {chrom: "", start: 0, end: 0};
+var seq = 0;
+
+function $(id) { return document.getElementById(id); }
+
+function el(name, attrs, parent) {
+	var e = document.createElementNS(NS, name);
+	for (var k in attrs) { e.setAttribute(k, attrs[k]); }
+	if (parent) { parent.appendChild(e); }
+	return e;
+}
+
+function selected(sel) {
+	var out = [];
+	for (var i = 0; i < sel.options.length; i++) {
+		if (sel.options[i].selected) { out.push(sel.options[i].value); }
+	}
+	return out;
+}
+
+function setSelected(sel, vals) {
+	for (var i = 0; i < sel.options.length; i++) {
+		sel.options[i].selected = vals.indexOf(sel.options[i].value) >= 0;
+	}
+}
+
+function chromLen(name) {
+	for (var i = 0; i < index.Chroms.length; i++) {
+		if (index.Chroms[i].Name == name) { return index.Chroms[i].Length; }
+	}
+	return 0;
+}
+
+function checkedTracks() {
+	var out = [];
+	var boxes = $("tracks").getElementsByTagName("input");
+	for (var i = 0; i < boxes.length; i++) {
+		if (boxes[i].checked) { out.push(boxes[i].value); }
+	}
+	return out;
+}
+
+function params(extra) {
+	var p = new URLSearchParams();
+	p.set("chrom", view.chrom);
+	p.set("start", view.start);
+	p.set("end", view.end);
+	for (var k in extra) {
+		extra[k].forEach(function(v) { p.append(k, v); });
+	}
+	return p.toString();
+}
+
+function saveHash() {
+	var state = {sample: selected($("samples")), metric: selected($("metrics")), track: checkedTracks()};
+	history.replaceState(null, "", "#" + params(state));
+}
+
+function loadHash() {
+	var p = new URLSearchParams(location.hash.slice(1));
+	if (p.get("chrom") && chromLen(p.get("chrom")) > 0) {
+		view.chrom = p.get("chrom");
+		view.start = parseInt(p.get("start")) || 0;
+		view.end = parseInt(p.get("end")) || chromLen(view.chrom);
+	}
+	if (p.getAll("sample").length > 0) { setSelected($("samples"), p.getAll("sample")); }
+	if (p.getAll("metric").length > 0) { setSelected($("metrics"), p.getAll("metric")); }
+	var tracks = p.getAll("track");
+	var boxes = $("tracks").getElementsByTagName("input");
+	for (var i = 0; i < boxes.length; i++) { boxes[i].checked = tracks.indexOf(boxes[i].value) >= 0; }
+}
+
+function setView(chrom, start, end) {
+	var len = chromLen(chrom);
+	start = Math.round(start);
+	end = Math.round(end);
+	if (end - start < 10) {
+		var mid = (start + end) / 2;
+		start = Math.round(mid - 5);
+		end = start + 10;
+	}
+	if (start < 0) { end -= start; start = 0; }
+	if (end > len) { start -= end - len; end = len; }
+	view = {chrom: chrom, start: Math.max(0, start), end: end};
+	$("chrom").value = chrom;
+	$("start").value = view.start;
+	$("end").value = view.end;
+	draw();
+}
+
+function niceTicks(lo, hi, n) {
+	var span = hi - lo;
+	if (!(span > 0)) { return [lo]; }
+	var step = Math.pow(10, Math.floor(Math.log10(span / n)));
+	var err = span / n / step;
+	if (err >= 5) { step *= 10; } else if (err >= 2) { step *= 5; } else if (err >= 1.5) { step *= 2; }
+	var ticks = [];
+	for (var k = Math.ceil(lo / step); k * step <= hi + step * 1e-9; k++) { ticks.push(k * step); }
+	return ticks;
+}
+
+function fmt(v) {
+	if (v == 0) { return "0"; }
+	var a = Math.abs(v);
+	if (a >= 1e6 || a < 1e-3) { return v.toExponential(2); }
+	return String(Math.round(v * 1e4) / 1e4);
+}
+
+function fmtPos(v) {
+	if (v >= 1e6) { return (v / 1e6).toFixed(v % 1e6 == 0 ? 0 : 2) + " Mb"; }
+	if (v >= 1e3) { return (v / 1e3).toFixed(v % 1e3 == 0 ? 0 : 1) + " kb"; }
+	return String(v);
+}
+
+function draw() {
+	saveHash();
+	var samples = selected($("samples"));
+	var metrics = selected($("metrics"));
+	var tracks = checkedTracks();
+	var url = "api/windows?" + params({sample: samples, metric: metrics});
+	$("apiurl").href = url;
+	$("apiurl").textContent = url;
+	var my = ++seq;
+	$("status").textContent = "";
+	var wins = samples.length && metrics.length ? fetch(url).then(checkResponse) : Promise.resolve({Series: []});
+	var trk = tracks.length ? fetch("api/tracks?" + params({track: tracks})).then(checkResponse) : Promise.resolve([]);
+	Promise.all([wins, trk]).then(function(res) {
+		if (my == seq) { render(res[0].Series, res[1]); }
+	}).catch(function(e) {
+		$("status").textContent = e.message;
+	});
+}
+
+function checkResponse(r) {
+	if (!r.ok) { return r.text().then(function(t) { throw new Error(t); }); }
+	return r.json();
+}
+
+function render(series, tracks) {
+	var svg = $("plot");
+	var width = Math.max(600, $("main").clientWidth - 20);
+	var lane = 16;
+	var plotH = 340;
+	var left = 70, right = 20, top = 10;
+	var bottom = top + plotH;
+	var height = bottom + 40 + tracks.length * (lane + 4);
+	svg.setAttribute("width", width);
+	svg.setAttribute("height", height);
+	while (svg.firstChild) { svg.removeChild(svg.firstChild); }
+
+	var log = $("log").checked;
+	var lo = Infinity, hi = -Infinity;
+	series.forEach(function(s) {
+		s.Values.forEach(function(v) {
+			if (v === null || (log && v <= 0)) { return; }
+			var y = log ? Math.log10(v) : v;
+			if (y < lo) { lo = y; }
+			if (y > hi) { hi = y; }
+		});
+	});
+	if (!isFinite(lo)) { lo = 0; hi = 1; }
+	if (lo == hi) { lo -= 0.5; hi += 0.5; }
+	var pad = (hi - lo) * 0.05;
+	lo -= pad;
+	hi += pad;
+
+	var xs = function(pos) { return left + (pos - view.start) / (view.end - view.start) * (width - left - right); };
+	var ys = function(v) { return bottom - ((log ? Math.log10(v) : v) - lo) / (hi - lo) * plotH; };
+
+	el("rect", {x: left, y: top, width: width - left - right, height: plotH, fill: "none", stroke: "#000"}, svg);
+	niceTicks(view.start, view.end, 8).forEach(function(t) {
+		var x = xs(t);
+		el("line", {x1: x, x2: x, y1: bottom, y2: bottom + 5, stroke: "#000"}, svg);
+		var lab = el("text", {x: x, y: bottom + 18, "text-anchor": "middle", "font-size": 11}, svg);
+		lab.textContent = fmtPos(t);
+	});
+	niceTicks(lo, hi, 6).forEach(function(t) {
+		var y = bottom - (t - lo) / (hi - lo) * plotH;
+		el("line", {x1: left - 5, x2: left, y1: y, y2: y, stroke: "#000"}, svg);
+		el("line", {x1: left, x2: width - right, y1: y, y2: y, stroke: "#eee"}, svg);
+		var lab = el("text", {x: left - 8, y: y + 4, "text-anchor": "end", "font-size": 11}, svg);
+		lab.textContent = log ? fmt(Math.pow(10, t)) : fmt(t);
+	});
+
+	var clip = el("clipPath", {id: "clip"}, el("defs", {}, svg));
+	el("rect", {x: left, y: top, width: width - left - right, height: plotH}, clip);
+	var g = el("g", {"clip-path": "url(#clip)"}, svg);
+	var legend = $("legend");
+	legend.textContent = "";
+	var points = $("points").checked;
+	series.forEach(function(s, i) {
+		var color = palette[i % palette.length];
+		var label = s.Sample + " " + s.Metric;
+		var d = "";
+		var pen = false;
+		var sg = el("g", {}, g);
+		el("title", {}, sg).textContent = label;
+		for (var k = 0; k < s.Values.length; k++) {
+			var v = s.Values[k];
+			if (v === null || (log && v <= 0)) { pen = false; continue; }
+			var x = xs((s.Starts[k] + s.Ends[k]) / 2), y = ys(v);
+			if (points) {
+				el("circle", {cx: x, cy: y, r: 2, fill: color}, sg);
+			} else {
+				d += (pen ? "L" : "M") + x.toFixed(1) + " " + y.toFixed(1);
+				pen = true;
+			}
+		}
+		if (!points && d) { el("path", {d: d, fill: "none", stroke: color, "stroke-width": 1.5}, sg); }
+		var item = document.createElement("span");
+		var swatch = document.createElement("i");
+		swatch.style.background = color;
+		item.appendChild(swatch);
+		item.appendChild(document.createTextNode(label));
+		legend.appendChild(item);
+	});
+
+	tracks.forEach(function(t, i) {
+		var y = bottom + 30 + i * (lane + 4);
+		var lab = el("text", {x: left - 8, y: y + lane - 4, "text-anchor": "end", "font-size": 11}, svg);
+		lab.textContent = t.Name;
+		var vlo = Infinity, vhi = -Infinity;
+		t.Intervals.forEach(function(iv) {
+			if (iv.Value !== null) { vlo = Math.min(vlo, iv.Value); vhi = Math.max(vhi, iv.Value); }
+		});
+		var color = palette[(series.length + i) % palette.length];
+		t.Intervals.forEach(function(iv) {
+			var x1 = Math.max(left, xs(iv.Start)), x2 = Math.min(width - right, xs(iv.End));
+			var opacity = 0.8;
+			if (iv.Value !== null && vhi > vlo) { opacity = 0.15 + 0.85 * (iv.Value - vlo) / (vhi - vlo); }
+			var r = el("rect", {x: x1, y: y, width: Math.max(1, x2 - x1), height: lane, fill: color, "fill-opacity": opacity}, svg);
+			el("title", {}, r).textContent = t.Name + " " + view.chrom + ":" + iv.Start + "-" + iv.End + (iv.Name ? " " + iv.Name : "") + (iv.Value !== null ? " " + iv.Value : "");
+		});
+	});
+
+	var sel = el("rect", {y: top, height: plotH, fill: "#000", "fill-opacity": 0.1, width: 0, visibility: "hidden"}, svg);
+	var pos = function(ev) {
+		var r = svg.getBoundingClientRect();
+		return Math.min(width - right, Math.max(left, ev.clientX - r.left));
+	};
+	var unx = function(x) { return view.start + (x - left) / (width - left - right) * (view.end - view.start); };
+	var x0 = null;
+	svg.onmousedown = function(ev) { x0 = pos(ev); sel.setAttribute("x", x0); sel.setAttribute("width", 0); sel.setAttribute("visibility", "visible"); };
+	svg.onmousemove = function(ev) {
+		if (x0 === null) { return; }
+		var x = pos(ev);
+		sel.setAttribute("x", Math.min(x0, x));
+		sel.setAttribute("width", Math.abs(x - x0));
+	};
+	svg.onmouseup = function(ev) {
+		if (x0 === null) { return; }
+		var x = pos(ev);
+		sel.setAttribute("visibility", "hidden");
+		if (Math.abs(x - x0) > 3) { setView(view.chrom, unx(Math.min(x0, x)), unx(Math.max(x0, x))); }
+		x0 = null;
+	};
+	svg.ondblclick = function() { zoom(2); };
+}
+
+function zoom(f) {
+	var mid = (view.start + view.end) / 2, half = (view.end - view.start) / 2 * f;
+	setView(view.chrom, mid - half, mid + half);
+}
+
+function pan(f) {
+	var d = (view.end - view.start) * f;
+	setView(view.chrom, view.start + d, view.end + d);
+}
+
+function fillSamples() {
+	var sel = $("samples");
+	var keep = selected(sel);
+	var filter = $("filter").value;
+	sel.textContent = "";
+	index.Samples.forEach(function(s) {
+		if (filter && s.Name.indexOf(filter) < 0 && keep.indexOf(s.Name) < 0) { return; }
+		var o = new Option(s.Name, s.Name);
+		o.title = s.Path;
+		sel.appendChild(o);
+	});
+	setSelected(sel, keep);
+}
+
+function init(idx) {
+	index = idx;
+	fillSamples();
+	index.Metrics.forEach(function(m) { $("metrics").appendChild(new Option(m, m)); });
+	index.Chroms.forEach(function(c) { $("chrom").appendChild(new Option(c.Name, c.Name)); });
+	index.Tracks.forEach(function(t) {
+		var l = document.createElement("label");
+		var b = document.createElement("input");
+		b.type = "checkbox";
+		b.value = t.Name;
+		b.onchange = draw;
+		l.appendChild(b);
+		l.appendChild(document.createTextNode(" " + t.Name));
+		l.title = t.Path;
+		$("tracks").appendChild(l);
+		$("tracks").appendChild(document.createElement("br"));
+	});
+	if (index.Tracks.length == 0) { $("tracks").textContent = "none"; }
+	setSelected($("samples"), index.Samples.slice(0, 1).map(function(s) { return s.Name; }));
+	setSelected($("metrics"), index.Metrics.indexOf("TargetProp") >= 0 ? ["TargetProp"] : index.Metrics.slice(0, 1));
+	view = {chrom: index.Chroms[0].Name, start: 0, end: index.Chroms[0].Length};
+	loadHash();
+
+	$("filter").oninput = fillSamples;
+	$("samples").onchange = draw;
+	$("metrics").onchange = draw;
+	$("log").onchange = draw;
+	$("points").onchange = draw;
+	$("allsamples").onclick = function() { setSelected($("samples"), [].map.call($("samples").options, function(o) { return o.value; })); draw(); };
+	$("nosamples").onclick = function() { setSelected($("samples"), []); draw(); };
+	$("chrom").onchange = function() { setView(this.value, 0, chromLen(this.value)); };
+	$("go").onclick = function() { setView(view.chrom, parseInt($("start").value) || 0, parseInt($("end").value) || chromLen(view.chrom)); };
+	$("zoomin").onclick = function() { zoom(0.5); };
+	$("zoomout").onclick = function() { zoom(2); };
+	$("left").onclick = function() { pan(-0.5); };
+	$("right").onclick = function() { pan(0.5); };
+	$("whole").onclick = function() { setView(view.chrom, 0, chromLen(view.chrom)); };
+	window.onresize = draw;
+	setView(view.chrom, view.start, view.end);
+}
+
+fetch("api/index").then(checkResponse).then(init).catch(function(e) { $("status").textContent = e.message; });
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,151 @@
+package pairviz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBrowse(t *testing.T) {
+	dir := t.TempDir()
+	if e := os.Mkdir(filepath.Join(dir, "sub"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	for k, path := range []string{"a.json", "sub/b.json"} {
+		var b strings.Builder
+		for i := int64(19); i >= 0; i-- {
+			fmt.Fprintf(&b, `{"Genome":"ISO1","Chr":"X","Start":%v,"End":%v,"TargetHits":%v,"AltHits":10,"TargetProp":%v,"Name":""}`+"\n",
+				i * 500, i * 500 + 1000, i + int64(k) * 100, [2]string{`"NaN"`, "0.5"}[i % 2])
+		}
+		fmt.Fprintf(&b, `{"Genome":"A4","Chr":"2L","Start":0,"End":1000,"TargetHits":1,"AltHits":1,"TargetProp":0.5,"Name":""}`+"\n")
+		if e := os.WriteFile(filepath.Join(dir, path), []byte(b.String()), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := os.WriteFile(filepath.Join(dir, "doms.bed"), []byte("X\t0\t2000\tdomA\nX\t4000\t6000\t0.5\n2L\t0\t10\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	x, e := LoadBrowseIndex([]string{dir}, BrowseFlags{Genome: "ISO1"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(x.Samples) != 2 || x.Samples[0].Name != "a" || x.Samples[1].Name != "sub/b" {
+		t.Fatalf("wrong samples %v", x.Samples)
+	}
+	if len(x.Chroms) != 1 || x.Chroms[0] != (BrowseChrom{"X", 10500}) {
+		t.Errorf("wrong chromosomes %v", x.Chroms)
+	}
+	if x.Metrics[0] != "TargetHits" || x.Metrics[2] != "TargetProp" || strings.Contains(strings.Join(x.Metrics, " "), "BandMin") {
+		t.Errorf("wrong metrics %v", x.Metrics)
+	}
+
+	res, e := x.Query(BrowseQuery{Samples: []string{"sub/b"}, Metrics: []string{"TargetHits", "TargetProp"}, Chrom: "X", Start: 1200, End: 2500})
+	if e != nil {
+		t.Fatal(e)
+	}
+	s := res.Series[0]
+	if len(res.Series) != 2 || len(s.Starts) != 4 || s.Starts[0] != 500 || s.Values[0] != 101 || s.Values[3] != 104 {
+		t.Errorf("wrong query result %v", res)
+	}
+
+	res, e = x.Query(BrowseQuery{Bins: 5})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !res.Binned || len(res.Series) != 2 || len(res.Series[0].Values) != 5 || res.Series[0].Values[0] != 1.5 || res.Series[0].Ends[4] != 10500 {
+		t.Errorf("wrong binned result %v", res)
+	}
+
+	tracks, e := x.TrackIntervals(nil, "X", 1500, 4500)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(tracks) != 1 || len(tracks[0].Intervals) != 2 || tracks[0].Intervals[0].Name != "domA" || tracks[0].Intervals[1].Value != 0.5 {
+		t.Errorf("wrong tracks %v", tracks)
+	}
+
+	srv := httptest.NewServer(x.Handler(1000))
+	defer srv.Close()
+	resp, e := http.Get(srv.URL + "/api/windows?sample=a&metric=TargetHits,TargetProp&chrom=X&start=0&end=1000")
+	if e != nil {
+		t.Fatal(e)
+	}
+	var got struct {
+		Series []struct {
+			Sample string
+			Metric string
+			Values []*float64
+		}
+	}
+	e = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got.Series) != 2 || len(got.Series[0].Values) != 2 || *got.Series[0].Values[1] != 1 || got.Series[1].Values[0] != nil {
+		t.Errorf("wrong JSON response %v", got)
+	}
+
+	for _, q := range []string{"/api/windows?sample=c", "/api/windows?chrom=2L", "/api/tracks?chrom=X&track=none", "/nothing"} {
+		resp, e := http.Get(srv.URL + q)
+		if e != nil {
+			t.Fatal(e)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%v: status %v", q, resp.StatusCode)
+		}
+	}
+	if resp, e = http.Get(srv.URL + "/api/windows?start=5&end=2"); e == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("reversed range: status %v", resp.StatusCode)
+		}
+	}
+}
+
+func TestBrowseChromLens(t *testing.T) {
+	dir, lensdir := t.TempDir(), t.TempDir()
+	var b strings.Builder
+	for _, rec := range [][2]string{{"ISO1", "X"}, {"W501", "X"}, {"ISO1", "2L"}} {
+		fmt.Fprintf(&b, `{"Genome":%q,"Chr":%q,"Start":0,"End":1000,"TargetHits":1,"AltHits":1,"TargetProp":0.5,"Name":""}`+"\n", rec[0], rec[1])
+	}
+	if e := os.WriteFile(filepath.Join(dir, "a.json"), []byte(b.String()), 0644); e != nil {
+		t.Fatal(e)
+	}
+	lens := filepath.Join(lensdir, "chrlens.bed")
+	if e := os.WriteFile(lens, []byte("2L\t0\t25000\nX\t0\t30000\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	x, e := LoadBrowseIndex([]string{dir}, BrowseFlags{Metrics: []string{"TargetHits"}, ChromLens: lens})
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := []BrowseChrom{{"2L_ISO1", 25000}, {"X_ISO1", 30000}, {"X_W501", 30000}}
+	if !reflect.DeepEqual(x.Chroms, want) {
+		t.Errorf("chromosome lengths not used without -G: %v", x.Chroms)
+	}
+
+	if _, e = x.Query(BrowseQuery{Metrics: []string{"TargetProp"}}); !errors.Is(e, ErrBadMetric) {
+		t.Errorf("metric that was not indexed gave error %v", e)
+	}
+	srv := httptest.NewServer(x.Handler(1000))
+	defer srv.Close()
+	resp, e := http.Get(srv.URL + "/api/windows?metric=TargetProp")
+	if e != nil {
+		t.Fatal(e)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("metric that was not indexed: status %v", resp.StatusCode)
+	}
+}
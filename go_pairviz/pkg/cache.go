@@ -0,0 +1,771 @@
+package pairviz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
+)
+
+// The binary pairs cache stores the data columns that pairviz uses in
+// blocks of records that share a chrom1 contig. Contigs and pair types are
+// stored as ids into dictionaries, and each block stores its columns one after
+// another:
+//
+//	magic "PVZCACHE", version uint32, flags uint32, header lines
+//	blocks: uvarint byte length (0 ends the blocks), then
+//		contigs and pair types first seen in this block,
+//		uvarint record count, uvarint chrom1 contig,
+//		chrom2 contigs (uvarints), pos1 deltas (varints),
+//		pos2 - pos1 (varints), strands (bytes), pair types (uvarints),
+//		and optionally readIDs
+//	index: all contigs, all pair types, uvarint block count, then uvarint
+//		chrom1 contig, offset, and record count of each block
+//	trailer: uint64 index offset, magic "PVZINDEX"
+//
+// Lists of strings are a uvarint count followed by uvarint-length strings.
+// Contigs are resolved into chromosomes and parents when the cache is read,
+// so the parent flags work the same as for text .pairs files.
+
+const pairsCacheMagic = "PVZCACHE"
+const pairsCacheIndexMagic = "PVZINDEX"
+const pairsCacheVersion = 1
+const pairsCacheBlockSize = 65536
+
+// Cache flags
+const cacheHasReadIDs uint32 = 1
+
+var ErrCacheFormat = errors.New("Malformed pairs cache")
+
+// Strand codes, two bits per read
+const (
+	strandUnknown = 0
+	strandPlus = 1
+	strandMinus = 2
+)
+
+func strandCode(s string) byte {
+	switch s {
+	case "+": return strandPlus
+	case "-": return strandMinus
+	default:
+	}
+	return strandUnknown
+}
+
+func strandDir(code byte) int {
+	switch code {
+	case strandPlus: return 1
+	case strandMinus: return -1
+	default:
+	}
+	return 0
+}
+
+// Check if r starts with the pairs cache magic number, without consuming it
+func IsPairsCache(r *bufio.Reader) bool {
+	p, err := r.Peek(len(pairsCacheMagic))
+	return err == nil && string(p) == pairsCacheMagic
+}
+
+// The location of one block of a pairs cache
+type CacheBlock struct {
+	Offset int64
+	Count int64
+}
+
+// Assigns ids to strings in order of first appearance, remembering how many
+// have already been written
+type stringDict struct {
+	ids map[string]uint64
+	names []string
+	written int
+}
+
+func (d *stringDict) Id(s string) uint64 {
+	if d.ids == nil {
+		d.ids = map[string]uint64{}
+	}
+	id, ok := d.ids[s]
+	if !ok {
+		id = uint64(len(d.names))
+		d.ids[s] = id
+		d.names = append(d.names, s)
+	}
+	return id
+}
+
+// The strings added since the last call
+func (d *stringDict) New() []string {
+	names := d.names[d.written:]
+	d.written = len(d.names)
+	return names
+}
+
+// One .pairs record reduced to ids and positions
+type cacheRecord struct {
+	Chrom1 uint64
+	Chrom2 uint64
+	Pos1 int64
+	Pos2 int64
+	Strands byte
+	PairType uint64
+	ReadID string
+}
+
+// Writes a pairs cache one block at a time. Header must be set before the
+// first block is written.
+type CacheWriter struct {
+	w *bufio.Writer
+	offset int64
+	started bool
+	ReadIDs bool
+	Header []string
+	contigs stringDict
+	pairTypes stringDict
+	blockChroms []uint64
+	blocks []CacheBlock
+	block []cacheRecord
+}
+
+// Make a CacheWriter; the pair type dictionary reserves id 0 for lines
+// without a pair_type column
+func NewCacheWriter(w io.Writer, readIDs bool) *CacheWriter {
+	c := &CacheWriter{w: bufio.NewWriter(w), ReadIDs: readIDs}
+	c.pairTypes.Id("")
+	return c
+}
+
+// Add one parsed .pairs line, using cols to find its columns
+func (c *CacheWriter) AddLine(line []string, cols PairsColumns) error {
+	if len(line) < cols.MinLen() {
+		return fmt.Errorf("CacheWriter.AddLine: %d < %d columns: %w", len(line), cols.MinLen(), ErrShortLine)
+	}
+	var rec cacheRecord
+	var err error
+	if line[cols.Chrom1] != "!" {
+		if rec.Pos1, err = strconv.ParseInt(line[cols.Pos1], 10, 64); err != nil {
+			return fmt.Errorf("CacheWriter.AddLine: position %q: %w", line[cols.Pos1], err)
+		}
+	}
+	if line[cols.Chrom2] != "!" {
+		if rec.Pos2, err = strconv.ParseInt(line[cols.Pos2], 10, 64); err != nil {
+			return fmt.Errorf("CacheWriter.AddLine: position %q: %w", line[cols.Pos2], err)
+		}
+	}
+	rec.Chrom1 = c.contigs.Id(line[cols.Chrom1])
+	rec.Chrom2 = c.contigs.Id(line[cols.Chrom2])
+	rec.Strands = strandCode(line[cols.Strand1]) << 2 | strandCode(line[cols.Strand2])
+	if cols.PairType >= 0 && cols.PairType < len(line) {
+		rec.PairType = c.pairTypes.Id(line[cols.PairType])
+	}
+	if c.ReadIDs && cols.ReadID >= 0 && cols.ReadID < len(line) {
+		rec.ReadID = line[cols.ReadID]
+	}
+
+	if len(c.block) > 0 && (c.block[0].Chrom1 != rec.Chrom1 || len(c.block) >= pairsCacheBlockSize) {
+		if err = c.flushBlock(); err != nil {
+			return err
+		}
+	}
+	c.block = append(c.block, rec)
+	return nil
+}
+
+func putUvarint(b *bytes.Buffer, x uint64) {
+	var p [binary.MaxVarintLen64]byte
+	b.Write(p[:binary.PutUvarint(p[:], x)])
+}
+
+func putVarint(b *bytes.Buffer, x int64) {
+	var p [binary.MaxVarintLen64]byte
+	b.Write(p[:binary.PutVarint(p[:], x)])
+}
+
+func putString(b *bytes.Buffer, s string) {
+	putUvarint(b, uint64(len(s)))
+	b.WriteString(s)
+}
+
+func putStrings(b *bytes.Buffer, ss []string) {
+	putUvarint(b, uint64(len(ss)))
+	for _, s := range ss {
+		putString(b, s)
+	}
+}
+
+// Write encoded bytes to the output, keeping track of the offset
+func (c *CacheWriter) write(b *bytes.Buffer) error {
+	n, err := c.w.Write(b.Bytes())
+	c.offset += int64(n)
+	return err
+}
+
+// Write the magic number, version, flags, and header before the first block
+func (c *CacheWriter) start() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	var b bytes.Buffer
+	b.WriteString(pairsCacheMagic)
+	flags := uint32(0)
+	if c.ReadIDs {
+		flags |= cacheHasReadIDs
+	}
+	binary.Write(&b, binary.LittleEndian, uint32(pairsCacheVersion))
+	binary.Write(&b, binary.LittleEndian, flags)
+	putStrings(&b, c.Header)
+	return c.write(&b)
+}
+
+// Encode and write the current block column by column
+func (c *CacheWriter) flushBlock() error {
+	if len(c.block) == 0 {
+		return nil
+	}
+	if err := c.start(); err != nil {
+		return fmt.Errorf("CacheWriter: %w", err)
+	}
+	var b bytes.Buffer
+	putStrings(&b, c.contigs.New())
+	putStrings(&b, c.pairTypes.New())
+	putUvarint(&b, uint64(len(c.block)))
+	putUvarint(&b, c.block[0].Chrom1)
+	for _, rec := range c.block {
+		putUvarint(&b, rec.Chrom2)
+	}
+	prev := int64(0)
+	for _, rec := range c.block {
+		putVarint(&b, rec.Pos1 - prev)
+		prev = rec.Pos1
+	}
+	for _, rec := range c.block {
+		putVarint(&b, rec.Pos2 - rec.Pos1)
+	}
+	for _, rec := range c.block {
+		b.WriteByte(rec.Strands)
+	}
+	for _, rec := range c.block {
+		putUvarint(&b, rec.PairType)
+	}
+	if c.ReadIDs {
+		for _, rec := range c.block {
+			putString(&b, rec.ReadID)
+		}
+	}
+
+	var size bytes.Buffer
+	putUvarint(&size, uint64(b.Len()))
+	c.blockChroms = append(c.blockChroms, c.block[0].Chrom1)
+	c.blocks = append(c.blocks, CacheBlock{Offset: c.offset, Count: int64(len(c.block))})
+	c.block = c.block[:0]
+	if err := c.write(&size); err != nil {
+		return fmt.Errorf("CacheWriter: %w", err)
+	}
+	if err := c.write(&b); err != nil {
+		return fmt.Errorf("CacheWriter: %w", err)
+	}
+	return nil
+}
+
+// Write the last block, the index, and the trailer
+func (c *CacheWriter) Close() error {
+	h := func(e error) error {
+		return fmt.Errorf("CacheWriter.Close: %w", e)
+	}
+	if err := c.flushBlock(); err != nil {
+		return h(err)
+	}
+	if err := c.start(); err != nil {
+		return h(err)
+	}
+
+	var b bytes.Buffer
+	putUvarint(&b, 0)
+	indexOffset := c.offset + int64(b.Len())
+	putStrings(&b, c.contigs.names)
+	putStrings(&b, c.pairTypes.names)
+	putUvarint(&b, uint64(len(c.blocks)))
+	for i, block := range c.blocks {
+		putUvarint(&b, c.blockChroms[i])
+		putUvarint(&b, uint64(block.Offset))
+		putUvarint(&b, uint64(block.Count))
+	}
+	binary.Write(&b, binary.LittleEndian, uint64(indexOffset))
+	b.WriteString(pairsCacheIndexMagic)
+	if err := c.write(&b); err != nil {
+		return h(err)
+	}
+	if err := c.w.Flush(); err != nil {
+		return h(err)
+	}
+	return nil
+}
+
+// Convert a text .pairs file to a pairs cache. Malformed lines are handled by
+// rejecter and left out of the cache, so unlike with the text file, they are
+// not counted in the read totals.
+func ConvertPairs(r io.Reader, w io.Writer, readIDs bool, rejecter *Rejecter) error {
+	pr := NewPairsReader(r)
+	pr.Rejecter = rejecter
+	cw := NewCacheWriter(w, readIDs)
+	for pr.Scan() {
+		cw.Header = pr.Header
+		if err := cw.AddLine(pr.Line(), pr.Cols); err != nil {
+			pr.Reject(err)
+		}
+	}
+	if err := pr.Err(); err != nil {
+		return fmt.Errorf("ConvertPairs: %w", err)
+	}
+	cw.Header = pr.Header
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("ConvertPairs: %w", err)
+	}
+	return nil
+}
+
+// A resolved contig of the cache
+type cacheContig struct {
+	Chrom string
+	Parent string
+	Ok bool
+}
+
+// Reads a pairs cache as a PairScanner
+type CacheReader struct {
+	r *bufio.Reader
+	Header []string
+	Contigs []string
+	PairTypes []string
+	ReadIDs bool
+	Resolver parents.Resolver
+	types PairTypeSet
+	contigs []cacheContig
+	accepts []bool
+
+	// The current block, decoded into columns
+	chrom1 uint64
+	chrom2 []uint64
+	pos1 []int64
+	pos2 []int64
+	strands []byte
+	pairTypes []uint64
+	ids []string
+	i int
+
+	// Blocks left to read when reading part of the cache by seeking
+	rs io.ReadSeeker
+	pending []CacheBlock
+	seeking bool
+
+	err error
+}
+
+func readUvarint(r io.ByteReader) (uint64, error) {
+	x, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return x, err
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	p := make([]byte, n)
+	if _, err = io.ReadFull(r, p); err != nil {
+		return "", err
+	}
+	return string(p), nil
+}
+
+func readStrings(r *bufio.Reader) ([]string, error) {
+	n, err := readUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	ss := make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		s, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// Read the start of a pairs cache, leaving r at the first block
+func NewCacheReader(r *bufio.Reader, res parents.Resolver, types PairTypeSet) (*CacheReader, error) {
+	h := func(e error) error {
+		return fmt.Errorf("NewCacheReader: %w", e)
+	}
+	magic := make([]byte, len(pairsCacheMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, h(err)
+	}
+	if string(magic) != pairsCacheMagic {
+		return nil, h(ErrCacheFormat)
+	}
+	var version, flags uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, h(err)
+	}
+	if version != pairsCacheVersion {
+		return nil, h(fmt.Errorf("version %v: %w", version, ErrCacheFormat))
+	}
+	if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+		return nil, h(err)
+	}
+
+	c := &CacheReader{r: r, Resolver: res, types: types, ReadIDs: flags & cacheHasReadIDs != 0}
+	var err error
+	if c.Header, err = readStrings(r); err != nil {
+		return nil, h(err)
+	}
+	return c, nil
+}
+
+// Make a CacheReader that uses the contig naming scheme and pair types
+// specified in flags
+func NewCacheReaderFlags(flags Flags, r *bufio.Reader) (*CacheReader, error) {
+	res, err := flags.Resolver()
+	if err != nil {
+		return nil, err
+	}
+	return NewCacheReader(r, res, flags.AcceptTypes)
+}
+
+// Add contigs and pair types to the dictionaries
+func (c *CacheReader) addDicts(contigs, pairTypes []string) {
+	for _, contig := range contigs {
+		var cc cacheContig
+		cc.Ok = contig != "!"
+		if cc.Ok {
+			cc.Chrom, cc.Parent = c.Resolver.Resolve(contig)
+		}
+		c.Contigs = append(c.Contigs, contig)
+		c.contigs = append(c.contigs, cc)
+	}
+	for _, code := range pairTypes {
+		c.accepts = append(c.accepts, len(c.PairTypes) == 0 || c.types.Accepts(code))
+		c.PairTypes = append(c.PairTypes, code)
+	}
+}
+
+// The dictionaries and block locations stored at the end of a pairs cache
+type cacheIndex struct {
+	Contigs []string
+	PairTypes []string
+	Blocks map[string][]CacheBlock
+}
+
+func readCacheIndex(rs io.ReadSeeker) (index cacheIndex, err error) {
+	if _, err = rs.Seek(-int64(8 + len(pairsCacheIndexMagic)), io.SeekEnd); err != nil {
+		return index, err
+	}
+	trailer := make([]byte, 8 + len(pairsCacheIndexMagic))
+	if _, err = io.ReadFull(rs, trailer); err != nil {
+		return index, err
+	}
+	if string(trailer[8:]) != pairsCacheIndexMagic {
+		return index, ErrCacheFormat
+	}
+	if _, err = rs.Seek(int64(binary.LittleEndian.Uint64(trailer)), io.SeekStart); err != nil {
+		return index, err
+	}
+
+	br := bufio.NewReader(rs)
+	if index.Contigs, err = readStrings(br); err != nil {
+		return index, err
+	}
+	if index.PairTypes, err = readStrings(br); err != nil {
+		return index, err
+	}
+	n, err := readUvarint(br)
+	if err != nil {
+		return index, err
+	}
+	index.Blocks = map[string][]CacheBlock{}
+	for i := uint64(0); i < n; i++ {
+		var vals [3]uint64
+		for j, _ := range vals {
+			if vals[j], err = readUvarint(br); err != nil {
+				return index, err
+			}
+		}
+		if vals[0] >= uint64(len(index.Contigs)) {
+			return index, ErrCacheFormat
+		}
+		contig := index.Contigs[vals[0]]
+		index.Blocks[contig] = append(index.Blocks[contig], CacheBlock{Offset: int64(vals[1]), Count: int64(vals[2])})
+	}
+	return index, nil
+}
+
+// Read the locations of the blocks for each chrom1 contig from the index at
+// the end of a pairs cache
+func ReadCacheIndex(rs io.ReadSeeker) (map[string][]CacheBlock, error) {
+	index, err := readCacheIndex(rs)
+	if err != nil {
+		return nil, fmt.Errorf("ReadCacheIndex: %w", err)
+	}
+	return index.Blocks, nil
+}
+
+// Make a CacheReader that only reads the blocks whose chrom1 is one of
+// contigs, using the index at the end of the cache
+func NewCacheReaderContigs(rs io.ReadSeeker, res parents.Resolver, types PairTypeSet, contigs ...string) (*CacheReader, error) {
+	h := func(e error) error {
+		return fmt.Errorf("NewCacheReaderContigs: %w", e)
+	}
+	index, err := readCacheIndex(rs)
+	if err != nil {
+		return nil, h(err)
+	}
+	if _, err = rs.Seek(0, io.SeekStart); err != nil {
+		return nil, h(err)
+	}
+	c, err := NewCacheReader(bufio.NewReader(rs), res, types)
+	if err != nil {
+		return nil, h(err)
+	}
+	c.addDicts(index.Contigs, index.PairTypes)
+	c.rs = rs
+	c.seeking = true
+	for _, contig := range contigs {
+		c.pending = append(c.pending, index.Blocks[contig]...)
+	}
+	return c, nil
+}
+
+// Read and decode the next block; returns false at the end of the blocks
+func (c *CacheReader) nextBlock() (bool, error) {
+	if c.seeking {
+		if len(c.pending) == 0 {
+			return false, nil
+		}
+		if _, err := c.rs.Seek(c.pending[0].Offset, io.SeekStart); err != nil {
+			return false, err
+		}
+		c.r.Reset(c.rs)
+		c.pending = c.pending[1:]
+	}
+
+	size, err := readUvarint(c.r)
+	if err != nil || size == 0 {
+		return false, err
+	}
+	block := make([]byte, size)
+	if _, err = io.ReadFull(c.r, block); err != nil {
+		return false, err
+	}
+	br := bufio.NewReader(bytes.NewReader(block))
+
+	// The dictionaries are already complete when seeking
+	contigs, err := readStrings(br)
+	if err != nil {
+		return false, err
+	}
+	pairTypes, err := readStrings(br)
+	if err != nil {
+		return false, err
+	}
+	if !c.seeking {
+		c.addDicts(contigs, pairTypes)
+	}
+
+	n, err := readUvarint(br)
+	if err != nil {
+		return false, err
+	}
+	if c.chrom1, err = readUvarint(br); err != nil {
+		return false, err
+	}
+	c.chrom2 = c.chrom2[:0]
+	c.pos1 = c.pos1[:0]
+	c.pos2 = c.pos2[:0]
+	c.strands = c.strands[:0]
+	c.pairTypes = c.pairTypes[:0]
+	c.ids = c.ids[:0]
+	for i := uint64(0); i < n; i++ {
+		x, err := readUvarint(br)
+		if err != nil {
+			return false, err
+		}
+		c.chrom2 = append(c.chrom2, x)
+	}
+	prev := int64(0)
+	for i := uint64(0); i < n; i++ {
+		d, err := binary.ReadVarint(br)
+		if err != nil {
+			return false, err
+		}
+		prev += d
+		c.pos1 = append(c.pos1, prev)
+	}
+	for i := uint64(0); i < n; i++ {
+		d, err := binary.ReadVarint(br)
+		if err != nil {
+			return false, err
+		}
+		c.pos2 = append(c.pos2, c.pos1[i] + d)
+	}
+	for i := uint64(0); i < n; i++ {
+		s, err := br.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		c.strands = append(c.strands, s)
+	}
+	for i := uint64(0); i < n; i++ {
+		x, err := readUvarint(br)
+		if err != nil {
+			return false, err
+		}
+		c.pairTypes = append(c.pairTypes, x)
+	}
+	if c.ReadIDs {
+		for i := uint64(0); i < n; i++ {
+			s, err := readString(br)
+			if err != nil {
+				return false, err
+			}
+			c.ids = append(c.ids, s)
+		}
+	}
+
+	if c.chrom1 >= uint64(len(c.contigs)) {
+		return false, ErrCacheFormat
+	}
+	for i := uint64(0); i < n; i++ {
+		if c.chrom2[i] >= uint64(len(c.contigs)) || c.pairTypes[i] >= uint64(len(c.accepts)) {
+			return false, ErrCacheFormat
+		}
+	}
+	c.i = -1
+	return true, nil
+}
+
+// Advance to the next record
+func (c *CacheReader) Scan() bool {
+	if c.err != nil {
+		return false
+	}
+	c.i++
+	for c.i >= len(c.pos1) {
+		ok, err := c.nextBlock()
+		if err != nil {
+			c.err = fmt.Errorf("CacheReader.Scan: %w", err)
+		}
+		if !ok {
+			return false
+		}
+		c.i++
+	}
+	return true
+}
+
+// The current record as a read pair; records in the cache are always well
+// formed
+func (c *CacheReader) Pair() (pair Pair, ok bool) {
+	read := func(contig uint64, pos int64, strand byte) Read {
+		cc := c.contigs[contig]
+		if !cc.Ok {
+			return Read{}
+		}
+		return Read{Chrom: cc.Chrom, Parent: cc.Parent, Ok: true, Pos: pos, Dir: strandDir(strand)}
+	}
+	s := c.strands[c.i]
+	pair.Read1 = read(c.chrom1, c.pos1[c.i], s >> 2)
+	pair.Read2 = read(c.chrom2[c.i], c.pos2[c.i], s & 3)
+	return pair, true
+}
+
+// The read ID of the current record, or "" if the cache has none
+func (c *CacheReader) ReadID() string {
+	if !c.ReadIDs {
+		return ""
+	}
+	return c.ids[c.i]
+}
+
+// The pair type of the current record, or "" if the source had none
+func (c *CacheReader) PairType() string {
+	return c.PairTypes[c.pairTypes[c.i]]
+}
+
+func (c *CacheReader) Good() bool {
+	return c.contigs[c.chrom1].Ok && c.Accepted()
+}
+
+func (c *CacheReader) Accepted() bool {
+	return c.accepts[c.pairTypes[c.i]]
+}
+
+func (c *CacheReader) Err() error {
+	return c.err
+}
+
+func (c *CacheReader) ChromSizes() (map[string]int64, error) {
+	pr := PairsReader{Header: c.Header}
+	return pr.ChromSizes()
+}
+
+func (c *CacheReader) ContigResolver() parents.Resolver {
+	return c.Resolver
+}
+
+func FullConvertPairs() {
+	inpath := flag.String("i", "", "Input .pairs path (default stdin)")
+	outpath := flag.String("o", "", "Output cache path (required)")
+	noids := flag.Bool("noids", false, "Leave read IDs out of the cache")
+	bad := flag.String("bad", "fail", "What to do with malformed lines: fail, skip, or log (log writes them to stderr)")
+	flag.Parse()
+	if *outpath == "" {
+		fmt.Fprintln(os.Stderr, "missing -o")
+		os.Exit(2)
+	}
+	policy, e := ParseBadLinePolicy(*bad)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if *inpath != "" {
+		if r, e = OpenMaybeGz(*inpath); e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+	defer r.Close()
+
+	w, e := os.Create(*outpath)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	rejecter := NewRejecter(policy, os.Stderr)
+	e = ConvertPairs(r, w, !*noids, rejecter)
+	if ce := w.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	if skipped := rejecter.Skipped(); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d malformed lines\n", skipped)
+	}
+}
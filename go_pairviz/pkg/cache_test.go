@@ -0,0 +1,116 @@
+package pairviz
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
+)
+
+// Parallel test input plus unmapped pairs, rejected pair types, and a
+// second chromosome
+func makeCacheTestIn() string {
+	return makeParallelTestIn(3000) +
+		"u1\t!\t0\tX_W501\t7\t-\t+\tNU\n" +
+		"u2\t2L_ISO1\t40\t2L_W501\t90\t+\t+\tUU\n" +
+		"u3\tX_ISO1\t12\tX_ISO1\t90\t+\t-\tMM\n"
+}
+
+func convertTest(t *testing.T, in string, ids bool) []byte {
+	var buf bytes.Buffer
+	if e := ConvertPairs(strings.NewReader(in), &buf, ids, nil); e != nil {
+		t.Fatal(e)
+	}
+	return buf.Bytes()
+}
+
+func TestCacheWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 100
+	flags.WinStep = 25
+	flags.FullChroms = true
+	flags.Orient = true
+	in := makeCacheTestIn()
+	cache := convertTest(t, in, false)
+
+	text, e := WinStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	cached, e := WinStats(flags, bytes.NewReader(cache))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(text, cached) {
+		t.Errorf("cached window stats differ from text stats")
+	}
+
+	flags.Threads = 3
+	parallel, e := winStatsParallel(flags, bytes.NewReader(cache), 101)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(text, parallel) {
+		t.Errorf("parallel cached window stats differ from text stats")
+	}
+
+	ctext, e := ChromosomeStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	ccached, e := ChromosomeStats(flags, bytes.NewReader(cache))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(ctext, ccached) {
+		t.Errorf("cached chromosome stats differ from text stats")
+	}
+
+	bed := filepath.Join(t.TempDir(), "regions.bed")
+	if e := os.WriteFile(bed, []byte("X\t100\t900\nX\t2000\t2500\tpeak\n2L\t0\t50\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	flags.Region = bed
+	rtext, e := GetRegionStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	rcached, e := GetRegionStats(flags, bytes.NewReader(cache))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(rtext, rcached) {
+		t.Errorf("cached region stats differ from text stats")
+	}
+}
+
+func TestCacheIndex(t *testing.T) {
+	in := makeCacheTestIn()
+	cache := convertTest(t, in, true)
+
+	index, e := ReadCacheIndex(bytes.NewReader(cache))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(index["2L_ISO1"]) != 1 || index["2L_ISO1"][0].Count != 1 || len(index["!"]) != 1 {
+		t.Errorf("index wrong: %v", index)
+	}
+
+	c, e := NewCacheReaderContigs(bytes.NewReader(cache), parents.Default(), nil, "2L_ISO1", "!")
+	if e != nil {
+		t.Fatal(e)
+	}
+	var ids []string
+	for c.Scan() {
+		ids = append(ids, c.ReadID())
+	}
+	if e = c.Err(); e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(ids, ",") != "u2,u1" {
+		t.Errorf("read IDs %v != u2,u1", ids)
+	}
+}
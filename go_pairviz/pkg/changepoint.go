@@ -0,0 +1,323 @@
+package pairviz
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+var ErrBadChangePointMethod = errors.New("Unknown change-point method")
+
+// A change in paired proportion between two windows. Pos is the boundary
+// between the windows, and Lo and Hi bound the likelihood-based confidence
+// interval of the boundary. LeftProp and RightProp are the paired proportions
+// between this change and its neighbours, and LLR is the drop in cost from
+// splitting there.
+type ChangePoint struct {
+	Chrom string
+	Pos int64
+	Lo int64
+	Hi int64
+	LeftProp float64
+	RightProp float64
+	LLR float64
+}
+
+// Options for change-point detection. Method is "pelt" or "binseg". Each
+// change costs Penalty times the log of the number of windows. The binomial
+// cost is divided by Disp; if Disp is 0, it is the overlap of the sliding
+// windows, their size over their step, since each pair is counted in that
+// many windows. MaxCP limits the changes found by binary segmentation if it
+// is above 0.
+type ChangePointFlags struct {
+	WinCountsFlags
+	Method string
+	Penalty float64
+	Disp float64
+	MinWins int
+	MaxCP int
+	Level float64
+}
+
+// Cumulative paired and total hits of a chromosome's windows, for the
+// binomial cost of any run of windows
+type binomCost struct {
+	pair []float64
+	total []float64
+	disp float64
+}
+
+func newBinomCost(wins []WinCounts, disp float64) *binomCost {
+	c := &binomCost{make([]float64, len(wins) + 1), make([]float64, len(wins) + 1), disp}
+	for i, w := range wins {
+		c.pair[i + 1] = c.pair[i] + w.Pair
+		c.total[i + 1] = c.total[i] + w.Pair + w.Self
+	}
+	return c
+}
+
+// Twice the negative binomial log-likelihood of windows a to b-1 at their
+// own paired proportion, over the dispersion
+func (c *binomCost) cost(a, b int) float64 {
+	y := c.pair[b] - c.pair[a]
+	n := c.total[b] - c.total[a]
+	if n <= 0 {
+		return 0
+	}
+	return -2 * (xlogxy(y, n) + xlogxy(n - y, n)) / c.disp
+}
+
+func (c *binomCost) prop(a, b int) float64 {
+	return (c.pair[b] - c.pair[a]) / (c.total[b] - c.total[a])
+}
+
+// The size of sliding windows over their median step, at least 1
+func windowOverlap(wins []WinCounts) float64 {
+	if len(wins) < 2 {
+		return 1
+	}
+	steps := make([]int64, 0, len(wins) - 1)
+	for i := 1; i < len(wins); i++ {
+		steps = append(steps, wins[i].Start - wins[i - 1].Start)
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+	step := steps[len(steps) / 2]
+	if step <= 0 {
+		return 1
+	}
+	return math.Max(1, float64(wins[0].End - wins[0].Start) / float64(step))
+}
+
+// Optimal change-points by pruned exact linear time (PELT) search: the
+// indices of the first window after each change
+func peltChangePoints(c *binomCost, n int, beta float64, minwins int) []int {
+	f := make([]float64, n + 1)
+	last := make([]int, n + 1)
+	f[0] = -beta
+	cands := []int{}
+	for t := 1; t <= n; t++ {
+		if s := t - minwins; s == 0 || (s > 0 && !math.IsInf(f[s], 1)) {
+			cands = append(cands, s)
+		}
+		f[t] = math.Inf(1)
+		for _, s := range cands {
+			if v := f[s] + c.cost(s, t) + beta; v < f[t] {
+				f[t], last[t] = v, s
+			}
+		}
+		kept := cands[:0]
+		for _, s := range cands {
+			if f[s] + c.cost(s, t) <= f[t] {
+				kept = append(kept, s)
+			}
+		}
+		cands = kept
+	}
+
+	var cps []int
+	if math.IsInf(f[n], 1) {
+		return nil
+	}
+	for t := last[n]; t > 0; t = last[t] {
+		cps = append(cps, t)
+	}
+	sort.Ints(cps)
+	return cps
+}
+
+// The best split of windows a to b-1, and the drop in cost it gives
+func bestSplit(c *binomCost, a, b, minwins int) (int, float64) {
+	best, gain := -1, math.Inf(-1)
+	whole := c.cost(a, b)
+	for t := a + minwins; t <= b - minwins; t++ {
+		if g := whole - c.cost(a, t) - c.cost(t, b); g > gain {
+			best, gain = t, g
+		}
+	}
+	return best, gain
+}
+
+// Change-points by binary segmentation: repeatedly split the run of windows
+// whose best split drops the cost the most, while the drop is above beta
+func binsegChangePoints(c *binomCost, n int, beta float64, minwins, maxcp int) []int {
+	type run struct {
+		a, b, split int
+		gain float64
+	}
+	newRun := func(a, b int) run {
+		split, gain := bestSplit(c, a, b, minwins)
+		return run{a, b, split, gain}
+	}
+	runs := []run{newRun(0, n)}
+	var cps []int
+	for maxcp <= 0 || len(cps) < maxcp {
+		besti := -1
+		for i, r := range runs {
+			if r.split >= 0 && r.gain > beta && (besti < 0 || r.gain > runs[besti].gain) {
+				besti = i
+			}
+		}
+		if besti < 0 {
+			break
+		}
+		r := runs[besti]
+		cps = append(cps, r.split)
+		runs[besti] = newRun(r.a, r.split)
+		runs = append(runs, newRun(r.split, r.b))
+	}
+	sort.Ints(cps)
+	return cps
+}
+
+// Find the change-points of one chromosome
+func FindChangePoints(s WinSeries, flags ChangePointFlags) ([]ChangePoint, error) {
+	n := len(s.Wins)
+	if n < 2 {
+		return nil, nil
+	}
+	disp := flags.Disp
+	if disp <= 0 {
+		disp = windowOverlap(s.Wins)
+	}
+	c := newBinomCost(s.Wins, disp)
+	beta := flags.Penalty * math.Log(float64(n))
+	minwins := flags.MinWins
+	if minwins < 1 {
+		minwins = 1
+	}
+
+	var idx []int
+	switch flags.Method {
+	case "pelt": idx = peltChangePoints(c, n, beta, minwins)
+	case "binseg": idx = binsegChangePoints(c, n, beta, minwins, flags.MaxCP)
+	default:
+		return nil, fmt.Errorf("FindChangePoints: %q: %w", flags.Method, ErrBadChangePointMethod)
+	}
+
+	crit := distuv.ChiSquared{K: 1}.Quantile(flags.Level)
+	cps := make([]ChangePoint, 0, len(idx))
+	for k, t := range idx {
+		a, b := 0, n
+		if k > 0 {
+			a = idx[k - 1]
+		}
+		if k + 1 < len(idx) {
+			b = idx[k + 1]
+		}
+		split := c.cost(a, t) + c.cost(t, b)
+		lo, hi := t, t
+		for u := a + 1; u < b; u++ {
+			if c.cost(a, u) + c.cost(u, b) - split <= crit {
+				if u < lo {
+					lo = u
+				}
+				if u > hi {
+					hi = u
+				}
+			}
+		}
+		cp := ChangePoint{
+			Chrom: s.Chrom,
+			Pos: winBoundary(s.Wins[t - 1], s.Wins[t]),
+			Lo: winBoundary(s.Wins[lo - 1], s.Wins[lo]),
+			Hi: winBoundary(s.Wins[hi - 1], s.Wins[hi]),
+			LeftProp: c.prop(a, t),
+			RightProp: c.prop(t, b),
+			LLR: c.cost(a, b) - split,
+		}
+		if cp.Hi <= cp.Lo {
+			cp.Hi = cp.Lo + 1
+		}
+		cps = append(cps, cp)
+	}
+	return cps, nil
+}
+
+// Write change-points as BED6 plus four columns: chromosome, confidence
+// interval start and end, no name, the drop in cost capped at 1000 as the
+// score, no strand, then the position, paired proportions to the left and
+// right, and the drop in cost
+func WriteChangePointBed(w io.Writer, cps []ChangePoint) error {
+	for _, cp := range cps {
+		score := int(math.Min(1000, math.Round(cp.LLR)))
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t.\t%d\t.\t%d\t%.6g\t%.6g\t%.6g\n", cp.Chrom, cp.Lo, cp.Hi, score, cp.Pos, cp.LeftProp, cp.RightProp, cp.LLR); err != nil {
+			return fmt.Errorf("WriteChangePointBed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Find the change-points of every chromosome in pairviz window output
+func ChangePoints(r io.Reader, flags ChangePointFlags) ([]ChangePoint, error) {
+	series, err := ReadWinCounts(r, flags.WinCountsFlags)
+	if err != nil {
+		return nil, fmt.Errorf("ChangePoints: %w", err)
+	}
+	var cps []ChangePoint
+	for _, s := range series {
+		scps, err := FindChangePoints(s, flags)
+		if err != nil {
+			return nil, fmt.Errorf("ChangePoints: %w", err)
+		}
+		cps = append(cps, scps...)
+	}
+	return cps, nil
+}
+
+func FullChangePoint() {
+	var flags ChangePointFlags
+	inpath := flag.String("i", "", "Input path of pairviz window output, JSON or tab-separated (default stdin)")
+	outpath := flag.String("o", "", "Change-point BED output path (default stdout)")
+	flag.StringVar(&flags.Format, "f", "", "Input format, json or tsv (default: detected from the input)")
+	flag.StringVar(&flags.Name, "n", "", "Only use records with this Name")
+	flag.StringVar(&flags.Genome, "g", "", "Only use JSON records from this genome, keeping the original chromosome names")
+	flag.StringVar(&flags.Method, "method", "pelt", "Search method: pelt (exact) or binseg (binary segmentation)")
+	flag.Float64Var(&flags.Penalty, "pen", 2, "Penalty per change-point, times the log of the number of windows in the chromosome")
+	flag.Float64Var(&flags.Disp, "disp", 0, "Divide the binomial cost by this dispersion (default: window size over window step)")
+	flag.IntVar(&flags.MinWins, "minwins", 2, "Minimum number of windows between change-points")
+	flag.IntVar(&flags.MaxCP, "maxcp", 0, "With binseg, the maximum number of change-points per chromosome (default no limit)")
+	flag.Float64Var(&flags.Level, "level", 0.95, "Confidence level of the change-point intervals")
+	flag.Parse()
+
+	if flags.Method != "pelt" && flags.Method != "binseg" {
+		fmt.Fprintln(os.Stderr, ErrBadChangePointMethod)
+		os.Exit(2)
+	}
+	if flags.Level <= 0 || flags.Level >= 1 {
+		fmt.Fprintln(os.Stderr, ErrBadCILevel)
+		os.Exit(2)
+	}
+
+	h := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	var r io.ReadCloser = os.Stdin
+	var e error
+	if *inpath != "" {
+		r, e = OpenMaybeGz(*inpath)
+		h(e)
+	}
+	cps, e := ChangePoints(r, flags)
+	r.Close()
+	h(e)
+
+	out := os.Stdout
+	if *outpath != "" {
+		out, e = os.Create(*outpath)
+		h(e)
+	}
+	w := bufio.NewWriter(out)
+	h(WriteChangePointBed(w, cps))
+	h(w.Flush())
+	h(out.Close())
+}
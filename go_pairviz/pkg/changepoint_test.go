@@ -0,0 +1,60 @@
+package pairviz
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestChangePoints(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	s := WinSeries{"X", makeSegmentTestWins("X", 200, []int{0, 60, 140}, []float64{0.1, 0.6, 0.3}, rng)}
+	if o := windowOverlap(s.Wins); o != 2 {
+		t.Errorf("overlap %v != 2", o)
+	}
+
+	for _, method := range []string{"pelt", "binseg"} {
+		flags := ChangePointFlags{Method: method, Penalty: 2, MinWins: 2, Level: 0.95}
+		cps, e := FindChangePoints(s, flags)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(cps) != 2 {
+			t.Fatalf("%v: change-points %v", method, cps)
+		}
+		for i, want := range []int64{3025, 7025} {
+			cp := cps[i]
+			if cp.Lo > want || cp.Hi < want || cp.Hi - cp.Lo > 1000 {
+				t.Errorf("%v: interval (%v, %v) misses %v", method, cp.Lo, cp.Hi, want)
+			}
+			if !(cp.Lo <= cp.Pos && cp.Pos <= cp.Hi) || cp.LLR <= 0 {
+				t.Errorf("%v: bad change-point %v", method, cp)
+			}
+		}
+		if math.Abs(cps[0].LeftProp - 0.1) > 0.03 || math.Abs(cps[0].RightProp - 0.6) > 0.03 || math.Abs(cps[1].RightProp - 0.3) > 0.03 {
+			t.Errorf("%v: side levels %v", method, cps)
+		}
+	}
+
+	flags := ChangePointFlags{Method: "binseg", Penalty: 2, MinWins: 2, MaxCP: 1, Level: 0.95}
+	if cps, _ := FindChangePoints(s, flags); len(cps) != 1 || cps[0].LeftProp > 0.2 {
+		t.Errorf("binseg with one change-point gave %v", cps)
+	}
+
+	flat := WinSeries{"2L", makeSegmentTestWins("2L", 200, []int{0}, []float64{0.3}, rng)}
+	flags.Method = "pelt"
+	if cps, _ := FindChangePoints(flat, flags); len(cps) != 0 {
+		t.Errorf("change-points without changes: %v", cps)
+	}
+
+	var buf bytes.Buffer
+	cps, _ := FindChangePoints(s, ChangePointFlags{Method: "pelt", Penalty: 2, MinWins: 2, Level: 0.95})
+	if e := WriteChangePointBed(&buf, cps); e != nil {
+		t.Fatal(e)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || len(strings.Split(lines[0], "\t")) != 10 || strings.Split(lines[0], "\t")[5] != "." {
+		t.Errorf("bad BED output:\n%v", buf.String())
+	}
+}
@@ -1,73 +1,276 @@
 package pairviz
 
 import (
-	"github.com/jgbaldwinbrown/fasttsv"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 )
 
-// Statistics for all chromosomes
+// Statistics for all chromosomes. Like windows, each read of a pair adds a
+// hit to the chromosome it falls on, so the chromosome counts equal the sums
+// over non-overlapping windows.
 type ChromStats struct {
-	SelfHits map[string]int64
-	PairHits map[string]int64
-	TotalBadReads int64
-	TotalGoodReads int64
-	TotalChromosomeReads int64
+	Hits map[string]*HitSet
+	GenomeHits map[string]map[string]*HitSet
+	Lens map[string]int64
+	GenomeLens map[string]map[string]int64
+	ReadTotals
+	Fpkm bool
+	Trans bool
+	Orient bool
+	CI PropCI
+	Name string
 }
 
 func MakeChromStats() (stats ChromStats) {
-	stats.SelfHits = make(map[string]int64)
-	stats.PairHits = make(map[string]int64)
+	stats.Hits = make(map[string]*HitSet)
+	stats.GenomeHits = make(map[string]map[string]*HitSet)
+	stats.Lens = make(map[string]int64)
+	stats.GenomeLens = make(map[string]map[string]int64)
 	return
 }
 
-func ChromosomeStats(f Flags, r io.Reader) (stats ChromStats) {
-	stats = MakeChromStats()
-	s := fasttsv.NewScanner(r)
-	for s.Scan() {
-		if IsAPair(s.Line()) {
-			stats.TotalChromosomeReads++
+// Get the hits for a chromosome, creating them if necessary
+func chromHitSet(hits map[string]*HitSet, chrom string) *HitSet {
+	if _, ok := hits[chrom]; !ok {
+		hits[chrom] = new(HitSet)
+	}
+	return hits[chrom]
+}
+
+// Get the hits for a chromosome in one genome, creating them if necessary
+func (stats *ChromStats) Genome(genome, chrom string) *HitSet {
+	if _, ok := stats.GenomeHits[genome]; !ok {
+		stats.GenomeHits[genome] = make(map[string]*HitSet)
+	}
+	return chromHitSet(stats.GenomeHits[genome], chrom)
+}
+
+// Get the chromosome lengths for one genome, creating them if necessary
+func (stats *ChromStats) GenomeLen(genome string) map[string]int64 {
+	if _, ok := stats.GenomeLens[genome]; !ok {
+		stats.GenomeLens[genome] = make(map[string]int64)
+	}
+	return stats.GenomeLens[genome]
+}
+
+// Keep the longest length seen for a chromosome
+func setMaxLen(lens map[string]int64, chrom string, chromlen int64) {
+	if old, ok := lens[chrom]; !ok || chromlen > old {
+		lens[chrom] = chromlen
+	}
+}
+
+// Add one hit for a read
+func (stats *ChromStats) AddHit(read Read, hit_type HitType) {
+	chromHitSet(stats.Hits, read.Chrom).Inc(hit_type)
+	stats.Genome(read.Parent, read.Chrom).Inc(hit_type)
+}
+
+// Add the hits for both reads of a pair, and record the positions seen
+func (stats *ChromStats) AddPair(flags Flags, pair Pair) {
+	hit_type := P
+	if pair.Read1.Parent == pair.Read2.Parent {
+		hit_type = S
+	}
+	trans := IsTrans(pair)
+	if trans {
+		hit_type = TransHitType(pair)
+	}
+	facing_type, facing_ok := FacingHitType(pair)
+	for _, read := range []Read{pair.Read1, pair.Read2} {
+		stats.AddHit(read, hit_type)
+		if flags.Orient && facing_ok && !trans {
+			stats.AddHit(read, facing_type)
 		}
-		if CheckGood(s.Line()) {
-			stats.TotalGoodReads++
+		if flags.ReadLen != -1 && !trans {
+			if PairOverlaps(pair, flags.ReadLen) {
+				stats.AddHit(read, Ovl)
+			} else {
+				stats.AddHit(read, NonOvl)
+			}
 		}
+		setMaxLen(stats.Lens, read.Chrom, read.Pos + 1)
+		setMaxLen(stats.GenomeLen(read.Parent), read.Chrom, read.Pos + 1)
+	}
+}
 
-		pair, ok := ParsePair(s.Line())
-		if !ok { continue }
-		if RangeBad(f.Distance, f.MinDistance, f.PairMinDistance, f.SelfInMinDistance, pair) { continue }
+// Set chromosome lengths from the #chromsize: headers and the -chrlens file,
+// replacing the lengths inferred from the last read on each chromosome, then
+// calculate fpkm. Chromosomes with a known length but no hits are only added
+// if -full or -chrlens was specified.
+func (stats *ChromStats) Finish(flags Flags, pr PairScanner) error {
+	stats.TotalBadReads = stats.TotalReads - stats.TotalGoodReads
 
-		if pair.Read1.Parent == pair.Read2.Parent {
-			if _, inmap := stats.SelfHits[pair.Read1.Chrom]; !inmap {
-				stats.SelfHits[pair.Read1.Chrom] = 0
+	sizes, err := pr.ChromSizes()
+	if err != nil {
+		return fmt.Errorf("ChromStats.Finish: %w", err)
+	}
+	lens := map[string]int64{}
+	glens := map[string]map[string]int64{}
+	for contig, size := range sizes {
+		chrom, parent := pr.ContigResolver().Resolve(contig)
+		setMaxLen(lens, chrom, size)
+		if _, ok := glens[parent]; !ok {
+			glens[parent] = map[string]int64{}
+		}
+		setMaxLen(glens[parent], chrom, size)
+	}
+	if flags.ChromLens != "" {
+		flens, err := ReadChromLens(flags.ChromLens)
+		if err != nil {
+			return fmt.Errorf("ChromStats.Finish: %w", err)
+		}
+		for chrom, size := range flens {
+			lens[chrom] = size
+		}
+	}
+
+	for chrom, size := range lens {
+		stats.Lens[chrom] = size
+	}
+	for genome, gl := range stats.GenomeLens {
+		for chrom, _ := range gl {
+			if size, ok := glens[genome][chrom]; ok {
+				gl[chrom] = size
+			} else if size, ok := lens[chrom]; ok {
+				gl[chrom] = size
 			}
-			stats.SelfHits[pair.Read1.Chrom]++
-		} else {
-			if _, inmap := stats.PairHits[pair.Read1.Chrom]; !inmap {
-				stats.PairHits[pair.Read1.Chrom] = 0
+		}
+	}
+	if flags.FullChroms || flags.ChromLens != "" {
+		for chrom, _ := range lens {
+			chromHitSet(stats.Hits, chrom)
+		}
+		for genome, gl := range glens {
+			for chrom, size := range gl {
+				stats.Genome(genome, chrom)
+				stats.GenomeLen(genome)[chrom] = size
 			}
-			stats.PairHits[pair.Read1.Chrom]++
 		}
 	}
-	stats.TotalBadReads = stats.TotalChromosomeReads - stats.TotalGoodReads
-	return
+
+	if !flags.NoFpkm {
+		stats.Fpkm = true
+		for chrom, hits := range stats.Hits {
+			hits.SetFpkm(stats.TotalReads, stats.Lens[chrom])
+		}
+		for genome, ghits := range stats.GenomeHits {
+			for chrom, hits := range ghits {
+				hits.SetFpkm(stats.TotalReads, stats.GenomeLens[genome][chrom])
+			}
+		}
+	}
+	return nil
 }
 
-// Write all chromosome stats
-func FprintChromStats(w io.Writer, stats ChromStats) {
-	for k, v := range stats.SelfHits {
-		fmt.Fprintf(w, "Self\t%s\t%d\n", k, v)
+func ChromosomeStats(f Flags, r io.Reader) (stats ChromStats, err error) {
+	stats = MakeChromStats()
+	stats.Name = f.Name
+	stats.Trans = f.Trans
+	stats.Orient = f.Orient
+	stats.CI = NewPropCI(f)
+	pr, err := NewPairScanner(f, r)
+	if err != nil {
+		return stats, fmt.Errorf("ChromosomeStats: %w", err)
 	}
-	for k, v := range stats.PairHits {
-		fmt.Fprintf(w, "Pair\t%s\t%d\n", k, v)
+	for pr.Scan() {
+		stats.TotalReads++
+		if pr.Good() {
+			stats.TotalGoodReads++
+		}
+		if !pr.Accepted() { continue }
+
+		pair, ok := pr.Pair()
+		if !ok { continue }
+		if f.Trans && IsTrans(pair) {
+			stats.AddPair(f, pair)
+			continue
+		}
+		if RangeBad(f.Distance, f.MinDistance, f.PairMinDistance, f.SelfInMinDistance, pair) { continue }
+		stats.AddPair(f, pair)
+	}
+	if err = pr.Err(); err != nil {
+		return stats, fmt.Errorf("ChromosomeStats: %w", err)
 	}
-	for k, v := range stats.PairHits {
-		fmt.Fprintf(w, "Pair propotion:\t%s\t%d\n", k, (v / (v + stats.SelfHits[k])))
+	if err = stats.Finish(f, pr); err != nil {
+		return stats, fmt.Errorf("ChromosomeStats: %w", err)
+	}
+	return
+}
+
+// The keys of a map in sorted order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k, _ := range m {
+		keys = append(keys, k)
 	}
-	for k, v := range stats.PairHits {
-		fmt.Fprintf(w, "Pair propotion of total good reads:\t%s\t%d\n", k, (v / stats.TotalGoodReads))
+	sort.Strings(keys)
+	return keys
+}
+
+// Write all chromosome stats in the requested format
+func FprintChromStats(w io.Writer, stats ChromStats, separategenomes bool, readlen int64, jsonOut bool) error {
+	if jsonOut {
+		return FprintChromStatsJson(w, stats)
 	}
-	for k, v := range stats.PairHits {
-		fmt.Fprintf(w, "Pair propotion of total reads:\t%s\t%d\n", k, (v / (stats.TotalGoodReads + stats.TotalBadReads)))
+	FprintChromStatsPlain(w, stats, separategenomes, readlen)
+	return nil
+}
+
+// Write the stats for each chromosome of each genome as JSON, in sorted order
+func FprintChromStatsJson(w io.Writer, stats ChromStats) error {
+	enc := json.NewEncoder(w)
+	for _, genome := range sortedKeys(stats.GenomeHits) {
+		ghits := stats.GenomeHits[genome]
+		for _, chrom := range sortedKeys(ghits) {
+			chromlen := stats.GenomeLens[genome][chrom]
+			j := MakeJsonOutStat(genome, chrom, stats.Name, stats.ReadTotals, 0, chromlen, chromlen, chromlen, *ghits[chrom])
+			if stats.Trans {
+				j.AddTrans(*ghits[chrom])
+			}
+			if stats.Orient {
+				j.AddFacing(*ghits[chrom])
+			}
+			if len(stats.CI.Methods) > 0 {
+				j.AddCI(*ghits[chrom], stats.CI)
+			}
+			if err := enc.Encode(j); err != nil {
+				return fmt.Errorf("FprintChromStatsJson: %w", err)
+			}
+		}
 	}
+	return nil
 }
 
+// Write all chromosome stats as tab-separated text with the same columns as
+// the window output, optionally with one row per genome
+func FprintChromStatsPlain(w io.Writer, stats ChromStats, separategenomes bool, readlen int64) {
+	cols := StatCols{Fpkm: stats.Fpkm, ReadLen: readlen, Trans: stats.Trans, Orient: stats.Orient, CI: stats.CI}
+	FprintHeaderCols(w, cols, stats.Name != "", nil)
+	name_format_string := "\t%s"
+	fprintRow := func(chrom string, chromlen int64, win HitSet) {
+		FprintStatsRow(w, chrom, 0, chromlen, chromlen, chromlen, win, stats.ReadTotals, cols)
+		if stats.Name != "" {
+			fmt.Fprintf(w,
+				name_format_string,
+				stats.Name,
+			)
+		}
+		fmt.Fprintln(w, "")
+	}
+
+	if !separategenomes {
+		for _, chrom := range sortedKeys(stats.Hits) {
+			fprintRow(chrom, stats.Lens[chrom], *stats.Hits[chrom])
+		}
+		return
+	}
+	for _, genome := range sortedKeys(stats.GenomeHits) {
+		ghits := stats.GenomeHits[genome]
+		for _, chrom := range sortedKeys(ghits) {
+			fprintRow(fmt.Sprintf("%s_%s", chrom, genome), stats.GenomeLens[genome][chrom], *ghits[chrom])
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package pairviz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChromosomeStats(t *testing.T) {
+	flags := gFlags
+	flags.ReadLen = -1
+	flags.FullChroms = true
+
+	stats, e := ChromosomeStats(flags, strings.NewReader(gChromSizeIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+	x := stats.Hits["X"]
+	if x == nil || x.PairHits != 2 || x.SelfHits != 2 {
+		t.Fatalf("X hits %v wrong", x)
+	}
+	if stats.Lens["X"] != 25 || stats.GenomeLens["W501"]["X"] != 22 {
+		t.Errorf("lengths %v, %v wrong", stats.Lens, stats.GenomeLens)
+	}
+	if _, ok := stats.Hits["4"]; !ok {
+		t.Errorf("empty chromosome 4 missing")
+	}
+
+	var buf bytes.Buffer
+	FprintChromStatsPlain(&buf, stats, false, -1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "4\t0\t11\t") || !strings.HasPrefix(lines[2], "X\t0\t25\tpaired\tself\t2\t2\t0.5\t0.5\t") {
+		t.Errorf("chromosome output wrong:\n%v", buf.String())
+	}
+}
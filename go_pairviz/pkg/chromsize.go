@@ -0,0 +1,134 @@
+package pairviz
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+)
+
+// Parse the contig lengths from the "#chromsize: contig length" header lines
+func (p *PairsReader) ChromSizes() (map[string]int64, error) {
+	sizes := map[string]int64{}
+	for _, line := range p.Header {
+		if !strings.HasPrefix(line, "#chromsize:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "#chromsize:"))
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("ChromSizes: header %q too short", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ChromSizes: header %q: %w", line, err)
+		}
+		sizes[fields[0]] = size
+	}
+	return sizes, nil
+}
+
+// Read chromosome lengths from a file in either bed format (chrom, 0, length)
+// or two-column format (chrom, length)
+func ReadChromLens(path string) (map[string]int64, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadChromLens: %w", err)
+	}
+	defer r.Close()
+
+	lens := map[string]int64{}
+	s := fasttsv.NewScanner(r)
+	for s.Scan() {
+		line := s.Line()
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+		lencol := 2
+		if len(line) < 3 {
+			lencol = 1
+		}
+		if len(line) <= lencol {
+			return nil, fmt.Errorf("ReadChromLens: line %v too short", line)
+		}
+		size, err := strconv.ParseInt(line[lencol], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ReadChromLens: line %v: %w", line, err)
+		}
+		lens[line[0]] = size
+	}
+	return lens, nil
+}
+
+// The number of windows whose start falls before the end of a chromosome of length chromlen
+func (h *Hits) NumWins(chromlen int64) int64 {
+	return (chromlen + h.WinStep - 1) / h.WinStep
+}
+
+// Record the length of a chromosome, keeping the longest length if it is set more than once
+func (h *Hits) SetChromLen(chrom string, chromlen int64) {
+	if old, ok := h.ChromLens[chrom]; !ok || chromlen > old {
+		h.ChromLens[chrom] = chromlen
+	}
+}
+
+// Extend every chromosome with a known length to its full number of windows,
+// adding empty chromosomes as needed
+func (h *Hits) Fill() {
+	for chrom, chromlen := range h.ChromLens {
+		if _, ok := h.Hits[chrom]; !ok {
+			h.Hits[chrom] = new(WinHitList)
+		}
+		nwins := h.NumWins(chromlen)
+		for int64(len(*h.Hits[chrom])) < nwins {
+			*h.Hits[chrom] = append(*h.Hits[chrom], HitSet{})
+		}
+	}
+}
+
+// Get the Hits for a genome, creating it if necessary
+func (g *GenomeHits) Genome(genome string) *Hits {
+	if _, ok := g.Ghits[genome]; !ok {
+		h := new(Hits)
+		h.Init(g.WinSize, g.WinStep)
+		g.Ghits[genome] = h
+	}
+	return g.Ghits[genome]
+}
+
+// Set chromosome lengths from the #chromsize: headers and the -chrlens file,
+// then extend all chromosomes to their full lengths. Lengths from the
+// -chrlens file are per chromosome, so they apply to that chromosome of every
+// genome in the input, unless the headers already sized it.
+func (stats *AllWinStats) FillChroms(flags Flags, pr PairScanner) error {
+	sizes, err := pr.ChromSizes()
+	if err != nil {
+		return fmt.Errorf("FillChroms: %w", err)
+	}
+	for contig, size := range sizes {
+		chrom, parent := pr.ContigResolver().Resolve(contig)
+		stats.Hits.SetChromLen(chrom, size)
+		stats.GenomeHits.Genome(parent).SetChromLen(chrom, size)
+	}
+
+	if flags.ChromLens != "" {
+		lens, err := ReadChromLens(flags.ChromLens)
+		if err != nil {
+			return fmt.Errorf("FillChroms: %w", err)
+		}
+		for chrom, size := range lens {
+			stats.Hits.ChromLens[chrom] = size
+			for _, ghits := range stats.GenomeHits.Ghits {
+				if _, sized := ghits.ChromLens[chrom]; !sized {
+					ghits.ChromLens[chrom] = size
+				}
+			}
+		}
+	}
+
+	stats.Hits.Fill()
+	for _, ghits := range stats.GenomeHits.Ghits {
+		ghits.Fill()
+	}
+	return nil
+}
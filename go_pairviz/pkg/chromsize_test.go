@@ -0,0 +1,85 @@
+package pairviz
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const gChromSizeIn = `## pairs format v1.0.0
+#chromsize: X_ISO1 25
+#chromsize: X_W501 22
+#chromsize: 4_ISO1 9
+#chromsize: 4_W501 11
+#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_W501	3	+	-	UU
+r2	X_ISO1	2	X_ISO1	4	+	-	UU
+`
+
+func TestFillChroms(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 5
+	flags.FullChroms = true
+	flags.ReadLen = -1
+
+	stats, e := WinStats(flags, strings.NewReader(gChromSizeIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	x := *stats.Hits.Hits["X"]
+	if len(x) != 5 {
+		t.Errorf("len(X windows) %v != 5", len(x))
+	}
+	if start, end := stats.Hits.WinSpan("X", 4); start != 20 || end != 25 {
+		t.Errorf("last X window (%v, %v) != (20, 25)", start, end)
+	}
+	four, ok := stats.Hits.Hits["4"]
+	if !ok || len(*four) != 3 {
+		t.Fatalf("chromosome 4 missing or wrong length: %v", four)
+	}
+	j := MakeJsonOutStat("", "4", "", stats.ReadTotals, 10, 11, 10, 5, (*four)[2])
+	if j.TargetHits != 0 || !math.IsNaN(float64(j.TargetProp)) {
+		t.Errorf("empty window stats wrong: %v", j)
+	}
+
+	w501 := stats.GenomeHits.Ghits["W501"]
+	if len(*w501.Hits["X"]) != 5 || len(*w501.Hits["4"]) != 3 {
+		t.Errorf("W501 windows wrong: X %v; 4 %v", *w501.Hits["X"], *w501.Hits["4"])
+	}
+	if _, end := w501.WinSpan("X", 4); end != 22 {
+		t.Errorf("W501 last X window end %v != 22", end)
+	}
+}
+
+func TestFillChromsLensFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chrlens.bed")
+	if e := os.WriteFile(path, []byte("X\t0\t25\n4\t0\t9\nY\t0\t12\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 5
+	flags.ChromLens = path
+	flags.ReadLen = -1
+
+	in := "r1\tX_ISO1\t1\tX_W501\t3\t+\t-\tUU\nr2\t4_ISO1\t2\t4_ISO1\t4\t+\t-\tUU\n"
+	stats, e := WinStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, genome := range []string{"ISO1", "W501"} {
+		ghits := stats.GenomeHits.Ghits[genome]
+		for chrom, nwins := range map[string]int{"X": 5, "4": 2, "Y": 3} {
+			if wins, ok := ghits.Hits[chrom]; !ok || len(*wins) != nwins {
+				t.Errorf("%v %v windows missing or wrong length: %v", genome, chrom, wins)
+			}
+		}
+	}
+	if _, end := stats.GenomeHits.Ghits["W501"].WinSpan("4", 1); end != 9 {
+		t.Errorf("W501 last 4 window end %v != 9", end)
+	}
+}
@@ -0,0 +1,207 @@
+package pairviz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+var ErrBadCIMethod = errors.New("Unknown confidence interval method")
+var ErrBadCILevel = errors.New("Confidence level must be between 0 and 1")
+
+// A method for calculating binomial confidence intervals
+type CIMethod int
+
+const (
+	WilsonCI CIMethod = iota
+	JeffreysCI
+	ExactCI
+)
+
+func (m CIMethod) String() string {
+	switch m {
+	case WilsonCI: return "wilson"
+	case JeffreysCI: return "jeffreys"
+	case ExactCI: return "exact"
+	default:
+	}
+	return "unknown"
+}
+
+// Parse a comma-separated list of interval methods: wilson, jeffreys, and
+// exact (Clopper-Pearson). An empty string or "none" selects no intervals.
+func ParseCIMethods(s string) ([]CIMethod, error) {
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+	var methods []CIMethod
+	for _, name := range strings.Split(s, ",") {
+		switch name {
+		case "wilson": methods = append(methods, WilsonCI)
+		case "jeffreys": methods = append(methods, JeffreysCI)
+		case "exact": methods = append(methods, ExactCI)
+		default:
+			return nil, fmt.Errorf("ParseCIMethods: %q: %w", name, ErrBadCIMethod)
+		}
+	}
+	return methods, nil
+}
+
+// The confidence intervals to report for the paired and overlapping
+// proportions
+type PropCI struct {
+	Methods []CIMethod
+	Level float64
+}
+
+// Make the intervals requested by flags
+func NewPropCI(flags Flags) PropCI {
+	return PropCI{Methods: flags.CIMethods, Level: flags.CILevel}
+}
+
+// The Wilson score interval for x successes in n trials
+func WilsonInterval(x, n int64, level float64) (lo, hi float64) {
+	if n <= 0 {
+		return math.NaN(), math.NaN()
+	}
+	z := distuv.UnitNormal.Quantile(1 - (1 - level) / 2)
+	fx, fn, z2 := float64(x), float64(n), z * z
+	center := (fx + z2 / 2) / (fn + z2)
+	half := z / (fn + z2) * math.Sqrt(fx * (fn - fx) / fn + z2 / 4)
+	lo, hi = center - half, center + half
+	if x == 0 {
+		lo = 0
+	}
+	if x == n {
+		hi = 1
+	}
+	return lo, hi
+}
+
+// The equal-tailed Jeffreys interval, the quantiles of Beta(x + 1/2,
+// n - x + 1/2), with the lower bound 0 when x is 0 and the upper bound 1
+// when x is n
+func JeffreysInterval(x, n int64, level float64) (lo, hi float64) {
+	if n <= 0 {
+		return math.NaN(), math.NaN()
+	}
+	alpha := 1 - level
+	b := distuv.Beta{Alpha: float64(x) + 0.5, Beta: float64(n - x) + 0.5}
+	lo, hi = 0, 1
+	if x > 0 {
+		lo = b.Quantile(alpha / 2)
+	}
+	if x < n {
+		hi = b.Quantile(1 - alpha / 2)
+	}
+	return lo, hi
+}
+
+// The exact Clopper-Pearson interval
+func ExactInterval(x, n int64, level float64) (lo, hi float64) {
+	if n <= 0 {
+		return math.NaN(), math.NaN()
+	}
+	alpha := 1 - level
+	lo, hi = 0, 1
+	if x > 0 {
+		lo = distuv.Beta{Alpha: float64(x), Beta: float64(n - x + 1)}.Quantile(alpha / 2)
+	}
+	if x < n {
+		hi = distuv.Beta{Alpha: float64(x + 1), Beta: float64(n - x)}.Quantile(1 - alpha / 2)
+	}
+	return lo, hi
+}
+
+// The interval for x successes in n trials by method m
+func BinomInterval(m CIMethod, x, n int64, level float64) (lo, hi float64) {
+	switch m {
+	case JeffreysCI: return JeffreysInterval(x, n, level)
+	case ExactCI: return ExactInterval(x, n, level)
+	default:
+	}
+	return WilsonInterval(x, n, level)
+}
+
+// Confidence intervals on TargetProp and AltOvlProp, only included in JSON
+// output when requested; each method's group is nil unless it was requested
+type PropCIJsonStat struct {
+	CILevel JsonFloat
+	*WilsonJsonStat
+	*JeffreysJsonStat
+	*ExactJsonStat
+}
+
+type WilsonJsonStat struct {
+	TargetPropWilsonLo JsonFloat
+	TargetPropWilsonHi JsonFloat
+	AltOvlPropWilsonLo JsonFloat
+	AltOvlPropWilsonHi JsonFloat
+}
+
+type JeffreysJsonStat struct {
+	TargetPropJeffreysLo JsonFloat
+	TargetPropJeffreysHi JsonFloat
+	AltOvlPropJeffreysLo JsonFloat
+	AltOvlPropJeffreysHi JsonFloat
+}
+
+type ExactJsonStat struct {
+	TargetPropExactLo JsonFloat
+	TargetPropExactHi JsonFloat
+	AltOvlPropExactLo JsonFloat
+	AltOvlPropExactHi JsonFloat
+}
+
+// The intervals of the paired proportion and the overlapping proportion of
+// self hits in win
+func (ci PropCI) intervals(m CIMethod, win HitSet) (plo, phi, olo, ohi float64) {
+	plo, phi = BinomInterval(m, win.PairHits, win.PairHits + win.SelfHits, ci.Level)
+	olo, ohi = BinomInterval(m, win.OvlHits, win.OvlHits + win.NonOvlHits, ci.Level)
+	return
+}
+
+// Add the requested confidence intervals for win to j
+func (j *JsonOutStat) AddCI(win HitSet, ci PropCI) {
+	s := &PropCIJsonStat{CILevel: JsonFloat(ci.Level)}
+	for _, m := range ci.Methods {
+		plo, phi, olo, ohi := ci.intervals(m, win)
+		switch m {
+		case WilsonCI:
+			s.WilsonJsonStat = &WilsonJsonStat{JsonFloat(plo), JsonFloat(phi), JsonFloat(olo), JsonFloat(ohi)}
+		case JeffreysCI:
+			s.JeffreysJsonStat = &JeffreysJsonStat{JsonFloat(plo), JsonFloat(phi), JsonFloat(olo), JsonFloat(ohi)}
+		case ExactCI:
+			s.ExactJsonStat = &ExactJsonStat{JsonFloat(plo), JsonFloat(phi), JsonFloat(olo), JsonFloat(ohi)}
+		default:
+		}
+	}
+	j.PropCIJsonStat = s
+}
+
+// The header columns of the requested intervals; overlap intervals are only
+// included with a read length
+func (ci PropCI) HeaderCols(readlen int64) string {
+	var b strings.Builder
+	for _, m := range ci.Methods {
+		fmt.Fprintf(&b, "\tpair_prop_%v_lo\tpair_prop_%v_hi", m, m)
+		if readlen != -1 {
+			fmt.Fprintf(&b, "\tovl_prop_%v_lo\tovl_prop_%v_hi", m, m)
+		}
+	}
+	return b.String()
+}
+
+// Write the requested interval columns for one window
+func FprintCICols(w io.Writer, win HitSet, ci PropCI, readlen int64) {
+	for _, m := range ci.Methods {
+		plo, phi, olo, ohi := ci.intervals(m, win)
+		fmt.Fprintf(w, "\t%.8g\t%.8g", plo, phi)
+		if readlen != -1 {
+			fmt.Fprintf(w, "\t%.8g\t%.8g", olo, ohi)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package pairviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBinomIntervals(t *testing.T) {
+	near := func(x, y float64) bool {
+		return math.Abs(x - y) < 1e-4
+	}
+	cases := []struct {
+		m CIMethod
+		x, n int64
+		lo, hi float64
+	} {
+		{WilsonCI, 5, 10, 0.23659, 0.76341},
+		{WilsonCI, 0, 10, 0, 0.27753},
+		{ExactCI, 5, 10, 0.18709, 0.81291},
+		{ExactCI, 0, 10, 0, 1 - math.Pow(0.025, 0.1)},
+		{ExactCI, 10, 10, math.Pow(0.025, 0.1), 1},
+		{JeffreysCI, 0, 10, 0, 0.21718},
+	}
+	for _, c := range cases {
+		lo, hi := BinomInterval(c.m, c.x, c.n, 0.95)
+		if !near(lo, c.lo) || !near(hi, c.hi) {
+			t.Errorf("%v %v/%v: (%v, %v) != (%v, %v)", c.m, c.x, c.n, lo, hi, c.lo, c.hi)
+		}
+	}
+
+	lo, hi := JeffreysInterval(5, 10, 0.95)
+	if !near(lo + hi, 1) || lo < 0.18709 || hi > 0.81291 {
+		t.Errorf("Jeffreys interval (%v, %v) not symmetric or wider than exact", lo, hi)
+	}
+	lo90, hi90 := JeffreysInterval(5, 10, 0.9)
+	if lo90 <= lo || hi90 >= hi {
+		t.Errorf("90%% interval (%v, %v) not inside 95%% interval", lo90, hi90)
+	}
+	if lo, hi = WilsonInterval(0, 0, 0.95); !math.IsNaN(lo) || !math.IsNaN(hi) {
+		t.Errorf("interval of empty window not NaN")
+	}
+}
+
+func TestCIOutput(t *testing.T) {
+	flags := gFlags
+	flags.ReadLen = 150
+	flags.CIMethods, _ = ParseCIMethods("wilson,exact")
+	flags.CILevel = 0.9
+	stats, e := WinStats(flags, strings.NewReader(makeParallelTestIn(200)))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	var buf bytes.Buffer
+	FprintWinStatsPlain(&buf, stats, flags.ReadLen)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	header := strings.Split(lines[0], "\t")
+	if !strings.HasSuffix(lines[0], "\tpair_prop_wilson_lo\tpair_prop_wilson_hi\tovl_prop_wilson_lo\tovl_prop_wilson_hi\tpair_prop_exact_lo\tpair_prop_exact_hi\tovl_prop_exact_lo\tovl_prop_exact_hi\tname") {
+		t.Errorf("header wrong: %v", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if n := len(strings.Split(line, "\t")); n != len(header) {
+			t.Fatalf("%v columns in row, %v in header", n, len(header))
+		}
+	}
+
+	buf.Reset()
+	if e = FprintWinStatsJson(&buf, stats, flags.ReadLen); e != nil {
+		t.Fatal(e)
+	}
+	var j JsonOutStat
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if e = json.Unmarshal([]byte(line), &j); e != nil {
+			t.Fatal(e)
+		}
+		if j.TargetHits + j.AltHits > 0 {
+			break
+		}
+	}
+	if j.PropCIJsonStat == nil || j.WilsonJsonStat == nil || j.ExactJsonStat == nil || j.JeffreysJsonStat != nil || j.CILevel != 0.9 {
+		t.Fatalf("wrong interval groups in %v", buf.String()[:200])
+	}
+	if !(j.TargetPropExactLo <= j.TargetProp && j.TargetProp <= j.TargetPropExactHi) {
+		t.Errorf("TargetProp %v outside interval (%v, %v)", j.TargetProp, j.TargetPropExactLo, j.TargetPropExactHi)
+	}
+}
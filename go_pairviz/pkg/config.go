@@ -0,0 +1,376 @@
+package pairviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"github.com/BurntSushi/toml"
+)
+
+var ErrUnknownConfigKey = errors.New("Unknown config key")
+var ErrBadAnalyses = errors.New("Analyses must map analysis names to tables of flags")
+var ErrAnalysisConflict = errors.New("Analyses conflict")
+
+// Every problem found in a set of flags or a config file, one per line
+type FlagErrors []error
+
+func (e FlagErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e FlagErrors) Unwrap() []error {
+	return e
+}
+
+// One named analysis of a config file: the top-level flags of the file,
+// overridden by the analysis's own table and then by the command line
+type Analysis struct {
+	Name string
+	Flags Flags
+}
+
+// Read the keys and values of a config file, which is TOML if path ends in
+// .toml and JSON otherwise
+func ReadConfig(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadConfig: %w", err)
+	}
+	cfg := map[string]any{}
+	if strings.HasSuffix(path, ".toml") {
+		if _, err = toml.Decode(string(data), &cfg); err != nil {
+			return nil, fmt.Errorf("ReadConfig: %v: %w", path, err)
+		}
+		return cfg, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("ReadConfig: %v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Config keys match field names regardless of case, underscores, and dashes,
+// so WinSize, winsize, and win_size are the same key
+func normConfigKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// The fields of Flags that can be set from a config file, by normalized name
+func configFields() map[string]int {
+	fields := map[string]int{}
+	typ := reflect.TypeOf(Flags{})
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.Tag.Get("json") != "-" {
+			fields[normConfigKey(f.Name)] = i
+		}
+	}
+	return fields
+}
+
+// Set the fields of f named by the keys of m, returning an error for every
+// unknown key and every value of the wrong type
+func applyConfig(f *Flags, m map[string]any, where string) FlagErrors {
+	fields := configFields()
+	v := reflect.ValueOf(f).Elem()
+	var errs FlagErrors
+	for _, key := range sortedKeys(m) {
+		i, ok := fields[normConfigKey(key)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v: %q: %w", where, key, ErrUnknownConfigKey))
+			continue
+		}
+		b, err := json.Marshal(m[key])
+		if err == nil {
+			err = json.Unmarshal(b, v.Field(i).Addr().Interface())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v: %w", where, key, err))
+		}
+	}
+	return errs
+}
+
+// Split a config into its top-level flags and the tables of its named
+// analyses
+func splitConfig(cfg map[string]any, path string) (top map[string]any, analyses map[string]map[string]any, errs FlagErrors) {
+	top = map[string]any{}
+	for key, val := range cfg {
+		if normConfigKey(key) != "analyses" {
+			top[key] = val
+			continue
+		}
+		tables, ok := val.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v: %v: %w", path, key, ErrBadAnalyses))
+			continue
+		}
+		analyses = map[string]map[string]any{}
+		for name, t := range tables {
+			table, ok := t.(map[string]any)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%v: %v.%v: %w", path, key, name, ErrBadAnalyses))
+				continue
+			}
+			analyses[name] = table
+		}
+	}
+	return top, analyses, errs
+}
+
+// Flags from their defaults, then each config layer in turn, then the
+// command line; args must already have parsed without error
+func layerFlags(args []string, layers ...map[string]any) Flags {
+	var f Flags
+	var config string
+	fs := newFlagSet(&f, &config)
+	for _, m := range layers {
+		applyConfig(&f, m, "")
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		f.Inputs = fs.Args()
+	}
+	return f
+}
+
+// Parse the config file at path, overridden by the command line flags in
+// args. If the config has analyses, each is built and validated and they are
+// returned in Analyses, sorted by name. Every problem in the config and the
+// resulting flags is reported at once.
+func ParseConfigFlags(path string, args []string) (Flags, error) {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return Flags{}, fmt.Errorf("ParseConfigFlags: %w", err)
+	}
+	top, analyses, errs := splitConfig(cfg, path)
+	errs = append(errs, applyConfig(&Flags{}, top, path)...)
+	for name, table := range analyses {
+		errs = append(errs, applyConfig(&Flags{}, table, path + ": analyses." + name)...)
+	}
+
+	f := layerFlags(args, top)
+	if len(analyses) == 0 {
+		errs = append(errs, f.validate()...)
+	}
+	// Problems shared by several analyses, such as those in the top-level
+	// flags, are reported once for all of them
+	var aerrs []error
+	anames := map[string][]string{}
+	for _, name := range sortedKeys(analyses) {
+		a := Analysis{name, layerFlags(args, top, analyses[name])}
+		for _, err := range a.Flags.validate() {
+			if _, ok := anames[err.Error()]; !ok {
+				aerrs = append(aerrs, err)
+			}
+			anames[err.Error()] = append(anames[err.Error()], name)
+		}
+		f.Analyses = append(f.Analyses, a)
+	}
+	for _, err := range aerrs {
+		names := anames[err.Error()]
+		if len(names) == 1 {
+			errs = append(errs, fmt.Errorf("analysis %v: %w", names[0], err))
+		} else {
+			errs = append(errs, fmt.Errorf("analyses %v: %w", strings.Join(names, ", "), err))
+		}
+	}
+	errs = append(errs, checkAnalyses(f.Analyses)...)
+
+	if len(errs) > 0 {
+		return f, errs
+	}
+	return f, nil
+}
+
+// Check that analyses can run together: those that read .pairs inputs must
+// read the same ones, and no two may write to the same output or reject file
+func checkAnalyses(as []Analysis) FlagErrors {
+	var errs FlagErrors
+	first := -1
+	outs := map[string]string{}
+	claim := func(name, path, what string) {
+		if other, ok := outs[path]; ok {
+			errs = append(errs, fmt.Errorf("analyses %v and %v both write %v to %q: %w", other, name, what, path, ErrAnalysisConflict))
+		}
+		outs[path] = name
+	}
+
+	for i, a := range as {
+		if a.Flags.Samples == "" {
+			if first < 0 {
+				first = i
+			} else if !slices.Equal(a.Flags.Inputs, as[first].Flags.Inputs) {
+				errs = append(errs, fmt.Errorf("analysis %v reads %v, but analysis %v reads %v; analyses share one pass over their input: %w", a.Name, a.Flags.Inputs, as[first].Name, as[first].Flags.Inputs, ErrAnalysisConflict))
+			}
+		}
+		out := a.Flags.OutPath
+		if out == "" {
+			out = "-"
+		}
+		claim(a.Name, out, "output")
+		if a.Flags.BadLines == "log" && a.Flags.RejectPath != "" {
+			claim(a.Name, a.Flags.RejectPath, "rejected lines")
+		}
+	}
+	return errs
+}
+
+// A pipe that holds up to cap(ch) chunks, so that writes only wait for a
+// reader that is that far behind
+type chunkPipe struct {
+	ch chan []byte
+	done chan struct{}
+	once sync.Once
+	cur []byte
+	err error
+}
+
+func newChunkPipe(chunks int) *chunkPipe {
+	return &chunkPipe{ch: make(chan []byte, chunks), done: make(chan struct{})}
+}
+
+// Queue b, which must not be changed afterwards
+func (p *chunkPipe) Write(b []byte) (int, error) {
+	select {
+	case p.ch <- b:
+		return len(b), nil
+	case <-p.done:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// End the pipe; readers get err after the queued chunks, or io.EOF if err is nil
+func (p *chunkPipe) CloseWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.err = err
+	close(p.ch)
+}
+
+func (p *chunkPipe) Read(b []byte) (int, error) {
+	for len(p.cur) == 0 {
+		chunk, ok := <-p.ch
+		if !ok {
+			return 0, p.err
+		}
+		p.cur = chunk
+	}
+	n := copy(b, p.cur)
+	p.cur = p.cur[n:]
+	return n, nil
+}
+
+// Stop reading; later writes fail instead of waiting
+func (p *chunkPipe) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+// Copy r to every pipe, dropping pipes whose readers have stopped, then end
+// the pipes with the error from r, if any
+func broadcast(r io.Reader, pipes []*chunkPipe) {
+	live := slices.Clone(pipes)
+	for {
+		buf := make([]byte, 64 * 1024)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			kept := live[:0]
+			for _, p := range live {
+				if _, e := p.Write(buf[:n]); e == nil {
+					kept = append(kept, p)
+				}
+			}
+			live = kept
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		if err != nil || n < len(buf) {
+			for _, p := range pipes {
+				p.CloseWrite(err)
+			}
+			return
+		}
+	}
+}
+
+// Run several analyses, reading their shared .pairs inputs once and passing
+// them to every analysis as they are read. Each input gets its own pipe per
+// analysis holding up to 4 MB, so that analyses can look ahead to the headers
+// of later inputs. Analyses of -samples read their own inputs.
+func RunAnalyses(as []Analysis) error {
+	readers := make([]io.Reader, len(as))
+	threads := 1
+	var shared []int
+	for i, a := range as {
+		if a.Flags.Samples == "" {
+			shared = append(shared, i)
+			if a.Flags.Threads > threads {
+				threads = a.Flags.Threads
+			}
+		}
+	}
+
+	var in *Inputs
+	var pipes [][]*chunkPipe
+	if len(shared) > 0 {
+		var err error
+		if in, err = OpenInputs(as[shared[0]].Flags.Inputs, threads); err != nil {
+			return fmt.Errorf("RunAnalyses: %w", err)
+		}
+		defer in.Close()
+		pipes = make([][]*chunkPipe, len(in.Readers))
+		for _, i := range shared {
+			pin := &Inputs{Names: in.Names}
+			var rs []io.Reader
+			for j := range in.Readers {
+				p := newChunkPipe(64)
+				pipes[j] = append(pipes[j], p)
+				pin.Readers = append(pin.Readers, p)
+				rs = append(rs, p)
+			}
+			pin.r = io.MultiReader(rs...)
+			readers[i] = pin
+		}
+	}
+
+	errs := make([]error, len(as))
+	var wg sync.WaitGroup
+	for i, a := range as {
+		wg.Add(1)
+		go func(i int, a Analysis) {
+			defer wg.Done()
+			if err := runPairvizOutput(a.Flags, readers[i]); err != nil {
+				errs[i] = fmt.Errorf("analysis %v: %w", a.Name, err)
+			}
+			if pin, ok := readers[i].(*Inputs); ok {
+				pin.Close()
+			}
+		}(i, a)
+	}
+	if in != nil {
+		for j, r := range in.Readers {
+			wg.Add(1)
+			go func(r io.Reader, pipes []*chunkPipe) {
+				defer wg.Done()
+				broadcast(r, pipes)
+			}(r, pipes[j])
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package pairviz
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sortedFileLines(t *testing.T, path string) []string {
+	b, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	in1, in2 := filepath.Join(dir, "a.pairs"), filepath.Join(dir, "b.pairs")
+	for _, p := range []string{in1, in2} {
+		if e := os.WriteFile(p, []byte(gTestIn + "\n"), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	out := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	toml := `win_size = 10
+WinStep = 3
+JsonOut = true
+ReadLen = 150
+Inputs = ["` + in1 + `"]
+
+[analyses.wide]
+OutPath = "` + out("wide.json") + `"
+
+[analyses.chroms]
+Chromosome = true
+Name = "chroms"
+OutPath = "` + out("chroms.json") + `"
+`
+	cpath := out("run.toml")
+	if e := os.WriteFile(cpath, []byte(toml), 0644); e != nil {
+		t.Fatal(e)
+	}
+	f, e := ParseFlags([]string{"-config", cpath, "-s", "5", in1, in2})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(f.Analyses) != 2 || f.Analyses[0].Name != "chroms" || f.Analyses[1].Name != "wide" {
+		t.Fatalf("wrong analyses %v", f.Analyses)
+	}
+	chroms, wide := f.Analyses[0].Flags, f.Analyses[1].Flags
+	if wide.WinSize != 10 || wide.WinStep != 5 || !wide.JsonOut || len(wide.Inputs) != 2 || wide.Name != "" || wide.Threads != 1 {
+		t.Errorf("wrong wide flags %+v", wide)
+	}
+	if !chroms.Chromosome || !chroms.NameCol || chroms.OutPath != out("chroms.json") {
+		t.Errorf("wrong chromosome flags %+v", chroms)
+	}
+
+	if e = RunAnalyses(f.Analyses); e != nil {
+		t.Fatal(e)
+	}
+	for _, a := range f.Analyses {
+		sep := a.Flags
+		sep.OutPath = out("sep_" + a.Name + ".json")
+		in, e := OpenInputs(sep.Inputs, 1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		e = runPairvizOutput(sep, in)
+		in.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+		got, want := sortedFileLines(t, a.Flags.OutPath), sortedFileLines(t, sep.OutPath)
+		if strings.Join(got, "\n") != strings.Join(want, "\n") || len(got) < 2 {
+			t.Errorf("analysis %v differs from a separate run:\n%v\n%v", a.Name, got, want)
+		}
+	}
+
+	jpath := out("one.json")
+	if e := os.WriteFile(jpath, []byte(`{"Chromosome": true, "Inputs": ["`+in1+`"], "pair-types": "all"}`), 0644); e != nil {
+		t.Fatal(e)
+	}
+	f, e = ParseFlags([]string{"-config", jpath, "-j"})
+	if e != nil || !f.Chromosome || !f.JsonOut || len(f.Inputs) != 1 || f.PairTypes != "all" || len(f.Analyses) != 0 {
+		t.Errorf("flags %+v, error %v", f, e)
+	}
+
+	bad := `{"WinSize": "big", "Bogus": 1, "CILevel": 2,
+		"analyses": {"a": {"OutPath": "x.json", "WinStep": 3}, "b": {"OutPath": "x.json", "WinStep": 3, "Inputs": ["` + in2 + `"]}}}`
+	if e := os.WriteFile(jpath, []byte(bad), 0644); e != nil {
+		t.Fatal(e)
+	}
+	_, e = ParseFlags([]string{"-config", jpath})
+	var errs FlagErrors
+	if !errors.As(e, &errs) || len(errs) != 6 {
+		t.Fatalf("wrong errors:\n%v", e)
+	}
+	for _, want := range []error{ErrUnknownConfigKey, ErrBadCILevel, ErrMissingFlag, ErrAnalysisConflict} {
+		if !errors.Is(e, want) {
+			t.Errorf("errors do not include %v:\n%v", want, e)
+		}
+	}
+	if !strings.Contains(e.Error(), "analyses a, b: -cilevel 2") {
+		t.Errorf("shared problem not reported once:\n%v", e)
+	}
+
+	_, e = ParseFlags([]string{"-w", "0", "-s", "5", "-cilevel", "2", "-bad", "drop"})
+	if !errors.As(e, &errs) || len(errs) != 3 || !errors.Is(e, ErrBadPolicy) || !errors.Is(e, ErrBadCILevel) {
+		t.Errorf("wrong errors:\n%v", e)
+	}
+}
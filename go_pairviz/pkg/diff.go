@@ -0,0 +1,551 @@
+package pairviz
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"gonum.org/v1/gonum/optimize"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+var ErrBadDiffModel = errors.New("Unknown differential pairing model")
+var ErrDuplicateWindow = errors.New("Window appears more than once in one input; select one sample with -n")
+var ErrNoReplicates = errors.New("Each condition needs at least one input")
+
+// A model for testing differences in paired proportion between conditions
+type DiffModel int
+
+const (
+	BetaBinomDiff DiffModel = iota
+	QuasiBinomDiff
+)
+
+func (m DiffModel) String() string {
+	switch m {
+	case BetaBinomDiff: return "betabinom"
+	case QuasiBinomDiff: return "quasibinom"
+	default:
+	}
+	return "unknown"
+}
+
+// Parse a model name: "betabinom" or "quasibinom"
+func ParseDiffModel(s string) (DiffModel, error) {
+	switch s {
+	case "betabinom", "bb": return BetaBinomDiff, nil
+	case "quasibinom", "quasi", "qb": return QuasiBinomDiff, nil
+	default:
+	}
+	return BetaBinomDiff, fmt.Errorf("ParseDiffModel: %q: %w", s, ErrBadDiffModel)
+}
+
+// Paired (target) and self (alt) hits of one window in one replicate
+type DiffCounts struct {
+	Pair float64
+	Self float64
+}
+
+// Identifies one window across replicates
+type DiffKey struct {
+	Genome string
+	Chr string
+	Start int64
+	End int64
+}
+
+// The counts of every window in every replicate of two conditions. A
+// replicate that lacks a window is left out of that window's counts.
+type DiffWins struct {
+	Reps [2]int
+	Wins map[DiffKey]*[2][]DiffCounts
+}
+
+func NewDiffWins() *DiffWins {
+	return &DiffWins{Wins: map[DiffKey]*[2][]DiffCounts{}}
+}
+
+// Add the windows of one replicate of condition cond (0 or 1). Records whose
+// Name is not name are skipped if name is set.
+func (d *DiffWins) AddReplicate(cond int, it iter.Seq2[JsonOutStat, error], name string) error {
+	seen := map[DiffKey]struct{}{}
+	for j, err := range it {
+		if err != nil {
+			return fmt.Errorf("AddReplicate: %w", err)
+		}
+		if name != "" && j.Name != name {
+			continue
+		}
+		key := DiffKey{j.Genome, j.Chr, j.Start, j.End}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("AddReplicate: %v %v:%v-%v: %w", j.Genome, j.Chr, j.Start, j.End, ErrDuplicateWindow)
+		}
+		seen[key] = struct{}{}
+		if IsInfOrNaN(j.TargetHits) || IsInfOrNaN(j.AltHits) {
+			continue
+		}
+
+		counts, ok := d.Wins[key]
+		if !ok {
+			counts = &[2][]DiffCounts{}
+			d.Wins[key] = counts
+		}
+		counts[cond] = append(counts[cond], DiffCounts{float64(j.TargetHits), float64(j.AltHits)})
+	}
+	d.Reps[cond]++
+	return nil
+}
+
+// Read the replicates of both conditions from pairviz JSON output paths
+func ReadDiffWins(apaths, bpaths []string, name string) (*DiffWins, error) {
+	if len(apaths) < 1 || len(bpaths) < 1 {
+		return nil, fmt.Errorf("ReadDiffWins: %w", ErrNoReplicates)
+	}
+	d := NewDiffWins()
+	for cond, paths := range [2][]string{apaths, bpaths} {
+		for _, path := range paths {
+			r, err := OpenMaybeGz(path)
+			if err != nil {
+				return nil, fmt.Errorf("ReadDiffWins: %w", err)
+			}
+			err = d.AddReplicate(cond, ParsePairvizOut(r), name)
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("ReadDiffWins: %v: %w", path, err)
+			}
+		}
+	}
+	return d, nil
+}
+
+// The fit and test of one window. Dispersion is the quasi-binomial
+// dispersion or the beta-binomial intra-class correlation, and Stat is the F
+// statistic or the likelihood ratio statistic.
+type DiffResult struct {
+	PropA float64
+	PropB float64
+	LogOddsRatio float64
+	Dispersion float64
+	Stat float64
+	P float64
+}
+
+func nanDiffResult() DiffResult {
+	nan := math.NaN()
+	return DiffResult{nan, nan, nan, nan, nan, nan}
+}
+
+// Sum the hits of replicates with at least one hit, and count them
+func sumDiffCounts(cs []DiffCounts) (pair, total float64, n int) {
+	for _, c := range cs {
+		if c.Pair + c.Self > 0 {
+			pair += c.Pair
+			total += c.Pair + c.Self
+			n++
+		}
+	}
+	return pair, total, n
+}
+
+func logit(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
+
+func invLogit(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// x log(x / y), taking 0 log 0 as 0
+func xlogxy(x, y float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x * math.Log(x / y)
+}
+
+// The binomial deviance and Pearson statistic of cs with paired proportion p
+func binomDeviance(cs []DiffCounts, p float64) (dev, pearson float64) {
+	for _, c := range cs {
+		n := c.Pair + c.Self
+		if n <= 0 {
+			continue
+		}
+		dev += 2 * (xlogxy(c.Pair, n * p) + xlogxy(c.Self, n * (1 - p)))
+		if p > 0 && p < 1 {
+			r := c.Pair - n * p
+			pearson += r * r / (n * p * (1 - p))
+		}
+	}
+	return dev, pearson
+}
+
+// Test for a difference in paired proportion between a and b with a
+// quasi-binomial GLM, as glm(family = quasibinomial) followed by an F test of
+// the condition term: the dispersion is the Pearson statistic over the
+// residual degrees of freedom, so at least three replicates with hits are
+// needed between the two conditions.
+func QuasiBinomTest(a, b []DiffCounts) DiffResult {
+	res := nanDiffResult()
+	apair, atotal, an := sumDiffCounts(a)
+	bpair, btotal, bn := sumDiffCounts(b)
+	if an < 1 || bn < 1 {
+		return res
+	}
+	res.PropA = apair / atotal
+	res.PropB = bpair / btotal
+	res.LogOddsRatio = logit(res.PropB) - logit(res.PropA)
+
+	pooled := (apair + bpair) / (atotal + btotal)
+	df := an + bn - 2
+	if pooled <= 0 || pooled >= 1 || df < 1 {
+		return res
+	}
+	adev, apearson := binomDeviance(a, res.PropA)
+	bdev, bpearson := binomDeviance(b, res.PropB)
+	ndev, _ := binomDeviance(append(append([]DiffCounts{}, a...), b...), pooled)
+
+	res.Dispersion = (apearson + bpearson) / float64(df)
+	res.Stat = math.Max(ndev - adev - bdev, 0) / res.Dispersion
+	res.P = distuv.F{D1: 1, D2: float64(df)}.Survival(res.Stat)
+	return res
+}
+
+// Limits on the logit-scale beta-binomial parameters, keeping the log-gamma
+// differences accurate
+const (
+	maxBetaBinomLogitMean = 20
+	minBetaBinomLogitRho = -15
+	maxBetaBinomLogitRho = 15
+)
+
+func clamp(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, x))
+}
+
+func lbeta(a, b float64) float64 {
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	return la + lb - lab
+}
+
+// The negative beta-binomial log-likelihood of cs, without the binomial
+// coefficients, with logit mean lmu and logit intra-class correlation lrho
+func betaBinomNegLogLik(cs []DiffCounts, lmu, lrho float64) float64 {
+	mu := invLogit(clamp(lmu, -maxBetaBinomLogitMean, maxBetaBinomLogitMean))
+	rho := invLogit(clamp(lrho, minBetaBinomLogitRho, maxBetaBinomLogitRho))
+	alpha := mu * (1 / rho - 1)
+	beta := (1 - mu) * (1 / rho - 1)
+	base := lbeta(alpha, beta)
+	nll := 0.0
+	for _, c := range cs {
+		if c.Pair + c.Self > 0 {
+			nll -= lbeta(c.Pair + alpha, c.Self + beta) - base
+		}
+	}
+	return nll
+}
+
+// Minimize f from x0 with Nelder-Mead
+func minimizeNM(f func([]float64) float64, x0 []float64) ([]float64, float64) {
+	res, err := optimize.Minimize(optimize.Problem{Func: f}, x0, nil, &optimize.NelderMead{})
+	if res == nil || (err != nil && math.IsNaN(res.F)) {
+		return x0, f(x0)
+	}
+	return res.X, res.F
+}
+
+// Test for a difference in paired proportion between a and b with a
+// beta-binomial model: each condition has its own mean, the conditions share
+// one intra-class correlation, and the test is a likelihood ratio test
+// against a single mean.
+func BetaBinomTest(a, b []DiffCounts) DiffResult {
+	res := nanDiffResult()
+	apair, atotal, an := sumDiffCounts(a)
+	bpair, btotal, bn := sumDiffCounts(b)
+	if an < 1 || bn < 1 {
+		return res
+	}
+	pooled := (apair + bpair) / (atotal + btotal)
+	if pooled <= 0 || pooled >= 1 {
+		res.PropA = apair / atotal
+		res.PropB = bpair / btotal
+		res.LogOddsRatio = logit(res.PropB) - logit(res.PropA)
+		return res
+	}
+	lrho0 := logit(0.01)
+	start := func(pair, total float64) float64 {
+		return logit((pair + 0.5) / (total + 1))
+	}
+
+	x0, nll0 := minimizeNM(func(x []float64) float64 {
+		return betaBinomNegLogLik(a, x[0], x[1]) + betaBinomNegLogLik(b, x[0], x[1])
+	}, []float64{start(apair + bpair, atotal + btotal), lrho0})
+	x1, nll1 := minimizeNM(func(x []float64) float64 {
+		return betaBinomNegLogLik(a, x[0], x[2]) + betaBinomNegLogLik(b, x[1], x[2])
+	}, []float64{start(apair, atotal), start(bpair, btotal), x0[1]})
+
+	lmua := clamp(x1[0], -maxBetaBinomLogitMean, maxBetaBinomLogitMean)
+	lmub := clamp(x1[1], -maxBetaBinomLogitMean, maxBetaBinomLogitMean)
+	res.PropA = invLogit(lmua)
+	res.PropB = invLogit(lmub)
+	res.LogOddsRatio = lmub - lmua
+	res.Dispersion = invLogit(clamp(x1[2], minBetaBinomLogitRho, maxBetaBinomLogitRho))
+	res.Stat = math.Max(2 * (nll0 - nll1), 0)
+	res.P = distuv.ChiSquared{K: 1}.Survival(res.Stat)
+	return res
+}
+
+// Test a and b with model m
+func DiffTest(m DiffModel, a, b []DiffCounts) DiffResult {
+	if m == QuasiBinomDiff {
+		return QuasiBinomTest(a, b)
+	}
+	return BetaBinomTest(a, b)
+}
+
+// Benjamini-Hochberg adjusted p-values. NaN p-values are left out of the
+// adjustment and stay NaN.
+func BHAdjust(ps []float64) []float64 {
+	q := make([]float64, len(ps))
+	idx := make([]int, 0, len(ps))
+	for i, p := range ps {
+		q[i] = math.NaN()
+		if !math.IsNaN(p) {
+			idx = append(idx, i)
+		}
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return ps[idx[i]] < ps[idx[j]]
+	})
+	m := float64(len(idx))
+	min := 1.0
+	for k := len(idx) - 1; k >= 0; k-- {
+		min = math.Min(min, ps[idx[k]] * m / float64(k + 1))
+		q[idx[k]] = min
+	}
+	return q
+}
+
+// The differential pairing test of one window, with the summed hits of each
+// condition
+type DiffJsonStat struct {
+	Genome string
+	Chr string
+	Start int64
+	End int64
+	Model string
+	RepsA int64
+	RepsB int64
+	TargetHitsA JsonFloat
+	AltHitsA JsonFloat
+	TargetHitsB JsonFloat
+	AltHitsB JsonFloat
+	PropA JsonFloat
+	PropB JsonFloat
+	PropDiff JsonFloat
+	LogOddsRatio JsonFloat
+	Dispersion JsonFloat
+	Stat JsonFloat
+	P JsonFloat
+	Q JsonFloat
+}
+
+func lessDiffKey(a, b DiffKey) bool {
+	if a.Genome != b.Genome {
+		return a.Genome < b.Genome
+	}
+	if a.Chr != b.Chr {
+		return a.Chr < b.Chr
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	return a.End < b.End
+}
+
+// Test every window with model m, sorted by genome, chromosome, and position
+func (d *DiffWins) Test(m DiffModel) []DiffJsonStat {
+	keys := make([]DiffKey, 0, len(d.Wins))
+	for key, _ := range d.Wins {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessDiffKey(keys[i], keys[j])
+	})
+
+	out := make([]DiffJsonStat, 0, len(keys))
+	ps := make([]float64, 0, len(keys))
+	for _, key := range keys {
+		counts := d.Wins[key]
+		res := DiffTest(m, counts[0], counts[1])
+		apair, atotal, _ := sumDiffCounts(counts[0])
+		bpair, btotal, _ := sumDiffCounts(counts[1])
+		out = append(out, DiffJsonStat{
+			Genome: key.Genome,
+			Chr: key.Chr,
+			Start: key.Start,
+			End: key.End,
+			Model: m.String(),
+			RepsA: int64(len(counts[0])),
+			RepsB: int64(len(counts[1])),
+			TargetHitsA: JsonFloat(apair),
+			AltHitsA: JsonFloat(atotal - apair),
+			TargetHitsB: JsonFloat(bpair),
+			AltHitsB: JsonFloat(btotal - bpair),
+			PropA: JsonFloat(res.PropA),
+			PropB: JsonFloat(res.PropB),
+			PropDiff: JsonFloat(res.PropB - res.PropA),
+			LogOddsRatio: JsonFloat(res.LogOddsRatio),
+			Dispersion: JsonFloat(res.Dispersion),
+			Stat: JsonFloat(res.Stat),
+			P: JsonFloat(res.P),
+		})
+		ps = append(ps, res.P)
+	}
+	for i, q := range BHAdjust(ps) {
+		out[i].Q = JsonFloat(q)
+	}
+	return out
+}
+
+// Write one JSON record per window
+func WriteDiffJson(w io.Writer, stats []DiffJsonStat) error {
+	enc := json.NewEncoder(w)
+	for _, s := range stats {
+		if err := enc.Encode(s); err != nil {
+			return fmt.Errorf("WriteDiffJson: %w", err)
+		}
+	}
+	return nil
+}
+
+// Collect one numeric field of the test results, such as LogOddsRatio or Q,
+// into tracks, named as in CollectTracks. flags.Name is not used.
+func DiffTracks(stats []DiffJsonStat, flags TrackFlags) (map[string]*Track, error) {
+	index, err := structMetricIndex(reflect.TypeOf(DiffJsonStat{}), flags.Metric)
+	if err != nil {
+		return nil, fmt.Errorf("DiffTracks: %w", err)
+	}
+	tracks := map[string]*Track{}
+	for _, s := range stats {
+		v := reflect.ValueOf(s).FieldByIndex(index)
+		var val float64
+		if v.Kind() == reflect.Int64 {
+			val = float64(v.Int())
+		} else {
+			val = v.Float()
+		}
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+
+		key := ""
+		chrom := s.Chr + "_" + s.Genome
+		if flags.SeparateGenomes {
+			key = s.Genome
+			chrom = s.Chr
+		}
+		if _, ok := tracks[key]; !ok {
+			tracks[key] = &Track{Name: flags.Metric}
+			if key != "" {
+				tracks[key].Name = flags.Metric + " " + key
+			}
+		}
+		tracks[key].Records = append(tracks[key].Records, TrackRecord{Chrom: chrom, Start: s.Start, End: s.End, Value: val})
+	}
+	for _, t := range tracks {
+		t.Sort()
+		t.TrimOverlaps()
+	}
+	return tracks, nil
+}
+
+func splitPaths(s string) []string {
+	var out []string
+	for _, path := range strings.Split(s, ",") {
+		if path != "" {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+func FullDiff() {
+	var tflags TrackFlags
+	apaths := flag.String("a", "", "Comma-separated pairviz JSON outputs of the replicates of condition A (required)")
+	bpaths := flag.String("b", "", "Comma-separated pairviz JSON outputs of the replicates of condition B (required)")
+	modelp := flag.String("model", "betabinom", "Model: betabinom (beta-binomial likelihood ratio test) or quasibinom (quasi-binomial GLM F test)")
+	name := flag.String("n", "", "Only use records with this Name")
+	outpath := flag.String("o", "", "JSON output path (default stdout)")
+	trackpath := flag.String("track", "", "Also write a track of one field of the output to this path; with -G, the genome name is added before the extension")
+	formatp := flag.String("f", "", "Track format, bedgraph or bigwig (default from the -track extension: .bw and .bigwig are bigwig)")
+	chrlens := flag.String("chrlens", "", "Tab-separated file of chromosome lengths, used as the chromosome sizes of bigwig output")
+	flag.StringVar(&tflags.Metric, "m", "LogOddsRatio", "Field of the output to write as a track, such as LogOddsRatio, PropDiff, P, or Q")
+	flag.BoolVar(&tflags.SeparateGenomes, "G", false, "Write one track per genome, with the original chromosome names")
+	flag.Parse()
+
+	if *apaths == "" || *bpaths == "" {
+		fmt.Fprintln(os.Stderr, "missing -a or -b")
+		os.Exit(2)
+	}
+	model, e := ParseDiffModel(*modelp)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+	format, e := ParseTrackFormat(*formatp, *trackpath)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+	if *trackpath != "" {
+		if _, e = structMetricIndex(reflect.TypeOf(DiffJsonStat{}), tflags.Metric); e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(2)
+		}
+	}
+
+	h := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	var lens map[string]int64
+	if *chrlens != "" {
+		lens, e = ReadChromLens(*chrlens)
+		h(e)
+	}
+
+	wins, e := ReadDiffWins(splitPaths(*apaths), splitPaths(*bpaths), *name)
+	h(e)
+	stats := wins.Test(model)
+
+	out := os.Stdout
+	if *outpath != "" {
+		out, e = os.Create(*outpath)
+		h(e)
+	}
+	w := bufio.NewWriter(out)
+	h(WriteDiffJson(w, stats))
+	h(w.Flush())
+	h(out.Close())
+
+	if *trackpath != "" {
+		tracks, e := DiffTracks(stats, tflags)
+		h(e)
+		for _, key := range sortedKeys(tracks) {
+			h(WriteTrackPath(GenomeTrackPath(*trackpath, key), tracks[key], format, lens))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package pairviz
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBHAdjust(t *testing.T) {
+	q := BHAdjust([]float64{0.01, 0.04, 0.03, math.NaN(), 0.5})
+	want := []float64{0.04, 0.16 / 3, 0.16 / 3, math.NaN(), 0.5}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(q[i]) || math.Abs(q[i] - want[i]) > 1e-12 {
+			t.Errorf("q %v != %v", q, want)
+			break
+		}
+	}
+}
+
+func TestDiffModels(t *testing.T) {
+	same := [][]DiffCounts{
+		{{50, 50}, {45, 55}, {52, 48}},
+		{{48, 52}, {55, 45}, {50, 50}},
+	}
+	shifted := [][]DiffCounts{
+		{{50, 50}, {45, 55}, {52, 48}},
+		{{80, 20}, {75, 25}, {78, 22}},
+	}
+	// Same shift, but with much more variation between replicates
+	noisy := [][]DiffCounts{
+		{{20, 80}, {75, 25}, {55, 45}},
+		{{95, 5}, {50, 50}, {89, 11}},
+	}
+	for _, m := range []DiffModel{BetaBinomDiff, QuasiBinomDiff} {
+		s := DiffTest(m, same[0], same[1])
+		d := DiffTest(m, shifted[0], shifted[1])
+		n := DiffTest(m, noisy[0], noisy[1])
+		if !(s.P > 0.1) || !(d.P < 0.01) {
+			t.Errorf("%v: p-values %v and %v", m, s.P, d.P)
+		}
+		if !(n.P > d.P) || !(n.Dispersion > d.Dispersion) {
+			t.Errorf("%v: overdispersion ignored: %v, %v", m, n, d)
+		}
+		if math.Abs(d.PropA - 0.49) > 0.01 || math.Abs(d.PropB - 0.7767) > 0.01 || d.LogOddsRatio <= 0 {
+			t.Errorf("%v: wrong estimates %v", m, d)
+		}
+	}
+
+	if r := QuasiBinomTest(same[0][:1], same[1][:1]); !math.IsNaN(r.P) {
+		t.Errorf("quasi-binomial test without residual degrees of freedom gave %v", r)
+	}
+	if r := BetaBinomTest([]DiffCounts{{0, 10}}, []DiffCounts{{0, 12}, {0, 3}}); !math.IsNaN(r.P) {
+		t.Errorf("test without paired hits gave %v", r)
+	}
+}
+
+func TestDiffWins(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if e := os.WriteFile(path, []byte(data), 0644); e != nil {
+			t.Fatal(e)
+		}
+		return path
+	}
+	line := func(start, pair, self int) string {
+		return fmt.Sprintf(`{"Genome":"ISO1","Chr":"X","Start":%d,"End":%d,"TargetHits":%d,"AltHits":%d,"Name":"s"}`+"\n", start, start + 100, pair, self)
+	}
+	a := []string{
+		write("a1.json", line(0, 50, 50) + line(100, 10, 90)),
+		write("a2.json", line(0, 48, 52) + line(100, 12, 88)),
+	}
+	b := []string{
+		write("b1.json", line(0, 51, 49) + line(100, 60, 40)),
+		write("b2.json", line(0, 47, 53) + line(100, 55, 45) + line(200, 1, 1)),
+	}
+	wins, e := ReadDiffWins(a, b, "s")
+	if e != nil {
+		t.Fatal(e)
+	}
+	stats := wins.Test(QuasiBinomDiff)
+	if len(stats) != 3 || stats[0].Start != 0 || stats[2].Start != 200 {
+		t.Fatalf("wrong windows: %v", stats)
+	}
+	if !(stats[1].Q < 0.01) || !(stats[0].Q > 0.1) || !IsInfOrNaN(stats[2].Q) {
+		t.Errorf("wrong q-values: %v %v %v", stats[0].Q, stats[1].Q, stats[2].Q)
+	}
+	if stats[1].TargetHitsA != 22 || stats[1].AltHitsB != 85 || stats[1].RepsB != 2 || stats[2].RepsA != 0 {
+		t.Errorf("wrong sums: %v", stats[1])
+	}
+
+	tracks, e := DiffTracks(stats, TrackFlags{Metric: "Q"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	var buf bytes.Buffer
+	if e = WriteBedGraph(&buf, tracks[""]); e != nil {
+		t.Fatal(e)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "X_ISO1\t0\t100\t") {
+		t.Errorf("wrong bedGraph:\n%v", buf.String())
+	}
+
+	tracks, e = DiffTracks(stats, TrackFlags{Metric: "RepsA", SeparateGenomes: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r := tracks["ISO1"].Records; len(r) != 3 || r[0].Chrom != "X" || r[0].Value != float64(stats[0].RepsA) {
+		t.Errorf("wrong integer metric track %v", r)
+	}
+
+	if _, e = ReadDiffWins(a, []string{write("dup.json", line(0, 1, 1) + line(0, 2, 2))}, ""); e == nil {
+		t.Errorf("duplicate window accepted")
+	}
+}
@@ -46,7 +46,7 @@ func OpenGz(path string) (*GzReader, error) {
 	}
 	gr, e := gzip.NewReader(r)
 	if e != nil {
-		defer func() { Must(r.Close()) }()
+		r.Close()
 		return nil, e
 	}
 	return &GzReader{r, gr}, nil
@@ -61,14 +61,22 @@ func OpenMaybeGz(path string) (io.ReadCloser, error) {
 	return os.Open(path)
 }
 
+// Iterate over pairviz JSON output records. A decoding error, which includes
+// the 1-based record number, ends the iteration.
 func ParsePairvizOut(r io.Reader) iter.Seq2[JsonOutStat, error] {
 	return func(yield func(JsonOutStat, error) bool) {
 		dec := json.NewDecoder(r)
 		var j JsonOutStat
+		n := int64(1)
 		for err := dec.Decode(&j); err != io.EOF; err = dec.Decode(&j) {
-			if ok := yield(j, err); !ok {
+			if err != nil {
+				yield(j, fmt.Errorf("ParsePairvizOut: record %d: %w", n, err))
+				return
+			}
+			if ok := yield(j, nil); !ok {
 				return
 			}
+			n++
 		}
 	}
 }
@@ -274,48 +282,77 @@ func WriteMeansPath(path string, control, exp JsonOutStat) error {
 	return nil
 }
 
-func FullSubtractControl() {
-	controlChr := flag.String("c", "", "Chromosome to use as control (required)")
-	inpath := flag.String("i", "", "Input path (default stdin)")
-	outmeanp := flag.String("mo", "", "Path to output means to (default discard)")
-	divp := flag.Bool("div", false, "divide all applicable results by the control alt fpkm")
-	flag.Parse()
-	if *controlChr == "" {
-		panic(fmt.Errorf("missing -c"))
-	}
-	if *inpath == "" {
-		panic(fmt.Errorf("missing -i"))
+// Read pairviz JSON output from a file twice, first to find the mean control
+// chromosome statistics, then to write every record normalized to them
+func SubtractControl(inpath, controlChr, outmeanpath string, div bool, w io.Writer) error {
+	h := func(e error) error {
+		return fmt.Errorf("SubtractControl: %w", e)
 	}
 
-	r, e := OpenMaybeGz(*inpath)
-	Must(e)
-
-	it := ParsePairvizOut(r)
-	cmean, emean, e := GetControlStatMeans(*controlChr, it)
-	Must(r.Close())
-	Must(e)
+	r, e := OpenMaybeGz(inpath)
+	if e != nil {
+		return h(e)
+	}
+	cmean, emean, e := GetControlStatMeans(controlChr, ParsePairvizOut(r))
+	r.Close()
+	if e != nil {
+		return h(e)
+	}
 
-	if *outmeanp != "" {
-		WriteMeansPath(*outmeanp, cmean, emean)
+	if outmeanpath != "" {
+		if e = WriteMeansPath(outmeanpath, cmean, emean); e != nil {
+			return h(e)
+		}
 	}
 
-	r, e = OpenMaybeGz(*inpath)
-	Must(e)
-	defer func() { Must(r.Close()) }()
+	r, e = OpenMaybeGz(inpath)
+	if e != nil {
+		return h(e)
+	}
+	defer r.Close()
 
-	it = ParsePairvizOut(r)
+	it := ParsePairvizOut(r)
 	var transit iter.Seq2[JsonOutStat, error]
-	if *divp {
+	if div {
 		transit = DivideControlAltFpkmAll(it, cmean)
 	} else {
 		transit = SubtractControlStatAll(it, cmean)
 	}
 
-	w := bufio.NewWriter(os.Stdout)
-	defer w.Flush()
 	enc := json.NewEncoder(w)
 	for j, err := range transit {
-		Must(err)
-		Must(enc.Encode(j))
+		if err != nil {
+			return h(err)
+		}
+		if err = enc.Encode(j); err != nil {
+			return h(err)
+		}
+	}
+	return nil
+}
+
+func FullSubtractControl() {
+	controlChr := flag.String("c", "", "Chromosome to use as control (required)")
+	inpath := flag.String("i", "", "Input path (default stdin)")
+	outmeanp := flag.String("mo", "", "Path to output means to (default discard)")
+	divp := flag.Bool("div", false, "divide all applicable results by the control alt fpkm")
+	flag.Parse()
+	if *controlChr == "" {
+		fmt.Fprintln(os.Stderr, "missing -c")
+		os.Exit(2)
+	}
+	if *inpath == "" {
+		fmt.Fprintln(os.Stderr, "missing -i")
+		os.Exit(2)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	e := SubtractControl(*inpath, *controlChr, *outmeanp, *divp, w)
+	if e == nil {
+		e = w.Flush()
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"fmt"
 	"io"
+	"strings"
 	"github.com/jgbaldwinbrown/csvh"
 )
 
@@ -27,16 +28,17 @@ func GetBatchInfo(r io.Reader) (BatchInfoTable, error) {
 	var bit BatchInfoTable
 	for l, e := cr.Read(); e != io.EOF; l, e = cr.Read() {
 		if e != nil {
-			return bit, e
+			return bit, fmt.Errorf("GetBatchInfo: %w", e)
 		}
+		lineno, _ := cr.FieldPos(0)
 		if len(l) < 2 {
-			return bit, fmt.Errorf("GetBatchInfo: line %v too short", l)
+			return bit, fmt.Errorf("GetBatchInfo: %w", &ParseError{Line: int64(lineno), Text: strings.Join(l, "\t"), Err: ErrShortLine})
 		}
 
 		var bi BatchInfo
 		_, e = csvh.Scan(l, &bi.Name, &bi.Batch)
 		if e != nil {
-			return bit, e
+			return bit, fmt.Errorf("GetBatchInfo: %w", &ParseError{Line: int64(lineno), Text: strings.Join(l, "\t"), Err: e})
 		}
 		bit.Infos = append(bit.Infos, bi)
 	}
@@ -124,21 +126,25 @@ func Residual(y float64, x []float64, model *regression.Regression) (float64, er
 	return y - p, nil
 }
 
-func ResidualFromAltFpkm(x JsonOutStat, t BatchInfoTable, model *regression.Regression) JsonOutStat {
+func ResidualFromAltFpkm(x JsonOutStat, t BatchInfoTable, model *regression.Regression) (JsonOutStat, error) {
 	line := MakeControlLine(float64(x.TargetFpkm), x.Name, t)
 	targetFpkm, err := Residual(line[0], line[1:], model)
 	if err != nil {
-		panic(err)
+		return x, fmt.Errorf("ResidualFromAltFpkm: %v %v: %w", x.Chr, x.Start, err)
 	}
 	x.TargetFpkm = JsonFloat(targetFpkm)
-	return x
+	return x, nil
 }
 
 func ResidualFromAltFpkmAll(it iter.Seq2[JsonOutStat, error], t BatchInfoTable, model *regression.Regression) iter.Seq2[JsonOutStat, error] {
 	return func(yield func(JsonOutStat, error) bool) {
 		for x, err := range it {
-			j := ResidualFromAltFpkm(x, t, model)
-			if ok := yield(j, err); !ok {
+			if err != nil {
+				yield(x, err)
+				return
+			}
+			j, err := ResidualFromAltFpkm(x, t, model)
+			if ok := yield(j, err); !ok || err != nil {
 				return
 			}
 		}
@@ -152,6 +158,7 @@ func WriteModel(path string, bit BatchInfoTable, controls [][]float64, model *re
 	if e != nil {
 		return e
 	}
+	defer r.Close()
 
 	enc := json.NewEncoder(r)
 	enc.SetIndent("", "\t")
@@ -191,51 +198,82 @@ func WriteModel(path string, bit BatchInfoTable, controls [][]float64, model *re
 // 	return nil
 // }
 
-func FullEcnormLm() {
-	batchInfoPathp := flag.String("batch", "", "path to batch info tab-delimited file (name, batch_name)")
-	controlChr := flag.String("c", "", "Chromosome to use as control (required)")
-	inpath := flag.String("i", "", "Input path (default stdin)")
-	outmeanp := flag.String("mo", "", "Path to output means to (default discard)")
+// Read pairviz JSON output from a file twice, first to fit a model of the
+// control chromosome fpkm by batch, then to write every record with the
+// residual fpkm from that model
+func EcnormLm(inpath, controlChr, batchInfoPath, outmodelpath string, w io.Writer) error {
+	h := func(e error) error {
+		return fmt.Errorf("EcnormLm: %w", e)
+	}
 
-	flag.Parse()
-	if *controlChr == "" {
-		panic(fmt.Errorf("missing -c"))
+	batchInfo, e := GetBatchInfoPath(batchInfoPath)
+	if e != nil {
+		return h(e)
 	}
-	if *inpath == "" {
-		panic(fmt.Errorf("missing -i"))
+
+	r, e := OpenMaybeGz(inpath)
+	if e != nil {
+		return h(e)
 	}
-	if *batchInfoPathp == "" {
-		panic(fmt.Errorf("missing -batch"))
+	controlTable, e := GetBatchControlStatTable(controlChr, batchInfo, ParsePairvizOut(r))
+	r.Close()
+	if e != nil {
+		return h(e)
 	}
+	model := BuildModel(controlTable)
 
-	batchInfo, e := GetBatchInfoPath(*batchInfoPathp)
-
-	r, e := OpenMaybeGz(*inpath)
-	Must(e)
+	if outmodelpath != "" {
+		if e = WriteModel(outmodelpath, batchInfo, controlTable, model); e != nil {
+			return h(e)
+		}
+	}
 
-	it := ParsePairvizOut(r)
-	controlTable, e := GetBatchControlStatTable(*controlChr, batchInfo, it)
-	Must(e)
-	model := BuildModel(controlTable)
-	Must(r.Close())
-	Must(e)
+	r, e = OpenMaybeGz(inpath)
+	if e != nil {
+		return h(e)
+	}
+	defer r.Close()
 
-	if *outmeanp != "" {
-		WriteModel(*outmeanp, batchInfo, controlTable, model)
+	enc := json.NewEncoder(w)
+	for j, err := range ResidualFromAltFpkmAll(ParsePairvizOut(r), batchInfo, model) {
+		if err != nil {
+			return h(err)
+		}
+		if err = enc.Encode(j); err != nil {
+			return h(err)
+		}
 	}
+	return nil
+}
 
-	r, e = OpenMaybeGz(*inpath)
-	Must(e)
-	defer func() { Must(r.Close()) }()
+func FullEcnormLm() {
+	batchInfoPathp := flag.String("batch", "", "path to batch info tab-delimited file (name, batch_name)")
+	controlChr := flag.String("c", "", "Chromosome to use as control (required)")
+	inpath := flag.String("i", "", "Input path (default stdin)")
+	outmeanp := flag.String("mo", "", "Path to output means to (default discard)")
 
-	it = ParsePairvizOut(r)
-	transit := ResidualFromAltFpkmAll(it, batchInfo, model)
+	flag.Parse()
+	for _, req := range []struct {
+		val string
+		name string
+	} {
+		{*controlChr, "-c"},
+		{*inpath, "-i"},
+		{*batchInfoPathp, "-batch"},
+	} {
+		if req.val == "" {
+			fmt.Fprintln(os.Stderr, "missing", req.name)
+			os.Exit(2)
+		}
+	}
 
 	w := bufio.NewWriter(os.Stdout)
-	defer w.Flush()
-	enc := json.NewEncoder(w)
-	for j, err := range transit {
-		Must(err)
-		Must(enc.Encode(j))
+	e := EcnormLm(*inpath, *controlChr, *batchInfoPathp, *outmeanp, w)
+	if e == nil {
+		e = w.Flush()
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,71 @@
+package pairviz
+
+import (
+	"fmt"
+	"io"
+)
+
+// The orientation hit type of a pair, combining self or paired with its
+// facing; ok is false if the facing is unknown
+func FacingHitType(p Pair) (hit_type HitType, ok bool) {
+	self := p.Read1.Parent == p.Read2.Parent
+	switch p.Face() {
+	case In:
+		if self { return SIn, true }
+		return PIn, true
+	case Out:
+		if self { return SOut, true }
+		return POut, true
+	case Match:
+		if self { return SMatch, true }
+		return PMatch, true
+	default:
+	}
+	return hit_type, false
+}
+
+// The proportion of out- and match-facing hits that are paired. Inward-facing
+// pairs include dangling ends and unligated fragments, so this excludes them.
+func (h HitSet) PairPropOutMatch() float64 {
+	pair := float64(h.PairOutHits) + float64(h.PairMatchHits)
+	self := float64(h.SelfOutHits) + float64(h.SelfMatchHits)
+	return pair / (pair + self)
+}
+
+// Orientation-resolved hit statistics for one window, only included in JSON
+// output when orientations are counted
+type FacingJsonStat struct {
+	SelfInHits JsonFloat
+	SelfOutHits JsonFloat
+	SelfMatchHits JsonFloat
+	PairInHits JsonFloat
+	PairOutHits JsonFloat
+	PairMatchHits JsonFloat
+	PairPropOutMatch JsonFloat
+}
+
+// Add the orientation statistics for win to j
+func (j *JsonOutStat) AddFacing(win HitSet) {
+	j.FacingJsonStat = &FacingJsonStat {
+		SelfInHits: JsonFloat(win.SelfInHits),
+		SelfOutHits: JsonFloat(win.SelfOutHits),
+		SelfMatchHits: JsonFloat(win.SelfMatchHits),
+		PairInHits: JsonFloat(win.PairInHits),
+		PairOutHits: JsonFloat(win.PairOutHits),
+		PairMatchHits: JsonFloat(win.PairMatchHits),
+		PairPropOutMatch: JsonFloat(win.PairPropOutMatch()),
+	}
+}
+
+// Write the orientation columns for one window
+func FprintFacingCols(w io.Writer, win HitSet) {
+	fmt.Fprintf(w, "\t%d\t%d\t%d\t%d\t%d\t%d\t%.8g",
+		win.SelfInHits,
+		win.SelfOutHits,
+		win.SelfMatchHits,
+		win.PairInHits,
+		win.PairOutHits,
+		win.PairMatchHits,
+		win.PairPropOutMatch(),
+	)
+}
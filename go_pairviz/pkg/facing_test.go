@@ -0,0 +1,36 @@
+package pairviz
+
+import (
+	"strings"
+	"testing"
+)
+
+const gFacingIn = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_ISO1	3	+	-	UU
+r2	X_ISO1	2	X_ISO1	4	-	+	UU
+r3	X_ISO1	3	X_W501	8	+	+	UU
+r4	X_ISO1	4	X_W501	8	-	+	UU
+`
+
+func TestFacingWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+	flags.Orient = true
+
+	for _, threads := range []int{1, 2} {
+		flags.Threads = threads
+		stats, e := WinStats(flags, strings.NewReader(gFacingIn))
+		if e != nil {
+			t.Fatal(e)
+		}
+		x := (*stats.Hits.Hits["X"])[0]
+		if x.SelfInHits != 2 || x.SelfOutHits != 2 || x.PairMatchHits != 2 || x.PairOutHits != 2 || x.PairInHits != 0 {
+			t.Errorf("threads %v: X hits %v wrong", threads, x)
+		}
+		if p := x.PairPropOutMatch(); p != 4.0 / 6.0 {
+			t.Errorf("threads %v: PairPropOutMatch %v wrong", threads, p)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package pairviz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ErrBgzfBlock = errors.New("Malformed bgzip block")
+var ErrBadCompression = errors.New("Unknown compression")
+
+// The compression formats recognized from the first bytes of an input
+type Compression int
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Bgzip
+	Zstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip: return "gzip"
+	case Bgzip: return "bgzip"
+	case Zstd: return "zstd"
+	default:
+	}
+	return "none"
+}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Detect the compression of r from its magic bytes, without consuming them.
+// Bgzip files are gzip files whose first member has a "BC" extra field.
+func DetectCompression(r *bufio.Reader) Compression {
+	p, _ := r.Peek(16)
+	if bytes.HasPrefix(p, zstdMagic) {
+		return Zstd
+	}
+	if len(p) < 3 || p[0] != 0x1f || p[1] != 0x8b || p[2] != 8 {
+		return NoCompression
+	}
+	if len(p) >= 16 && p[3] & 4 != 0 && p[12] == 'B' && p[13] == 'C' && p[14] == 2 && p[15] == 0 {
+		return Bgzip
+	}
+	return Gzip
+}
+
+// Reads the output of an external decompression program
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+	stderr bytes.Buffer
+}
+
+func (c *cmdReader) Close() error {
+	c.ReadCloser.Close()
+	if err := c.cmd.Wait(); err != nil {
+		return fmt.Errorf("%v: %w: %s", c.cmd.Path, err, strings.TrimSpace(c.stderr.String()))
+	}
+	return nil
+}
+
+// Decompress zstd input with the zstd program, which must be installed
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	c := &cmdReader{cmd: exec.Command("zstd", "-d", "-c", "-q")}
+	c.cmd.Stdin = r
+	c.cmd.Stderr = &c.stderr
+	var err error
+	if c.ReadCloser, err = c.cmd.StdoutPipe(); err != nil {
+		return nil, fmt.Errorf("newZstdReader: %w", err)
+	}
+	if err = c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("newZstdReader: %w", err)
+	}
+	return c, nil
+}
+
+// Wrap r in a decompressor chosen by its magic bytes. Bgzip blocks are
+// decompressed with threads goroutines. Plain gzip is decompressed with one,
+// because the start of each member is only found by decompressing the one
+// before it.
+func Decompress(r io.Reader, threads int) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1 << 16)
+	switch DetectCompression(br) {
+	case Zstd:
+		return newZstdReader(br)
+	case Bgzip:
+		if threads > 1 {
+			return NewBgzfReader(br, threads), nil
+		}
+		return gzip.NewReader(br)
+	case Gzip:
+		return gzip.NewReader(br)
+	default:
+	}
+	return io.NopCloser(br), nil
+}
+
+// Close both a decompressor and the file under it
+type inputCloser struct {
+	io.ReadCloser
+	f io.Closer
+}
+
+func (i inputCloser) Close() error {
+	return Close(i.ReadCloser, i.f)
+}
+
+// Open an input path, or stdin for "-", decompressing it if needed
+func OpenInput(path string, threads int) (io.ReadCloser, error) {
+	var f io.ReadCloser = os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, fmt.Errorf("OpenInput: %w", err)
+		}
+	}
+	r, err := Decompress(f, threads)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("OpenInput: %v: %w", path, err)
+	}
+	return inputCloser{r, f}, nil
+}
+
+// Several inputs read one after another. Reading it as an io.Reader
+// concatenates the inputs; NewPairScanner instead reads each input with its
+// own scanner, so that pairs caches and text files can be mixed.
+type Inputs struct {
+	Names []string
+	Readers []io.ReadCloser
+	r io.Reader
+}
+
+// Open all input paths; with no paths, read stdin
+func OpenInputs(paths []string, threads int) (*Inputs, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	in := &Inputs{}
+	var rs []io.Reader
+	for _, path := range paths {
+		r, err := OpenInput(path, threads)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("OpenInputs: %w", err)
+		}
+		in.Names = append(in.Names, path)
+		in.Readers = append(in.Readers, r)
+		rs = append(rs, r)
+	}
+	in.r = io.MultiReader(rs...)
+	return in, nil
+}
+
+func (in *Inputs) Read(p []byte) (int, error) {
+	return in.r.Read(p)
+}
+
+func (in *Inputs) Close() error {
+	var args []any
+	for _, r := range in.Readers {
+		args = append(args, r)
+	}
+	return Close(args...)
+}
+
+// A bgzip block waiting to be decompressed, and where to send the result
+type bgzfJob struct {
+	Block []byte
+	Out chan bgzfResult
+}
+
+type bgzfResult struct {
+	Data []byte
+	Err error
+}
+
+// Decompresses bgzip blocks in parallel, returning them in order
+type BgzfReader struct {
+	results chan chan bgzfResult
+	done chan struct{}
+	cur []byte
+	err error
+}
+
+// Read the next complete bgzip block, using the block size in its BC extra
+// field
+func readBgzfBlock(r *bufio.Reader) ([]byte, error) {
+	hdr, err := r.Peek(18)
+	if len(hdr) == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil || hdr[0] != 0x1f || hdr[1] != 0x8b || hdr[3] & 4 == 0 || hdr[12] != 'B' || hdr[13] != 'C' {
+		return nil, ErrBgzfBlock
+	}
+	size := int(binary.LittleEndian.Uint16(hdr[16:])) + 1
+	block := make([]byte, size)
+	if _, err = io.ReadFull(r, block); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBgzfBlock, err)
+	}
+	return block, nil
+}
+
+// Decompress one bgzip block and check its CRC
+func inflateBgzfBlock(block []byte) ([]byte, error) {
+	xlen := int(binary.LittleEndian.Uint16(block[10:]))
+	if len(block) < 12 + xlen + 8 {
+		return nil, ErrBgzfBlock
+	}
+	tail := block[len(block) - 8:]
+	isize := binary.LittleEndian.Uint32(tail[4:])
+	data := make([]byte, 0, isize)
+	buf := bytes.NewBuffer(data)
+	fr := flate.NewReader(bytes.NewReader(block[12 + xlen:len(block) - 8]))
+	if _, err := io.Copy(buf, fr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBgzfBlock, err)
+	}
+	data = buf.Bytes()
+	if uint32(len(data)) != isize || crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(tail) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBgzfBlock)
+	}
+	return data, nil
+}
+
+// Start reading bgzip blocks from r and decompressing them with threads
+// goroutines
+func NewBgzfReader(r *bufio.Reader, threads int) *BgzfReader {
+	b := &BgzfReader{
+		results: make(chan chan bgzfResult, threads * 4),
+		done: make(chan struct{}),
+	}
+	jobs := make(chan bgzfJob, threads)
+	for i := 0; i < threads; i++ {
+		go func() {
+			for j := range jobs {
+				data, err := inflateBgzfBlock(j.Block)
+				j.Out <- bgzfResult{data, err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(b.results)
+		for {
+			block, err := readBgzfBlock(r)
+			if err == io.EOF {
+				return
+			}
+			out := make(chan bgzfResult, 1)
+			if err != nil {
+				out <- bgzfResult{nil, err}
+			}
+			select {
+			case b.results <- out:
+			case <-b.done:
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case jobs <- bgzfJob{block, out}:
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+func (b *BgzfReader) Read(p []byte) (int, error) {
+	for len(b.cur) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		out, ok := <-b.results
+		if !ok {
+			b.err = io.EOF
+			continue
+		}
+		res := <-out
+		if res.Err != nil {
+			b.err = fmt.Errorf("BgzfReader: %w", res.Err)
+			continue
+		}
+		b.cur = res.Data
+	}
+	n := copy(p, b.cur)
+	b.cur = b.cur[n:]
+	return n, nil
+}
+
+// Stop reading blocks
+func (b *BgzfReader) Close() error {
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+	return nil
+}
+
+// The most data put in one bgzip block, as in htslib, so that every
+// compressed block fits in 64 KB
+const bgzfBlockData = 0xff00
+
+// The empty block that marks the end of a bgzip file
+var bgzfEOF = []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0, 0x1b, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// Writes bgzip: gzip members of at most 64 KB, each holding its size in a
+// "BC" extra field, so that the output can be indexed and read in parallel
+type BgzfWriter struct {
+	w io.Writer
+	buf []byte
+	block bytes.Buffer
+	gw *gzip.Writer
+}
+
+func NewBgzfWriter(w io.Writer) *BgzfWriter {
+	return &BgzfWriter{w: w, buf: make([]byte, 0, bgzfBlockData), gw: gzip.NewWriter(nil)}
+}
+
+func (b *BgzfWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		k := bgzfBlockData - len(b.buf)
+		if k > len(p) - n {
+			k = len(p) - n
+		}
+		b.buf = append(b.buf, p[n:n + k]...)
+		if len(b.buf) == bgzfBlockData {
+			if err := b.flush(); err != nil {
+				return n, err
+			}
+		}
+		n += k
+	}
+	return n, nil
+}
+
+// Compress and write the buffered data as one block
+func (b *BgzfWriter) flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	b.block.Reset()
+	b.gw.Reset(&b.block)
+	b.gw.Header.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+	b.gw.Write(b.buf)
+	if err := b.gw.Close(); err != nil {
+		return fmt.Errorf("BgzfWriter: %w", err)
+	}
+	block := b.block.Bytes()
+	binary.LittleEndian.PutUint16(block[16:], uint16(len(block) - 1))
+	b.buf = b.buf[:0]
+	if _, err := b.w.Write(block); err != nil {
+		return fmt.Errorf("BgzfWriter: %w", err)
+	}
+	return nil
+}
+
+// Write the remaining data and the end-of-file block; the underlying writer
+// is not closed
+func (b *BgzfWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	if _, err := b.w.Write(bgzfEOF); err != nil {
+		return fmt.Errorf("BgzfWriter: %w", err)
+	}
+	return nil
+}
+
+// Writes through an external compression program into a file
+type cmdWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+	f *os.File
+	stderr bytes.Buffer
+}
+
+func (c *cmdWriter) Close() error {
+	c.WriteCloser.Close()
+	err := c.cmd.Wait()
+	if e := c.f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w: %s", c.cmd.Path, err, strings.TrimSpace(c.stderr.String()))
+	}
+	return nil
+}
+
+// Close a compressor, then the file under it
+type outputCloser struct {
+	io.WriteCloser
+	f io.Closer
+}
+
+func (o outputCloser) Close() error {
+	return Close(o.WriteCloser, o.f)
+}
+
+// Parse an output compression name: "none", "gzip", "bgzip", "zstd", or
+// "auto", which picks the compression from the extension of path (.gz, .bgz,
+// or .zst)
+func ParseOutputCompression(name, path string) (Compression, error) {
+	switch name {
+	case "", "auto":
+		switch filepath.Ext(path) {
+		case ".gz": return Gzip, nil
+		case ".bgz": return Bgzip, nil
+		case ".zst": return Zstd, nil
+		default:
+		}
+		return NoCompression, nil
+	case "none": return NoCompression, nil
+	case "gzip": return Gzip, nil
+	case "bgzip": return Bgzip, nil
+	case "zstd": return Zstd, nil
+	default:
+	}
+	return NoCompression, fmt.Errorf("ParseOutputCompression: %q: %w", name, ErrBadCompression)
+}
+
+// Create an output file, compressing it as requested; zstd compression uses
+// the zstd program
+func CreateOutput(path string, comp Compression) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("CreateOutput: %w", err)
+	}
+	switch comp {
+	case Gzip:
+		return outputCloser{gzip.NewWriter(f), f}, nil
+	case Bgzip:
+		return outputCloser{NewBgzfWriter(f), f}, nil
+	case Zstd:
+		c := &cmdWriter{cmd: exec.Command("zstd", "-c", "-q"), f: f}
+		c.cmd.Stdout = f
+		c.cmd.Stderr = &c.stderr
+		if c.WriteCloser, err = c.cmd.StdinPipe(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("CreateOutput: %w", err)
+		}
+		if err = c.cmd.Start(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("CreateOutput: %w", err)
+		}
+		return c, nil
+	default:
+	}
+	return f, nil
+}
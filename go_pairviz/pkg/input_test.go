@@ -0,0 +1,197 @@
+package pairviz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Compress data as bgzip blocks of at most blocksize bytes, plus the empty
+// end-of-file block
+func bgzfCompress(t *testing.T, data []byte, blocksize int) []byte {
+	var out bytes.Buffer
+	for len(data) >= 0 {
+		n := min(blocksize, len(data))
+		var b bytes.Buffer
+		gw, _ := gzip.NewWriterLevel(&b, gzip.BestSpeed)
+		gw.Header.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		gw.Write(data[:n])
+		if e := gw.Close(); e != nil {
+			t.Fatal(e)
+		}
+		block := b.Bytes()
+		binary.LittleEndian.PutUint16(block[16:], uint16(len(block) - 1))
+		out.Write(block)
+		if n == 0 {
+			break
+		}
+		data = data[n:]
+	}
+	return out.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	text := []byte(makeParallelTestIn(2000))
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(text)
+	gw.Close()
+	bgz := bgzfCompress(t, text, 5000)
+
+	for _, c := range []struct {
+		in []byte
+		comp Compression
+	} {
+		{text, NoCompression},
+		{gz.Bytes(), Gzip},
+		{bgz, Bgzip},
+	} {
+		if comp := DetectCompression(bufio.NewReader(bytes.NewReader(c.in))); comp != c.comp {
+			t.Errorf("detected %v instead of %v", comp, c.comp)
+		}
+		for _, threads := range []int{1, 4} {
+			r, e := Decompress(bytes.NewReader(c.in), threads)
+			if e != nil {
+				t.Fatal(e)
+			}
+			out, e := io.ReadAll(r)
+			if e != nil {
+				t.Fatal(e)
+			}
+			r.Close()
+			if !bytes.Equal(out, text) {
+				t.Errorf("%v with %v threads: decompressed output differs", c.comp, threads)
+			}
+		}
+	}
+
+	bgz[len(bgz) / 2] ^= 0xff
+	r, _ := Decompress(bytes.NewReader(bgz), 4)
+	if _, e := io.ReadAll(r); e == nil {
+		t.Errorf("corrupt bgzip input accepted")
+	}
+	r.Close()
+}
+
+func TestBgzfOutput(t *testing.T) {
+	text := sortPairsText(makeCacheTestIn(), false)
+	path := filepath.Join(t.TempDir(), "out.pairs.bgz")
+	comp, e := ParseOutputCompression("auto", path)
+	if e != nil || comp != Bgzip {
+		t.Fatalf("compression %v, error %v", comp, e)
+	}
+	w, e := CreateOutput(path, comp)
+	if e != nil {
+		t.Fatal(e)
+	}
+	io.WriteString(w, text[:1000])
+	io.WriteString(w, text[1000:])
+	if e = w.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	bgz, e := os.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !bytes.HasSuffix(bgz, bgzfEOF) || len(bgz) < 3 * len(bgzfEOF) {
+		t.Errorf("no end-of-file block")
+	}
+	r, e := Decompress(bytes.NewReader(bgz), 4)
+	if e != nil {
+		t.Fatal(e)
+	}
+	out, e := io.ReadAll(r)
+	r.Close()
+	if e != nil || string(out) != text {
+		t.Errorf("bgzip round trip differs, error %v", e)
+	}
+	idx, e := BuildPairsIndex(bytes.NewReader(bgz), false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(idx.Blocks) < 2 {
+		t.Errorf("output in %v blocks", len(idx.Blocks))
+	}
+}
+
+func TestZstdInputOutput(t *testing.T) {
+	if _, e := exec.LookPath("zstd"); e != nil {
+		t.Skip("zstd not installed")
+	}
+	path := filepath.Join(t.TempDir(), "out.zst")
+	comp, e := ParseOutputCompression("auto", path)
+	if e != nil || comp != Zstd {
+		t.Fatalf("compression %v, error %v", comp, e)
+	}
+	w, e := CreateOutput(path, comp)
+	if e != nil {
+		t.Fatal(e)
+	}
+	io.WriteString(w, gReorderedIn)
+	if e = w.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	r, e := OpenInput(path, 1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	out, e := io.ReadAll(r)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = r.Close(); e != nil {
+		t.Fatal(e)
+	}
+	if string(out) != gReorderedIn {
+		t.Errorf("zstd round trip gave %q", out)
+	}
+}
+
+func TestInputsWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 100
+	flags.WinStep = 50
+	flags.FullChroms = true
+	in1 := makeParallelTestIn(500)
+	in2 := makeParallelTestIn(300)
+
+	dir := t.TempDir()
+	var paths []string
+	for i, data := range [][]byte{[]byte(in1), bgzfCompress(t, []byte(in2), 1000)} {
+		path := filepath.Join(dir, []string{"a.pairs", "b.pairs.gz"}[i])
+		if e := os.WriteFile(path, data, 0644); e != nil {
+			t.Fatal(e)
+		}
+		paths = append(paths, path)
+	}
+
+	want, e := WinStats(flags, strings.NewReader(in1 + in2))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, threads := range []int{1, 3} {
+		flags.Threads = threads
+		in, e := OpenInputs(paths, threads)
+		if e != nil {
+			t.Fatal(e)
+		}
+		got, e := WinStats(flags, in)
+		in.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v threads: stats from two inputs differ from concatenated input", threads)
+		}
+	}
+}
@@ -3,20 +3,89 @@ package pairviz
 import (
 	"os"
 	"bufio"
+	"fmt"
+	"io"
 )
 
-func FullPairviz() {
-	w := bufio.NewWriter(os.Stdout)
-	defer w.Flush()
+// Calculate and write the statistics requested by flags for the .pairs data in r
+func RunPairviz(flags Flags, r io.Reader, w io.Writer) error {
+	if flags.Samples != "" {
+		samples, err := ReadSamplesPath(flags.Samples)
+		if err != nil {return err}
+		m, err := GetMatrixStats(flags, samples)
+		if err != nil {return err}
+		return FprintMatrix(w, m, flags.SeparateGenomes, flags.JsonOut)
+	} else if flags.Chromosome {
+		stats, err := ChromosomeStats(flags, r)
+		if err != nil {return err}
+		return FprintChromStats(w, stats, flags.SeparateGenomes, flags.ReadLen, flags.JsonOut)
+	} else if flags.Region != "" {
+		regions, err := GetRegionStatsInputs(flags, r)
+		if err != nil {return err}
+		return FprintRegionStats(w, regions, flags.SeparateGenomes, flags.ReadLen, flags.JsonOut)
+	}
+	stats, err := WinStats(flags, r)
+	if err != nil {return err}
+	return FprintWinStats(w, stats, flags.SeparateGenomes, flags.ReadLen, flags.JsonOut)
+}
 
+func FullPairviz() {
 	flags := GetFlags()
-	if flags.Chromosome {
-		FprintChromStats(w, ChromosomeStats(flags, os.Stdin))
-	} else if flags.Region != "" {
-		regions, err := GetRegionStats(flags, os.Stdin)
-		if err != nil {panic(err)}
-		FprintRegionStats(w, regions)
-	} else {
-		FprintWinStats(w, WinStats(flags, os.Stdin), flags.SeparateGenomes, flags.ReadLen, flags.JsonOut)
+	if err := runPairvizMain(flags); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runPairvizMain(flags Flags) error {
+	if len(flags.Analyses) > 0 {
+		return RunAnalyses(flags.Analyses)
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Samples == "" {
+		in, err := OpenInputs(flags.Inputs, flags.Threads)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		r = in
+	}
+	return runPairvizOutput(flags, r)
+}
+
+// Run one analysis of r, writing to its output and rejects files
+func runPairvizOutput(flags Flags, r io.Reader) (err error) {
+	closeRejects, err := flags.OpenRejecter()
+	if err != nil {return err}
+	defer func() {
+		if e := closeRejects(); err == nil && e != nil {
+			err = e
+		}
+	}()
+
+	var out io.WriteCloser = os.Stdout
+	if flags.OutPath != "" {
+		var comp Compression
+		if comp, err = ParseOutputCompression(flags.OutCompression, flags.OutPath); err != nil {
+			return err
+		}
+		if out, err = CreateOutput(flags.OutPath, comp); err != nil {
+			return err
+		}
+		defer func() {
+			if e := out.Close(); err == nil && e != nil {
+				err = e
+			}
+		}()
+	}
+
+	w := bufio.NewWriter(out)
+	if err = RunPairviz(flags, r, w); err != nil {
+		return err
+	}
+	if skipped := flags.Rejecter.Skipped(); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d malformed lines\n", skipped)
 	}
+	return w.Flush()
 }
@@ -0,0 +1,215 @@
+package pairviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+)
+
+// A named .pairs file
+type Sample struct {
+	Name string
+	Path string
+}
+
+// Read a tab-separated table of sample names and .pairs paths
+func ReadSamples(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	s := fasttsv.NewScanner(r)
+	lineno := int64(0)
+	for s.Scan() {
+		lineno++
+		line := s.Line()
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+		if len(line) < 2 {
+			return nil, fmt.Errorf("ReadSamples: %w", &ParseError{Line: lineno, Text: strings.Join(line, "\t"), Err: ErrShortLine})
+		}
+		samples = append(samples, Sample{Name: line[0], Path: line[1]})
+	}
+	if e := s.InScanner.Err(); e != nil {
+		return nil, fmt.Errorf("ReadSamples: %w", e)
+	}
+	return samples, nil
+}
+
+func ReadSamplesPath(path string) ([]Sample, error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return nil, fmt.Errorf("ReadSamplesPath: %w", e)
+	}
+	defer r.Close()
+	return ReadSamples(r)
+}
+
+// Window statistics for several samples, calculated with the same flags
+type MatrixStats struct {
+	Names []string
+	Stats []AllWinStats
+	WinSize int64
+	WinStep int64
+}
+
+func NewMatrixStats(flags Flags) MatrixStats {
+	return MatrixStats{WinSize: flags.WinSize, WinStep: flags.WinStep}
+}
+
+// Calculate the window statistics for one sample
+func (m *MatrixStats) AddSample(flags Flags, name string, r io.Reader) error {
+	flags.Name = name
+	stats, err := WinStats(flags, r)
+	if err != nil {
+		return fmt.Errorf("AddSample: %v: %w", name, err)
+	}
+	m.Names = append(m.Names, name)
+	m.Stats = append(m.Stats, stats)
+	return nil
+}
+
+// Calculate the window statistics for every sample
+func GetMatrixStats(flags Flags, samples []Sample) (MatrixStats, error) {
+	m := NewMatrixStats(flags)
+	for _, sample := range samples {
+		r, err := OpenInput(sample.Path, flags.Threads)
+		if err != nil {
+			return m, fmt.Errorf("GetMatrixStats: %w", err)
+		}
+		err = m.AddSample(flags, sample.Name, r)
+		r.Close()
+		if err != nil {
+			return m, fmt.Errorf("GetMatrixStats: %v: %w", sample.Path, err)
+		}
+	}
+	return m, nil
+}
+
+// The windows shared by all samples for one set of Hits: chromosomes in
+// sorted order, each extended to the longest chromosome in any sample
+type matrixLayout struct {
+	Chroms []string
+	NumWins map[string]int
+	Spans Hits
+	SampleHits []*Hits
+}
+
+func newMatrixLayout(m *MatrixStats, hits func(*AllWinStats) *Hits) matrixLayout {
+	var l matrixLayout
+	l.NumWins = map[string]int{}
+	l.Spans.Init(m.WinSize, m.WinStep)
+	for i, _ := range m.Stats {
+		h := hits(&m.Stats[i])
+		l.SampleHits = append(l.SampleHits, h)
+		for chrom, wins := range h.Hits {
+			if len(*wins) > l.NumWins[chrom] {
+				l.NumWins[chrom] = len(*wins)
+			}
+		}
+		for chrom, chromlen := range h.ChromLens {
+			l.Spans.SetChromLen(chrom, chromlen)
+		}
+	}
+	l.Chroms = sortedKeys(l.NumWins)
+	return l
+}
+
+// The genomes present in any sample, in sorted order
+func (m *MatrixStats) Genomes() []string {
+	genomes := map[string]struct{}{}
+	for _, stats := range m.Stats {
+		for genome, _ := range stats.GenomeHits.Ghits {
+			genomes[genome] = struct{}{}
+		}
+	}
+	return sortedKeys(genomes)
+}
+
+// Get the Hits for one genome without adding it to stats
+func genomeHitsOrEmpty(stats *AllWinStats, genome string) *Hits {
+	if h, ok := stats.GenomeHits.Ghits[genome]; ok {
+		return h
+	}
+	var h Hits
+	h.Init(stats.Hits.WinSize, stats.Hits.WinStep)
+	return &h
+}
+
+// Write the statistics for every sample, either as a wide table or as long
+// JSON records with one record per sample per window
+func FprintMatrix(w io.Writer, m MatrixStats, separategenomes bool, jsonOut bool) error {
+	if jsonOut {
+		return FprintMatrixJson(w, m)
+	}
+	FprintMatrixPlain(w, m, separategenomes)
+	return nil
+}
+
+// Write the statistics for every genome, window, and sample as JSON
+func FprintMatrixJson(w io.Writer, m MatrixStats) error {
+	enc := json.NewEncoder(w)
+	for _, genome := range m.Genomes() {
+		l := newMatrixLayout(&m, func(stats *AllWinStats) *Hits { return genomeHitsOrEmpty(stats, genome) })
+		for _, chrom := range l.Chroms {
+			for index := 0; index < l.NumWins[chrom]; index++ {
+				start, end := l.Spans.WinSpan(chrom, int64(index))
+				for i, _ := range m.Stats {
+					win := l.SampleHits[i].Win(chrom, index)
+					j := MakeJsonOutStat(genome, chrom, m.Names[i], m.Stats[i].ReadTotals, start, end, m.WinSize, m.WinStep, win)
+					if err := enc.Encode(j); err != nil {
+						return fmt.Errorf("FprintMatrixJson: %w", err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Write the window coordinates followed by the hits and proportions of each
+// sample, optionally with separate rows for each genome
+func FprintMatrixPlain(w io.Writer, m MatrixStats, separategenomes bool) {
+	fpkm := len(m.Stats) > 0 && m.Stats[0].Fpkm
+	fmt.Fprint(w, "chrom\tstart\tend\twinsize\twinstep")
+	for _, name := range m.Names {
+		fmt.Fprintf(w, "\t%s_hits\t%s_alt_hits\t%s_pair_prop\t%s_pair_totgoodprop", name, name, name, name)
+		if fpkm {
+			fmt.Fprintf(w, "\t%s_pair_fpkm\t%s_alt_fpkm", name, name)
+		}
+	}
+	fmt.Fprintln(w, "")
+
+	fprintRows := func(label string, hits func(*AllWinStats) *Hits) {
+		l := newMatrixLayout(&m, hits)
+		for _, chrom := range l.Chroms {
+			for index := 0; index < l.NumWins[chrom]; index++ {
+				start, end := l.Spans.WinSpan(chrom, int64(index))
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d", chrom + label, start, end, m.WinSize, m.WinStep)
+				for i, _ := range m.Stats {
+					stats := &m.Stats[i]
+					win := l.SampleHits[i].Win(chrom, index)
+					fmt.Fprintf(w, "\t%d\t%d\t%.8g\t%.8g",
+						win.PairHits,
+						win.SelfHits,
+						float64(win.PairHits) / (float64(win.PairHits) + float64(win.SelfHits)),
+						float64(win.PairHits) / float64(stats.TotalGoodReads),
+					)
+					if fpkm {
+						fmt.Fprintf(w, "\t%.8g\t%.8g", win.PairFpkm, win.SelfFpkm)
+					}
+				}
+				fmt.Fprintln(w, "")
+			}
+		}
+	}
+
+	if !separategenomes {
+		fprintRows("", func(stats *AllWinStats) *Hits { return &stats.Hits })
+		return
+	}
+	for _, genome := range m.Genomes() {
+		fprintRows("_" + genome, func(stats *AllWinStats) *Hits { return genomeHitsOrEmpty(stats, genome) })
+	}
+}
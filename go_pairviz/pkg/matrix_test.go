@@ -0,0 +1,57 @@
+package pairviz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const gMatrixIn1 = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_ISO1	3	+	-	UU
+r2	4_ISO1	2	4_W501	8	+	-	UU
+`
+
+const gMatrixIn2 = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	25	X_W501	27	+	-	UU
+`
+
+func TestMatrix(t *testing.T) {
+	samples, e := ReadSamples(strings.NewReader("# name\tpath\na\ta.pairs\nb\tb.pairs.gz\n"))
+	if e != nil || len(samples) != 2 || samples[1].Path != "b.pairs.gz" {
+		t.Fatalf("samples %v, error %v", samples, e)
+	}
+
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+	m := NewMatrixStats(flags)
+	if e := m.AddSample(flags, "a", strings.NewReader(gMatrixIn1)); e != nil {
+		t.Fatal(e)
+	}
+	if e := m.AddSample(flags, "b", strings.NewReader(gMatrixIn2)); e != nil {
+		t.Fatal(e)
+	}
+
+	var buf bytes.Buffer
+	FprintMatrixPlain(&buf, m, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string {
+		"chrom\tstart\tend\twinsize\twinstep\ta_hits\ta_alt_hits\ta_pair_prop\ta_pair_totgoodprop\ta_pair_fpkm\ta_alt_fpkm\tb_hits\tb_alt_hits\tb_pair_prop\tb_pair_totgoodprop\tb_pair_fpkm\tb_alt_fpkm",
+		"4\t0\t10\t10\t10\t2\t0\t1\t1\t",
+		"X\t0\t10\t10\t10\t0\t2\t0\t0\t",
+		"X\t10\t20\t10\t10\t0\t0\tNaN\t0\t",
+		"X\t20\t30\t10\t10\t0\t0\tNaN\t0\t",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("matrix output wrong:\n%v", buf.String())
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %v %q does not start with %q", i, lines[i], prefix)
+		}
+	}
+	if !strings.HasSuffix(lines[4], "\t2\t0\t1\t2\t2e+08\t0") {
+		t.Errorf("sample b in line %q wrong", lines[4])
+	}
+}
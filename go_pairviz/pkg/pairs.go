@@ -0,0 +1,323 @@
+package pairviz
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
+)
+
+var ErrMissingColumn = errors.New("Missing required column")
+
+// The indices of the .pairs columns used by pairviz. Optional columns that
+// are absent from the file are set to -1.
+type PairsColumns struct {
+	ReadID int
+	Chrom1 int
+	Pos1 int
+	Chrom2 int
+	Pos2 int
+	Strand1 int
+	Strand2 int
+	PairType int
+}
+
+// The default 4DN .pairs column order, used when there is no #columns: header
+func DefaultPairsColumns() PairsColumns {
+	return PairsColumns {
+		ReadID: 0,
+		Chrom1: 1,
+		Pos1: 2,
+		Chrom2: 3,
+		Pos2: 4,
+		Strand1: 5,
+		Strand2: 6,
+		PairType: 7,
+	}
+}
+
+// Build a column map from a "#columns: readID chrom1 pos1 ..." header line
+func ParseColumnsHeader(header string) (PairsColumns, error) {
+	cols := PairsColumns{-1, -1, -1, -1, -1, -1, -1, -1}
+	names := strings.Fields(strings.TrimPrefix(header, "#columns:"))
+	for i, name := range names {
+		switch name {
+		case "readID": cols.ReadID = i
+		case "chrom1": cols.Chrom1 = i
+		case "pos1": cols.Pos1 = i
+		case "chrom2": cols.Chrom2 = i
+		case "pos2": cols.Pos2 = i
+		case "strand1": cols.Strand1 = i
+		case "strand2": cols.Strand2 = i
+		case "pair_type": cols.PairType = i
+		default:
+		}
+	}
+
+	var missing []string
+	required := []struct {
+		name string
+		idx int
+	} {
+		{"chrom1", cols.Chrom1},
+		{"pos1", cols.Pos1},
+		{"chrom2", cols.Chrom2},
+		{"pos2", cols.Pos2},
+		{"strand1", cols.Strand1},
+		{"strand2", cols.Strand2},
+	}
+	for _, r := range required {
+		if r.idx == -1 {
+			missing = append(missing, r.name)
+		}
+	}
+	if len(missing) > 0 {
+		return cols, fmt.Errorf("ParseColumnsHeader: header %q: %v: %w", header, strings.Join(missing, ", "), ErrMissingColumn)
+	}
+	return cols, nil
+}
+
+// The minimum number of fields a line needs to contain every required column
+func (c PairsColumns) MinLen() int {
+	max := c.Chrom1
+	for _, idx := range []int{c.Pos1, c.Chrom2, c.Pos2, c.Strand1, c.Strand2} {
+		if idx > max {
+			max = idx
+		}
+	}
+	return max + 1
+}
+
+// Parse a .pairs line into a read pair using the specified column map and
+// contig naming scheme
+func ParsePairCols(line []string, cols PairsColumns, res parents.Resolver) (pair Pair, err error) {
+	if len(line) < cols.MinLen() {
+		return pair, fmt.Errorf("ParsePairCols: %d < %d columns: %w", len(line), cols.MinLen(), ErrShortLine)
+	}
+	pair.Read1, err = ParseReadResolve([]string{line[cols.Chrom1], line[cols.Pos1], line[cols.Strand1]}, res)
+	if err != nil {
+		return pair, fmt.Errorf("ParsePairCols: read 1: %w", err)
+	}
+	pair.Read2, err = ParseReadResolve([]string{line[cols.Chrom2], line[cols.Pos2], line[cols.Strand2]}, res)
+	if err != nil {
+		return pair, fmt.Errorf("ParsePairCols: read 2: %w", err)
+	}
+	return pair, nil
+}
+
+// Check if the read pair is correctly aligned using the specified column map
+func CheckGoodCols(line []string, cols PairsColumns) bool {
+	if len(line) <= cols.Chrom1 { return false }
+	return line[cols.Chrom1] != "!"
+}
+
+// A source of read pairs: a text .pairs file or a binary pairs cache
+type PairScanner interface {
+	// Advance to the next pair
+	Scan() bool
+	// Parse the current pair; malformed pairs are rejected and ok is false
+	Pair() (pair Pair, ok bool)
+	// Check if the current pair is correctly aligned and has an accepted
+	// pair type
+	Good() bool
+	// Check if the current pair has an accepted pair type
+	Accepted() bool
+	// The first error encountered while reading, if any
+	Err() error
+	// The contig lengths from the "#chromsize:" header lines
+	ChromSizes() (map[string]int64, error)
+	// The contig naming scheme used to resolve chromosomes and parents
+	ContigResolver() parents.Resolver
+}
+
+// Make a PairScanner for r, which may be a text .pairs file or a binary
+// pairs cache made by ConvertPairs. Each of several Inputs gets its own
+// scanner.
+func NewPairScanner(flags Flags, r io.Reader) (PairScanner, error) {
+	if in, ok := r.(*Inputs); ok && len(in.Readers) > 1 {
+		m := &multiScanner{names: in.Names}
+		for _, ir := range in.Readers {
+			s, err := NewPairScanner(flags, ir)
+			if err != nil {
+				return nil, err
+			}
+			m.scanners = append(m.scanners, s)
+		}
+		return m, nil
+	}
+	br := bufio.NewReader(r)
+	if IsPairsCache(br) {
+		return NewCacheReaderFlags(flags, br)
+	}
+	return NewPairsReaderFlags(flags, br)
+}
+
+// Scans several inputs one after another
+type multiScanner struct {
+	names []string
+	scanners []PairScanner
+	i int
+	err error
+}
+
+func (m *multiScanner) Scan() bool {
+	for m.err == nil && m.i < len(m.scanners) {
+		s := m.scanners[m.i]
+		if s.Scan() {
+			return true
+		}
+		if err := s.Err(); err != nil {
+			m.err = fmt.Errorf("%v: %w", m.names[m.i], err)
+			return false
+		}
+		m.i++
+	}
+	return false
+}
+
+// The scanner of the current input
+func (m *multiScanner) current() PairScanner {
+	return m.scanners[m.i]
+}
+
+func (m *multiScanner) Pair() (Pair, bool) {
+	return m.scanners[m.i].Pair()
+}
+
+func (m *multiScanner) Good() bool {
+	return m.scanners[m.i].Good()
+}
+
+func (m *multiScanner) Accepted() bool {
+	return m.scanners[m.i].Accepted()
+}
+
+func (m *multiScanner) Err() error {
+	return m.err
+}
+
+// The contig lengths of all inputs, keeping the longest length of each contig
+func (m *multiScanner) ChromSizes() (map[string]int64, error) {
+	sizes := map[string]int64{}
+	for i, s := range m.scanners {
+		ssizes, err := s.ChromSizes()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", m.names[i], err)
+		}
+		for contig, size := range ssizes {
+			setMaxLen(sizes, contig, size)
+		}
+	}
+	return sizes, nil
+}
+
+func (m *multiScanner) ContigResolver() parents.Resolver {
+	return m.scanners[0].ContigResolver()
+}
+
+// A .pairs reader that skips header lines and maps data columns according to
+// the #columns: header, falling back to the 4DN default order. Lines that
+// cannot be parsed are handled by Rejecter.
+type PairsReader struct {
+	s *fasttsv.Scanner
+	Cols PairsColumns
+	Resolver parents.Resolver
+	Rejecter *Rejecter
+	PairTypes PairTypeSet
+	Header []string
+	LineNum int64
+	err error
+}
+
+func NewPairsReader(r io.Reader) *PairsReader {
+	return &PairsReader{s: fasttsv.NewScanner(r), Cols: DefaultPairsColumns(), Resolver: parents.Default()}
+}
+
+// Make a PairsReader that uses the contig naming scheme specified in flags
+func NewPairsReaderFlags(flags Flags, r io.Reader) (*PairsReader, error) {
+	res, err := flags.Resolver()
+	if err != nil {
+		return nil, err
+	}
+	pr := NewPairsReader(r)
+	pr.Resolver = res
+	pr.Rejecter = flags.Rejecter
+	pr.PairTypes = flags.AcceptTypes
+	return pr, nil
+}
+
+// Advance to the next data line, recording any header lines along the way
+func (p *PairsReader) Scan() bool {
+	if p.err != nil {
+		return false
+	}
+	for p.s.Scan() {
+		p.LineNum++
+		line := p.s.Line()
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line[0], "#") {
+			text := p.s.InScanner.Text()
+			p.Header = append(p.Header, text)
+			if strings.HasPrefix(text, "#columns:") {
+				p.Cols, p.err = ParseColumnsHeader(text)
+				if p.err != nil {
+					return false
+				}
+			}
+			continue
+		}
+		return true
+	}
+	p.err = p.s.InScanner.Err()
+	return false
+}
+
+// The contig naming scheme used by this reader
+func (p *PairsReader) ContigResolver() parents.Resolver {
+	return p.Resolver
+}
+
+// The current data line
+func (p *PairsReader) Line() []string {
+	return p.s.Line()
+}
+
+// The first error encountered while reading, if any
+func (p *PairsReader) Err() error {
+	return p.err
+}
+
+// Parse the current data line into a read pair. If the line is malformed,
+// it is passed to the Rejecter and ok is false; if the Rejecter fails on it,
+// the error is returned by Err and scanning stops.
+func (p *PairsReader) Pair() (pair Pair, ok bool) {
+	pair, err := ParsePairCols(p.Line(), p.Cols, p.Resolver)
+	if err != nil {
+		p.Reject(err)
+		return pair, false
+	}
+	return pair, true
+}
+
+// Pass the current line to the Rejecter with the error err
+func (p *PairsReader) Reject(err error) {
+	if e := p.Rejecter.Reject(p.LineNum, p.Line(), err); e != nil && p.err == nil {
+		p.err = e
+	}
+}
+
+// Check if the current data line is correctly aligned and has an accepted
+// pair type
+func (p *PairsReader) Good() bool {
+	return CheckGoodTypes(p.Line(), p.Cols, p.PairTypes)
+}
+
+// Check if the current data line has an accepted pair type
+func (p *PairsReader) Accepted() bool {
+	return p.PairTypes.AcceptsLine(p.Line(), p.Cols)
+}
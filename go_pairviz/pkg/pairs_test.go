@@ -0,0 +1,73 @@
+package pairviz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const gReorderedIn = `## pairs format v1.0.0
+#columns: readID chrom1 pos1 chrom2 pos2 mapq1 mapq2 strand2 strand1 pair_type
+r1	X_ISO1	5	X_W501	60	60	60	-	+	UU
+r2	!	0	X_W501	7	0	60	+	-	NU
+`
+
+func TestParseColumnsHeader(t *testing.T) {
+	cols, e := ParseColumnsHeader("#columns: readID chrom1 pos1 chrom2 pos2 mapq1 mapq2 strand2 strand1 pair_type")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if cols.Strand1 != 8 || cols.Strand2 != 7 || cols.PairType != 9 {
+		t.Errorf("cols %v has wrong strand or pair_type indices", cols)
+	}
+	if cols.MinLen() != 9 {
+		t.Errorf("MinLen %v != 9", cols.MinLen())
+	}
+
+	_, e = ParseColumnsHeader("#columns: readID chrom1 pos1 chrom2 strand1 strand2")
+	if !errors.Is(e, ErrMissingColumn) {
+		t.Errorf("missing pos2 gave error %v", e)
+	}
+}
+
+func TestPairsReader(t *testing.T) {
+	pr := NewPairsReader(strings.NewReader(gReorderedIn))
+	var pairs []Pair
+	good := 0
+	for pr.Scan() {
+		if pr.Good() {
+			good++
+		}
+		pair, ok := pr.Pair()
+		if !ok {
+			t.Errorf("line %v not parsed", pr.Line())
+		}
+		pairs = append(pairs, pair)
+	}
+	if e := pr.Err(); e != nil {
+		t.Fatal(e)
+	}
+	if len(pr.Header) != 2 {
+		t.Errorf("len(Header) %v != 2", len(pr.Header))
+	}
+	if len(pairs) != 2 || good != 1 {
+		t.Fatalf("len(pairs) %v; good %v", len(pairs), good)
+	}
+	r1, r2 := pairs[0].Read1, pairs[0].Read2
+	if r1.Chrom != "X" || r1.Parent != "ISO1" || r1.Pos != 5 || r1.Dir != 1 {
+		t.Errorf("read1 %v wrong", r1)
+	}
+	if r2.Parent != "W501" || r2.Pos != 60 || r2.Dir != -1 {
+		t.Errorf("read2 %v wrong", r2)
+	}
+}
+
+func TestPairsReaderMissingColumn(t *testing.T) {
+	in := "#columns: readID chrom1 pos1 chrom2 pos2\nr1\tX_ISO1\t5\tX_W501\t6\n"
+	pr := NewPairsReader(strings.NewReader(in))
+	for pr.Scan() {
+	}
+	if !errors.Is(pr.Err(), ErrMissingColumn) {
+		t.Errorf("error %v is not ErrMissingColumn", pr.Err())
+	}
+}
@@ -0,0 +1,732 @@
+package pairviz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
+)
+
+var ErrUnsortedPairs = errors.New("Pairs file is not sorted")
+var ErrPairsIndex = errors.New("Bad pairs index")
+var ErrBadQuery = errors.New("Bad query region")
+
+// The extension of the index file kept next to an indexed .pairs file
+const PairsIndexExt = ".pvi"
+
+const pairsIndexVersion = 2
+
+// Positions are indexed in windows of 1<<pairsIndexShift bp, as in tabix
+const pairsIndexShift = 14
+
+// A bgzip virtual offset: the file offset of a block shifted left 16 bits,
+// plus the offset of a position within the decompressed block
+type VirtualOffset = uint64
+
+// A range of records in a bgzipped file, from the start of the first record
+// to the end of the last
+type IndexChunk struct {
+	Begin VirtualOffset
+	End VirtualOffset
+}
+
+// The records of a sorted .pairs file with one chrom1, or one chrom1 and
+// chrom2 pair in a two-dimensional index
+type IndexKey struct {
+	Chrom1 string
+	Chrom2 string
+	Start VirtualOffset
+	End VirtualOffset
+	// The first record with pos1 in or after each window
+	Linear []VirtualOffset
+	// The chunks holding records with each chrom2 and pos2 window
+	Pos2 map[string]map[int64][]IndexChunk
+}
+
+// Read totals for one pair type, so that indexed queries can report the same
+// totals as a full scan
+type IndexTypeStats struct {
+	Type string
+	// False for lines without a pair_type column
+	Typed bool
+	Count int64
+	// Lines with an unmapped read 1
+	Unmapped1 int64
+	// Every contig of either read, with "!" for unmapped reads
+	Contigs []string
+}
+
+// The first data line that starts in one bgzip block, so that the ordinal of
+// any indexed line can be found without reading the lines before it
+type IndexBlock struct {
+	// The file offset of the block
+	Offset int64
+	// The offset of the line in the decompressed block
+	Pos int
+	// The number of data lines before this one in the file
+	Ordinal int64
+}
+
+// A pairix-style index of a sorted, bgzipped .pairs file
+type PairsIndex struct {
+	Version int
+	TwoD bool
+	Shift uint
+	// The size of the indexed file, to detect stale indices
+	FileSize int64
+	Header []string
+	Keys []*IndexKey
+	Types []*IndexTypeStats
+	Blocks []IndexBlock
+}
+
+// Random access to the lines of a bgzipped file by virtual offset
+type bgzfSeeker struct {
+	f io.ReadSeeker
+	br *bufio.Reader
+	coff int64
+	next int64
+	data []byte
+	pos int
+}
+
+func newBgzfSeeker(f io.ReadSeeker) *bgzfSeeker {
+	return &bgzfSeeker{f: f, br: bufio.NewReaderSize(f, 1 << 16)}
+}
+
+// Read and decompress the next block
+func (b *bgzfSeeker) load() error {
+	block, err := readBgzfBlock(b.br)
+	if err != nil {
+		return err
+	}
+	if b.data, err = inflateBgzfBlock(block); err != nil {
+		return err
+	}
+	b.coff = b.next
+	b.next += int64(len(block))
+	b.pos = 0
+	return nil
+}
+
+// The virtual offset of the next unread byte; the end of a block is reported
+// as the start of the next block
+func (b *bgzfSeeker) Tell() VirtualOffset {
+	if b.pos >= len(b.data) {
+		return VirtualOffset(b.next) << 16
+	}
+	return VirtualOffset(b.coff) << 16 | VirtualOffset(b.pos)
+}
+
+func (b *bgzfSeeker) Seek(voff VirtualOffset) error {
+	coff := int64(voff >> 16)
+	if b.data == nil || coff != b.coff {
+		if _, err := b.f.Seek(coff, io.SeekStart); err != nil {
+			return err
+		}
+		b.br.Reset(b.f)
+		b.next = coff
+		b.data = nil
+		if err := b.load(); err != nil {
+			return err
+		}
+	}
+	b.pos = int(voff & 0xffff)
+	return nil
+}
+
+// Read the next line, without its newline
+func (b *bgzfSeeker) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		if b.pos >= len(b.data) {
+			if err := b.load(); err != nil {
+				if err == io.EOF && len(line) > 0 {
+					return line, nil
+				}
+				return nil, err
+			}
+			continue
+		}
+		i := bytes.IndexByte(b.data[b.pos:], '\n')
+		if i >= 0 {
+			line = append(line, b.data[b.pos:b.pos + i]...)
+			b.pos += i + 1
+			return line, nil
+		}
+		line = append(line, b.data[b.pos:]...)
+		b.pos = len(b.data)
+	}
+}
+
+// Record one pair in its key
+func (k *IndexKey) add(pos1 int64, chrom2 string, pos2 int64, begin, end VirtualOffset, shift uint) {
+	for w := int64(len(k.Linear)); w <= pos1 >> shift; w++ {
+		k.Linear = append(k.Linear, begin)
+	}
+	k.End = end
+
+	wins, ok := k.Pos2[chrom2]
+	if !ok {
+		wins = map[int64][]IndexChunk{}
+		k.Pos2[chrom2] = wins
+	}
+	w := pos2 >> shift
+	chunks := wins[w]
+	// Join records in the same block into one chunk, like tabix
+	if n := len(chunks); n > 0 && chunks[n-1].End >> 16 == begin >> 16 {
+		chunks[n-1].End = end
+		return
+	}
+	wins[w] = append(chunks, IndexChunk{begin, end})
+}
+
+// The chunk holding every record of k with pos1 in [start, end)
+func (k *IndexKey) Pos1Chunk(start, end int64, shift uint) IndexChunk {
+	ws := start >> shift
+	if start < 0 {
+		ws = 0
+	}
+	if ws >= int64(len(k.Linear)) || end <= start {
+		return IndexChunk{}
+	}
+	c := IndexChunk{k.Linear[ws], k.End}
+	if we := (end - 1) >> shift + 1; we < int64(len(k.Linear)) {
+		c.End = k.Linear[we]
+	}
+	return c
+}
+
+// The chunks of k holding every record with a chrom2 accepted by match and
+// pos2 in [start, end)
+func (k *IndexKey) Pos2Chunks(match func(chrom2 string) bool, start, end int64, shift uint, out []IndexChunk) []IndexChunk {
+	if end <= start {
+		return out
+	}
+	for chrom2, wins := range k.Pos2 {
+		if !match(chrom2) {
+			continue
+		}
+		for w := start >> shift; w <= (end - 1) >> shift; w++ {
+			out = append(out, wins[w]...)
+		}
+	}
+	return out
+}
+
+// Sort chunks and join overlapping ones, so that no record is read twice
+func MergeChunks(chunks []IndexChunk) []IndexChunk {
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Begin < chunks[j].Begin })
+	var out []IndexChunk
+	for _, c := range chunks {
+		if c.End <= c.Begin {
+			continue
+		}
+		if n := len(out); n > 0 && c.Begin <= out[n-1].End {
+			if c.End > out[n-1].End {
+				out[n-1].End = c.End
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Index a sorted, bgzipped .pairs file. The file must be sorted by chrom1
+// and pos1, or, for a two-dimensional index, by chrom1, chrom2, and pos1.
+func BuildPairsIndex(r io.ReadSeeker, twoD bool) (*PairsIndex, error) {
+	h := func(e error) error {
+		return fmt.Errorf("BuildPairsIndex: %w", e)
+	}
+	idx := &PairsIndex{Version: pairsIndexVersion, TwoD: twoD, Shift: pairsIndexShift}
+	s := newBgzfSeeker(r)
+	cols := DefaultPairsColumns()
+	var cur *IndexKey
+	var curName string
+	var lastPos1 int64
+	seen := map[string]bool{}
+	types := map[string]*IndexTypeStats{}
+	contigs := map[string]map[string]bool{}
+	lineno := int64(0)
+	ordinal := int64(0)
+
+	for {
+		begin := s.Tell()
+		bline, err := s.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, h(err)
+		}
+		lineno++
+		line := string(bline)
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if len(idx.Keys) > 0 {
+				return nil, h(&ParseError{Line: lineno, Text: line, Err: fmt.Errorf("header line after data: %w", ErrUnsortedPairs)})
+			}
+			idx.Header = append(idx.Header, line)
+			if strings.HasPrefix(line, "#columns:") {
+				if cols, err = ParseColumnsHeader(line); err != nil {
+					return nil, h(err)
+				}
+			}
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if _, err := ParsePairCols(fields, cols, parents.Default()); err != nil {
+			return nil, h(&ParseError{Line: lineno, Text: line, Err: err})
+		}
+		chrom1, chrom2 := fields[cols.Chrom1], fields[cols.Chrom2]
+		pos1, _ := strconv.ParseInt(fields[cols.Pos1], 10, 64)
+		pos2, _ := strconv.ParseInt(fields[cols.Pos2], 10, 64)
+		if chrom1 == "!" {
+			pos1 = 0
+		}
+		if chrom2 == "!" {
+			pos2 = 0
+		}
+
+		name := chrom1
+		if twoD {
+			name = chrom1 + "\t" + chrom2
+		}
+		if cur == nil || name != curName {
+			if seen[name] {
+				return nil, h(&ParseError{Line: lineno, Text: line, Err: ErrUnsortedPairs})
+			}
+			seen[name] = true
+			curName = name
+			cur = &IndexKey{Chrom1: chrom1, Start: begin, Pos2: map[string]map[int64][]IndexChunk{}}
+			if twoD {
+				cur.Chrom2 = chrom2
+			}
+			idx.Keys = append(idx.Keys, cur)
+		} else if pos1 < lastPos1 {
+			return nil, h(&ParseError{Line: lineno, Text: line, Err: ErrUnsortedPairs})
+		}
+		lastPos1 = pos1
+		cur.add(pos1, chrom2, pos2, begin, s.Tell(), idx.Shift)
+		if n := len(idx.Blocks); n == 0 || idx.Blocks[n-1].Offset != int64(begin >> 16) {
+			idx.Blocks = append(idx.Blocks, IndexBlock{int64(begin >> 16), int(begin & 0xffff), ordinal})
+		}
+		ordinal++
+
+		typed := cols.PairType >= 0 && cols.PairType < len(fields)
+		tkey := ""
+		if typed {
+			tkey = "\t" + fields[cols.PairType]
+		}
+		ts, ok := types[tkey]
+		if !ok {
+			ts = &IndexTypeStats{Typed: typed, Type: strings.TrimPrefix(tkey, "\t")}
+			types[tkey] = ts
+			contigs[tkey] = map[string]bool{}
+			idx.Types = append(idx.Types, ts)
+		}
+		ts.Count++
+		if chrom1 == "!" {
+			ts.Unmapped1++
+		}
+		contigs[tkey][chrom1] = true
+		contigs[tkey][chrom2] = true
+	}
+
+	for tkey, ts := range types {
+		for contig, _ := range contigs[tkey] {
+			ts.Contigs = append(ts.Contigs, contig)
+		}
+		sort.Strings(ts.Contigs)
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, h(err)
+	}
+	idx.FileSize = size
+	return idx, nil
+}
+
+// Write an index in its gzipped binary format
+func WritePairsIndex(w io.Writer, idx *PairsIndex) error {
+	gw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gw).Encode(idx); err != nil {
+		return fmt.Errorf("WritePairsIndex: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("WritePairsIndex: %w", err)
+	}
+	return nil
+}
+
+// Read an index written by WritePairsIndex
+func ReadPairsIndex(r io.Reader) (*PairsIndex, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPairsIndex: %w: %v", ErrPairsIndex, err)
+	}
+	idx := &PairsIndex{}
+	if err := gob.NewDecoder(gr).Decode(idx); err != nil {
+		return nil, fmt.Errorf("ReadPairsIndex: %w: %v", ErrPairsIndex, err)
+	}
+	if idx.Version != pairsIndexVersion {
+		return nil, fmt.Errorf("ReadPairsIndex: %w: version %v, not %v; index the file again", ErrPairsIndex, idx.Version, pairsIndexVersion)
+	}
+	return idx, nil
+}
+
+// Index the bgzipped .pairs file at path and write the index to path + ".pvi"
+func IndexPairsPath(path string, twoD bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("IndexPairsPath: %w", err)
+	}
+	defer f.Close()
+	idx, err := BuildPairsIndex(f, twoD)
+	if err != nil {
+		return fmt.Errorf("IndexPairsPath: %v: %w", path, err)
+	}
+	w, err := os.Create(path + PairsIndexExt)
+	if err != nil {
+		return fmt.Errorf("IndexPairsPath: %w", err)
+	}
+	err = WritePairsIndex(w, idx)
+	if e := w.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Open the index next to path. If there is none, ok is false. An index that
+// does not match the size of the file is an error.
+func OpenPairsIndex(path string) (idx *PairsIndex, ok bool, err error) {
+	f, err := os.Open(path + PairsIndexExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("OpenPairsIndex: %w", err)
+	}
+	defer f.Close()
+	if idx, err = ReadPairsIndex(f); err != nil {
+		return nil, false, fmt.Errorf("OpenPairsIndex: %v: %w", path + PairsIndexExt, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("OpenPairsIndex: %w", err)
+	}
+	if info.Size() != idx.FileSize {
+		return nil, false, fmt.Errorf("OpenPairsIndex: %v: %w: index is older than the file", path, ErrPairsIndex)
+	}
+	return idx, true, nil
+}
+
+// The ordinal of the data line at voff, where s has just seeked to voff
+func (idx *PairsIndex) ordinalAt(s *bgzfSeeker, voff VirtualOffset) (int64, error) {
+	coff, pos := int64(voff >> 16), int(voff & 0xffff)
+	i := sort.Search(len(idx.Blocks), func(i int) bool { return idx.Blocks[i].Offset >= coff })
+	if i == len(idx.Blocks) || idx.Blocks[i].Offset != coff || idx.Blocks[i].Pos > pos || pos > len(s.data) {
+		return 0, fmt.Errorf("ordinalAt: %w: no data line at offset %v", ErrPairsIndex, voff)
+	}
+	b := idx.Blocks[i]
+	ordinal := b.Ordinal
+	for start := b.Pos; start < pos; {
+		end := bytes.IndexByte(s.data[start:pos], '\n')
+		if end < 0 {
+			break
+		}
+		if end > 0 {
+			ordinal++
+		}
+		start += end + 1
+	}
+	return ordinal, nil
+}
+
+// The data lines read from one chunk
+type chunkRun struct {
+	// The number of data lines read before the chunk
+	Line int64
+	// The ordinal of the first data line of the chunk in the file
+	Ordinal int64
+}
+
+// Reads the header lines of an indexed file, then the data lines of each
+// chunk, keeping track of where in the file each data line came from
+type PairsChunkReader struct {
+	idx *PairsIndex
+	s *bgzfSeeker
+	header []string
+	chunks []IndexChunk
+	started bool
+	buf []byte
+	lines int64
+	runs []chunkRun
+}
+
+// Read the header and the records in chunks, which must be merged, as text
+func (idx *PairsIndex) ChunkReader(r io.ReadSeeker, chunks []IndexChunk) *PairsChunkReader {
+	return &PairsChunkReader{idx: idx, s: newBgzfSeeker(r), header: idx.Header, chunks: chunks}
+}
+
+// The ordinal in the indexed file of data line n of the chunks, counting
+// from 0; line n must already have been read
+func (c *PairsChunkReader) Ordinal(n int64) int64 {
+	i := sort.Search(len(c.runs), func(i int) bool { return c.runs[i].Line > n }) - 1
+	return c.runs[i].Ordinal + n - c.runs[i].Line
+}
+
+func (c *PairsChunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if len(c.header) > 0 {
+			c.buf = append(c.buf, c.header[0]...)
+			c.buf = append(c.buf, '\n')
+			c.header = c.header[1:]
+			continue
+		}
+		if len(c.chunks) == 0 {
+			return 0, io.EOF
+		}
+		if !c.started {
+			if err := c.s.Seek(c.chunks[0].Begin); err != nil {
+				return 0, fmt.Errorf("chunkReader: %w", err)
+			}
+			ordinal, err := c.idx.ordinalAt(c.s, c.chunks[0].Begin)
+			if err != nil {
+				return 0, fmt.Errorf("chunkReader: %w", err)
+			}
+			c.runs = append(c.runs, chunkRun{c.lines, ordinal})
+			c.started = true
+		}
+		if c.s.Tell() >= c.chunks[0].End {
+			c.chunks = c.chunks[1:]
+			c.started = false
+			continue
+		}
+		line, err := c.s.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("%w: chunk past end of file", ErrPairsIndex)
+			}
+			return 0, fmt.Errorf("chunkReader: %w", err)
+		}
+		if len(line) == 0 {
+			continue
+		}
+		c.lines++
+		c.buf = append(c.buf, line...)
+		c.buf = append(c.buf, '\n')
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// The chunks holding every same-chromosome pair with either read in one of
+// regions, with contigs resolved to chromosomes by res
+func (idx *PairsIndex) RegionChunks(regions []Region, res parents.Resolver) []IndexChunk {
+	byChrom := map[string][]Region{}
+	for _, r := range regions {
+		byChrom[r.Chrom] = append(byChrom[r.Chrom], r)
+	}
+	resolved := func(contig string) string {
+		if contig == "!" {
+			return ""
+		}
+		chrom, _ := res.Resolve(contig)
+		return chrom
+	}
+
+	var chunks []IndexChunk
+	for _, key := range idx.Keys {
+		chrom := resolved(key.Chrom1)
+		regs := byChrom[chrom]
+		if len(regs) == 0 || idx.TwoD && resolved(key.Chrom2) != chrom {
+			continue
+		}
+		same := func(chrom2 string) bool { return resolved(chrom2) == chrom }
+		for _, r := range regs {
+			chunks = append(chunks, key.Pos1Chunk(r.Start, r.End, idx.Shift))
+			chunks = key.Pos2Chunks(same, r.Start, r.End, idx.Shift, chunks)
+		}
+	}
+	return MergeChunks(chunks)
+}
+
+// The read totals and genomes that a full scan accepting types would find
+func (idx *PairsIndex) Totals(types PairTypeSet, res parents.Resolver) (total, good int64, genomes map[string]struct{}) {
+	genomes = map[string]struct{}{}
+	for _, ts := range idx.Types {
+		total += ts.Count
+		if ts.Typed && !types.Accepts(ts.Type) {
+			continue
+		}
+		good += ts.Count - ts.Unmapped1
+		for _, contig := range ts.Contigs {
+			if contig == "!" {
+				continue
+			}
+			_, parent := res.Resolve(contig)
+			genomes[parent] = struct{}{}
+		}
+	}
+	return total, good, genomes
+}
+
+// A query of an indexed file in pairix syntax: "contig:start-end", with
+// 1-based, inclusive coordinates, optionally followed by "|contig:start-end"
+// for read 2. A missing range covers the whole contig.
+type PairsQuery struct {
+	Chrom1 string
+	Start1, End1 int64
+	Chrom2 string
+	Start2, End2 int64
+}
+
+func parseQueryPart(s string) (chrom string, start, end int64, err error) {
+	chrom, rng, found := strings.Cut(s, ":")
+	start, end = 0, 1 << 62
+	if !found {
+		return chrom, start, end, nil
+	}
+	from, to, found := strings.Cut(rng, "-")
+	if start, err = strconv.ParseInt(strings.ReplaceAll(from, ",", ""), 10, 64); err != nil {
+		return
+	}
+	end = start
+	if found {
+		if end, err = strconv.ParseInt(strings.ReplaceAll(to, ",", ""), 10, 64); err != nil {
+			return
+		}
+	}
+	return chrom, start, end, nil
+}
+
+func ParsePairsQuery(s string) (q PairsQuery, err error) {
+	part1, part2, two := strings.Cut(s, "|")
+	if q.Chrom1, q.Start1, q.End1, err = parseQueryPart(part1); err != nil || q.Chrom1 == "" {
+		return q, fmt.Errorf("ParsePairsQuery: %q: %w", s, ErrBadQuery)
+	}
+	if two {
+		if q.Chrom2, q.Start2, q.End2, err = parseQueryPart(part2); err != nil || q.Chrom2 == "" {
+			return q, fmt.Errorf("ParsePairsQuery: %q: %w", s, ErrBadQuery)
+		}
+	}
+	return q, nil
+}
+
+// Check if a line matches the query
+func (q PairsQuery) Matches(fields []string, cols PairsColumns) bool {
+	if len(fields) < cols.MinLen() || fields[cols.Chrom1] != q.Chrom1 {
+		return false
+	}
+	pos1, err := strconv.ParseInt(fields[cols.Pos1], 10, 64)
+	if err != nil || pos1 < q.Start1 || pos1 > q.End1 {
+		return false
+	}
+	if q.Chrom2 == "" {
+		return true
+	}
+	pos2, err := strconv.ParseInt(fields[cols.Pos2], 10, 64)
+	return fields[cols.Chrom2] == q.Chrom2 && err == nil && pos2 >= q.Start2 && pos2 <= q.End2
+}
+
+// The chunks that may hold lines matching any of queries
+func (idx *PairsIndex) QueryChunks(queries []PairsQuery) []IndexChunk {
+	var chunks []IndexChunk
+	for _, key := range idx.Keys {
+		for _, q := range queries {
+			if key.Chrom1 != q.Chrom1 || idx.TwoD && q.Chrom2 != "" && key.Chrom2 != q.Chrom2 {
+				continue
+			}
+			chunks = append(chunks, key.Pos1Chunk(q.Start1, q.End1 + 1, idx.Shift))
+		}
+	}
+	return MergeChunks(chunks)
+}
+
+// Write the header and every line of the indexed file r that matches one of
+// queries, in file order
+func QueryPairs(w io.Writer, r io.ReadSeeker, idx *PairsIndex, queries []PairsQuery) error {
+	pr := NewPairsReader(idx.ChunkReader(r, idx.QueryChunks(queries)))
+	bw := bufio.NewWriter(w)
+	for _, line := range idx.Header {
+		fmt.Fprintln(bw, line)
+	}
+	for pr.Scan() {
+		for _, q := range queries {
+			if q.Matches(pr.Line(), pr.Cols) {
+				fmt.Fprintln(bw, strings.Join(pr.Line(), "\t"))
+				break
+			}
+		}
+	}
+	if err := pr.Err(); err != nil {
+		return fmt.Errorf("QueryPairs: %w", err)
+	}
+	return bw.Flush()
+}
+
+func FullQueryPairs() {
+	build := flag.Bool("index", false, "Build the index of the input instead of querying it")
+	twoD := flag.Bool("2d", false, "With -index, index by chrom1 and chrom2 for files sorted by chrom1, chrom2, and pos1")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: pairviz_query [-index [-2d]] input.pairs.gz [chrom1[:start-end][|chrom2[:start-end]] ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if *build {
+		if e := IndexPairsPath(path, *twoD); e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var queries []PairsQuery
+	for _, arg := range flag.Args()[1:] {
+		q, e := ParsePairsQuery(arg)
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(2)
+		}
+		queries = append(queries, q)
+	}
+	idx, ok, e := OpenPairsIndex(path)
+	if e == nil && !ok {
+		e = fmt.Errorf("%v: no index; build one with -index", path)
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	f, e := os.Open(path)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if e = QueryPairs(os.Stdout, f, idx, queries); e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,151 @@
+package pairviz
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Sort the data lines of a .pairs file by chrom1 and pos1, or by chrom1,
+// chrom2, and pos1
+func sortPairsText(in string, twoD bool) string {
+	var header, data []string
+	for _, line := range strings.Split(strings.TrimSuffix(in, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			header = append(header, line)
+		} else {
+			data = append(data, line)
+		}
+	}
+	key := func(line string) (string, int) {
+		f := strings.Split(line, "\t")
+		pos, _ := strconv.Atoi(f[2])
+		if twoD {
+			return f[1] + "\t" + f[3], pos
+		}
+		return f[1], pos
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		ki, pi := key(data[i])
+		kj, pj := key(data[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return pi < pj
+	})
+	return strings.Join(append(header, data...), "\n") + "\n"
+}
+
+func TestPairsIndexRegions(t *testing.T) {
+	flags := gFlags
+	flags.Orient = true
+	flags.BootReps = 20
+	dir := t.TempDir()
+	flags.Region = filepath.Join(dir, "regions.bed")
+	if e := os.WriteFile(flags.Region, []byte("X\t100\t900\nX\t2000\t2500\tpeak\nX\t2400\t2410\n2L\t0\t50\n3R\t0\t10\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	for _, twoD := range []bool{false, true} {
+		in := sortPairsText(makeCacheTestIn(), twoD)
+		bgz := bgzfCompress(t, []byte(in), 3000)
+		idx, e := BuildPairsIndex(bytes.NewReader(bgz), twoD)
+		if e != nil {
+			t.Fatal(e)
+		}
+
+		var buf bytes.Buffer
+		if e = WritePairsIndex(&buf, idx); e != nil {
+			t.Fatal(e)
+		}
+		if idx, e = ReadPairsIndex(&buf); e != nil {
+			t.Fatal(e)
+		}
+
+		for _, types := range []string{"UU,UR,RU", "all"} {
+			flags.AcceptTypes, _ = ParsePairTypes(types)
+			want, e := GetRegionStats(flags, strings.NewReader(in))
+			if e != nil {
+				t.Fatal(e)
+			}
+			got, e := GetRegionStatsIndexed(flags, bytes.NewReader(bgz), idx)
+			if e != nil {
+				t.Fatal(e)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("2D %v, types %v: indexed region stats differ:\n%v\n%v", twoD, types, got, want)
+			}
+			if len(got.Regions[0].Boot) != flags.BootReps {
+				t.Errorf("2D %v, types %v: region not bootstrapped", twoD, types)
+			}
+			if len(got.Genomes) != 2 || got.Genomes[0] != "ISO1" {
+				t.Errorf("2D %v, types %v: wrong genomes %q", twoD, types, got.Genomes)
+			}
+		}
+	}
+
+	unsorted := bgzfCompress(t, []byte(makeCacheTestIn()), 3000)
+	if _, e := BuildPairsIndex(bytes.NewReader(unsorted), false); e == nil {
+		t.Errorf("unsorted input indexed")
+	}
+}
+
+func TestQueryPairs(t *testing.T) {
+	in := sortPairsText(makeCacheTestIn(), true)
+	path := filepath.Join(t.TempDir(), "in.pairs.gz")
+	if e := os.WriteFile(path, bgzfCompress(t, []byte(in), 2000), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if e := IndexPairsPath(path, true); e != nil {
+		t.Fatal(e)
+	}
+	idx, ok, e := OpenPairsIndex(path)
+	if e != nil || !ok {
+		t.Fatalf("index not opened: %v", e)
+	}
+
+	var queries []PairsQuery
+	for _, s := range []string{"X_ISO1:1000-1999", "X_W501:500-600|X_ISO1", "2L_ISO1", "X_W501:1,000-1,100|X_W501:0-3000"} {
+		q, e := ParsePairsQuery(s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		queries = append(queries, q)
+	}
+	want := ""
+	pr := NewPairsReader(strings.NewReader(in))
+	for pr.Scan() {
+		for _, q := range queries {
+			if q.Matches(pr.Line(), pr.Cols) {
+				want += strings.Join(pr.Line(), "\t") + "\n"
+				break
+			}
+		}
+	}
+	if strings.Count(want, "\n") < 100 {
+		t.Fatalf("too few test lines: %v", strings.Count(want, "\n"))
+	}
+
+	f, e := os.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer f.Close()
+	var out bytes.Buffer
+	if e = QueryPairs(&out, f, idx, queries); e != nil {
+		t.Fatal(e)
+	}
+	header := strings.Join(idx.Header, "\n") + "\n"
+	if out.String() != header + want {
+		t.Errorf("query output differs: %v lines vs %v", strings.Count(out.String(), "\n"), strings.Count(header + want, "\n"))
+	}
+
+	if _, e = ParsePairsQuery("X_ISO1:a-b"); e == nil {
+		t.Errorf("bad query accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package pairviz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadPairType = errors.New("Invalid pair type")
+
+// The pairtools pair_type codes that are counted. A nil set accepts every
+// pair type.
+type PairTypeSet map[string]struct{}
+
+// The pair types counted by default: unique and rescued pairs
+const DefaultPairTypes = "UU,UR,RU"
+
+// The letters used in pairtools pair_type codes
+const pairTypeLetters = "UMNRXDW"
+
+// Parse a comma-separated list of pair types; "" or "all" accepts every type
+func ParsePairTypes(s string) (PairTypeSet, error) {
+	if s == "" || s == "all" {
+		return nil, nil
+	}
+	types := PairTypeSet{}
+	for _, code := range strings.Split(s, ",") {
+		code = strings.TrimSpace(code)
+		if len(code) != 2 || !strings.ContainsRune(pairTypeLetters, rune(code[0])) || !strings.ContainsRune(pairTypeLetters, rune(code[1])) {
+			return nil, fmt.Errorf("ParsePairTypes: %q: %w", code, ErrBadPairType)
+		}
+		types[code] = struct{}{}
+	}
+	return types, nil
+}
+
+// Check if a pair type is accepted
+func (t PairTypeSet) Accepts(code string) bool {
+	if t == nil {
+		return true
+	}
+	_, ok := t[code]
+	return ok
+}
+
+// Check if the pair type of a line is accepted; lines without a pair_type
+// column are always accepted
+func (t PairTypeSet) AcceptsLine(line []string, cols PairsColumns) bool {
+	if cols.PairType < 0 || cols.PairType >= len(line) {
+		return true
+	}
+	return t.Accepts(line[cols.PairType])
+}
+
+// Check if a line is correctly aligned and has an accepted pair type
+func CheckGoodTypes(line []string, cols PairsColumns, types PairTypeSet) bool {
+	return CheckGoodCols(line, cols) && types.AcceptsLine(line, cols)
+}
@@ -0,0 +1,55 @@
+package pairviz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const gPairTypeIn = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	X_ISO1	3	+	-	UU
+r2	X_ISO1	2	X_W501	8	+	-	MU
+r3	X_ISO1	4	X_W501	5	+	-	RU
+r4	!	0	X_ISO1	5	-	+	NU
+`
+
+func TestParsePairTypes(t *testing.T) {
+	types, e := ParsePairTypes(DefaultPairTypes)
+	if e != nil || len(types) != 3 || !types.Accepts("UR") || types.Accepts("MU") {
+		t.Errorf("types %v, error %v", types, e)
+	}
+	if types, e := ParsePairTypes("all"); e != nil || !types.Accepts("WW") {
+		t.Errorf("all gave types %v, error %v", types, e)
+	}
+	if _, e := ParsePairTypes("UU,UQ"); !errors.Is(e, ErrBadPairType) {
+		t.Errorf("UQ gave error %v", e)
+	}
+}
+
+func TestPairTypeWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+	flags.AcceptTypes, _ = ParsePairTypes(DefaultPairTypes)
+
+	stats, e := WinStats(flags, strings.NewReader(gPairTypeIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+	x := (*stats.Hits.Hits["X"])[0]
+	if x.SelfHits != 2 || x.PairHits != 2 {
+		t.Errorf("hits %v wrong", x)
+	}
+	if stats.TotalReads != 4 || stats.TotalGoodReads != 2 {
+		t.Errorf("totals %v wrong", stats.ReadTotals)
+	}
+
+	cstats, e := ChromosomeStats(flags, strings.NewReader(gPairTypeIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if cx := cstats.Hits["X"]; cstats.ReadTotals != stats.ReadTotals || cx.SelfHits != x.SelfHits || cx.PairHits != x.PairHits {
+		t.Errorf("chromosome stats %v, %v differ from window stats", cstats.ReadTotals, *cstats.Hits["X"])
+	}
+}
@@ -0,0 +1,208 @@
+package pairviz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"golang.org/x/sync/errgroup"
+)
+
+// The number of .pairs lines handed to a worker at a time
+const ParallelChunkSize = 16384
+
+// A batch of .pairs data lines from one input, their line numbers, and the
+// reader and column map that apply to them, or a batch of pairs that are
+// already parsed
+type pairsChunk struct {
+	Lines [][]string
+	LineNums []int64
+	Reader *PairsReader
+	Cols PairsColumns
+	Pairs []scannedPair
+	// The ordinal of the first line or pair in the input
+	First int64
+}
+
+// A pair read from a PairScanner, with its Good result; Accepted is only true
+// if the pair type is accepted and the pair is well formed
+type scannedPair struct {
+	Pair Pair
+	Good bool
+	Accepted bool
+}
+
+// Add the hit counts of another set of windows to this one
+func (h *HitSet) Add(o HitSet) {
+	h.SelfHits += o.SelfHits
+	h.PairHits += o.PairHits
+	h.OvlHits += o.OvlHits
+	h.NonOvlHits += o.NonOvlHits
+	h.TransSelfHits += o.TransSelfHits
+	h.TransPairHits += o.TransPairHits
+	h.SelfInHits += o.SelfInHits
+	h.SelfOutHits += o.SelfOutHits
+	h.SelfMatchHits += o.SelfMatchHits
+	h.PairInHits += o.PairInHits
+	h.PairOutHits += o.PairOutHits
+	h.PairMatchHits += o.PairMatchHits
+}
+
+// Add the hit counts of another list of windows to this one, growing it as needed
+func (h WinHitList) Add(o WinHitList) WinHitList {
+	for len(h) < len(o) {
+		h = append(h, HitSet{})
+	}
+	for i, win := range o {
+		h[i].Add(win)
+	}
+	return h
+}
+
+// Add all hits and chromosome lengths from o into h
+func (h *Hits) Merge(o *Hits) {
+	for chrom, wins := range o.Hits {
+		if _, ok := h.Hits[chrom]; !ok {
+			h.Hits[chrom] = new(WinHitList)
+		}
+		*h.Hits[chrom] = (*h.Hits[chrom]).Add(*wins)
+	}
+	for chrom, chromlen := range o.ChromLens {
+		h.SetChromLen(chrom, chromlen)
+	}
+}
+
+// Add all hits for all genomes from o into g
+func (g *GenomeHits) Merge(o *GenomeHits) {
+	for genome, ohits := range o.Ghits {
+		g.Genome(genome).Merge(ohits)
+	}
+}
+
+// Add the read totals and hits from a partial set of statistics
+func (stats *AllWinStats) Merge(o *AllWinStats) {
+	stats.Hits.Merge(&o.Hits)
+	stats.GenomeHits.Merge(&o.GenomeHits)
+	for i, _ := range stats.Bands {
+		stats.Bands[i].Hits.Merge(&o.Bands[i].Hits)
+		stats.Bands[i].GenomeHits.Merge(&o.Bands[i].GenomeHits)
+	}
+	if stats.Boot != nil {
+		stats.Boot.Merge(o.Boot)
+	}
+	stats.TotalSelfHits += o.TotalSelfHits
+	stats.TotalPairHits += o.TotalPairHits
+	stats.TotalGoodReads += o.TotalGoodReads
+	stats.TotalReads += o.TotalReads
+}
+
+// Calculate window statistics with flags.Threads worker goroutines. The input
+// is streamed to the workers in chunks, each worker counts hits into its own
+// statistics, and the partial statistics are summed once the input is used up,
+// so the result is identical to that of the single-threaded path.
+func WinStatsParallel(flags Flags, r io.Reader) (stats AllWinStats, err error) {
+	return winStatsParallel(flags, r, ParallelChunkSize)
+}
+
+func winStatsParallel(flags Flags, r io.Reader, chunksize int) (stats AllWinStats, err error) {
+	threads := flags.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	stats = NewAllWinStats(flags)
+	ps, err := NewPairScanner(flags, r)
+	if err != nil {
+		return stats, fmt.Errorf("WinStatsParallel: %w", err)
+	}
+	// The text reader of the current line, or nil if it came from a pairs
+	// cache; each input of several has its own columns and resolver
+	textReader := func() *PairsReader {
+		if m, ok := ps.(*multiScanner); ok {
+			pr, _ := m.current().(*PairsReader)
+			return pr
+		}
+		pr, _ := ps.(*PairsReader)
+		return pr
+	}
+
+	chunks := make(chan pairsChunk, threads * 2)
+	partials := make([]AllWinStats, threads)
+	g, ctx := errgroup.WithContext(context.Background())
+	for i := range partials {
+		partial := &partials[i]
+		*partial = NewAllWinStats(flags)
+		g.Go(func() error {
+			for c := range chunks {
+				if partial.Boot != nil {
+					partial.Boot.Offset = c.First - partial.TotalReads
+				}
+				for _, sp := range c.Pairs {
+					partial.TotalReads++
+					if sp.Good {
+						partial.TotalGoodReads++
+					}
+					if sp.Accepted {
+						partial.CountPair(flags, sp.Pair)
+					}
+				}
+				for j, line := range c.Lines {
+					if e := partial.AddLine(flags, line, c.Cols, c.Reader.Resolver); e != nil {
+						if e = c.Reader.Rejecter.Reject(c.LineNums[j], line, e); e != nil {
+							return e
+						}
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	send := func(c pairsChunk) bool {
+		select {
+		case chunks <- c:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	var chunk pairsChunk
+	var scanned int64
+	for ps.Scan() {
+		pr := textReader()
+		if n := len(chunk.Lines) + len(chunk.Pairs); n >= chunksize || (n > 0 && (pr != chunk.Reader || pr != nil && pr.Cols != chunk.Cols)) {
+			if !send(chunk) {
+				break
+			}
+			chunk = pairsChunk{First: scanned}
+		}
+		scanned++
+		if pr == nil {
+			sp := scannedPair{Good: ps.Good(), Accepted: ps.Accepted()}
+			if sp.Accepted {
+				sp.Pair, sp.Accepted = ps.Pair()
+			}
+			chunk.Pairs = append(chunk.Pairs, sp)
+			continue
+		}
+		chunk.Reader, chunk.Cols = pr, pr.Cols
+		chunk.Lines = append(chunk.Lines, append([]string{}, pr.Line()...))
+		chunk.LineNums = append(chunk.LineNums, pr.LineNum)
+	}
+	if len(chunk.Lines) + len(chunk.Pairs) > 0 {
+		send(chunk)
+	}
+	close(chunks)
+
+	if err = g.Wait(); err != nil {
+		return stats, fmt.Errorf("WinStatsParallel: %w", err)
+	}
+	if err = ps.Err(); err != nil {
+		return stats, fmt.Errorf("WinStatsParallel: %w", err)
+	}
+	for i := range partials {
+		stats.Merge(&partials[i])
+	}
+	if err = stats.Finish(flags, ps); err != nil {
+		return stats, fmt.Errorf("WinStatsParallel: %w", err)
+	}
+	return stats, nil
+}
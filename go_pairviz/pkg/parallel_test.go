@@ -0,0 +1,115 @@
+package pairviz
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeParallelTestIn(n int) string {
+	var b strings.Builder
+	b.WriteString("## pairs format v1.0.0\n#chromsize: X_ISO1 5000\n#chromsize: X_W501 4800\n")
+	b.WriteString("#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type\n")
+	parents := []string{"ISO1", "W501"}
+	strands := []string{"+", "-"}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "r%v\tX_%v\t%v\tX_%v\t%v\t%v\t%v\tUU\n",
+			i,
+			parents[i % 2], (i * 37) % 4700,
+			parents[(i / 3) % 2], (i * 53) % 4700,
+			strands[(i / 2) % 2], strands[(i / 5) % 2],
+		)
+	}
+	return b.String()
+}
+
+func TestWinStatsParallel(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 100
+	flags.WinStep = 25
+	flags.Distance = 3000
+	flags.FullChroms = true
+	in := makeParallelTestIn(1000)
+
+	serial, e := WinStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	flags.Threads = 4
+	parallel, e := winStatsParallel(flags, strings.NewReader(in), 37)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	for _, sep := range []bool{false, true} {
+		for _, jsonOut := range []bool{false, true} {
+			var want, got bytes.Buffer
+			if e = FprintWinStats(&want, serial, sep, flags.ReadLen, jsonOut); e != nil {
+				t.Fatal(e)
+			}
+			if e = FprintWinStats(&got, parallel, sep, flags.ReadLen, jsonOut); e != nil {
+				t.Fatal(e)
+			}
+			if want.Len() == 0 || !bytes.Equal(want.Bytes(), got.Bytes()) {
+				t.Errorf("separate genomes %v, JSON %v: parallel output differs from serial output", sep, jsonOut)
+			}
+		}
+	}
+}
+
+func TestWinStatsParallelInputs(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("#columns: readID pos1 chrom1 chrom2 pos2 strand1 strand2 pair_type\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&b, "s%v\t%v\tX_ISO1\tX_W501\t%v\t+\t-\tUU\n", i, (i * 31) % 4700, (i * 17) % 4700)
+		if i == 100 {
+			b.WriteString("bad\t120\tX_ISO1\tX_ISO1\t4x0\t+\t-\tUU\n")
+		}
+	}
+	var paths []string
+	for i, in := range []string{makeParallelTestIn(500), b.String()} {
+		path := filepath.Join(dir, []string{"a.pairs", "b.pairs"}[i])
+		if e := os.WriteFile(path, []byte(in), 0644); e != nil {
+			t.Fatal(e)
+		}
+		paths = append(paths, path)
+	}
+
+	flags := gFlags
+	flags.WinSize = 100
+	flags.WinStep = 100
+	flags.Distance = 5000
+	var outs [2]bytes.Buffer
+	for i, threads := range []int{1, 4} {
+		flags.Threads = threads
+		flags.Rejecter = NewRejecter(SkipBad, nil)
+		in, e := OpenInputs(paths, threads)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var stats AllWinStats
+		if threads == 1 {
+			stats, e = WinStats(flags, in)
+		} else {
+			stats, e = winStatsParallel(flags, in, 37)
+		}
+		in.Close()
+		if e != nil {
+			t.Fatal(e)
+		}
+		if flags.Rejecter.Skipped() != 1 || stats.TotalReads != 801 {
+			t.Errorf("threads %v: skipped %v of %v lines", threads, flags.Rejecter.Skipped(), stats.TotalReads)
+		}
+		if e = FprintWinStats(&outs[i], stats, true, flags.ReadLen, true); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if outs[0].Len() == 0 || !bytes.Equal(outs[0].Bytes(), outs[1].Bytes()) {
+		t.Errorf("output with 4 threads differs from output with 1 thread")
+	}
+}
@@ -0,0 +1,798 @@
+package pairviz
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+var ErrBadGeom = errors.New("Unknown plot geom")
+var ErrBadYLim = errors.New("Y limits must be two comma-separated numbers")
+var ErrBadLogYLim = errors.New("Y limits of a log-scaled axis must be positive")
+var ErrNoPlotData = errors.New("No values to plot")
+
+// Options for plotting pairviz JSON output, following pairviz_plot.py
+type PlotFlags struct {
+	Title string
+	XName string
+	YName string
+	Proportion bool
+	Counts bool
+	Self bool
+	MyY string
+	AltY string
+	ChromSpace int64
+	Log bool
+	NamedXTicks bool
+	XDim float64
+	YDim float64
+	Dpi float64
+	Geom string
+	YLim []float64
+	Genome string
+	Chrom string
+	VColor bool
+}
+
+// The fields plotted for the paired and self hits, chosen as in
+// pairviz_plot.py unless MyY or AltY are set
+func (f PlotFlags) Fields() (my, alt string) {
+	switch {
+	case f.Counts && f.Proportion: my, alt = "TargetProp", "AltProp"
+	case f.Counts: my, alt = "TargetHits", "AltHits"
+	case f.Proportion: my, alt = "TargetFpkmProp", "AltFpkmProp"
+	default: my, alt = "TargetFpkm", "AltFpkm"
+	}
+	if f.MyY != "" {
+		my = f.MyY
+	}
+	if f.AltY != "" {
+		alt = f.AltY
+	}
+	return my, alt
+}
+
+// One window of a plotted line
+type PlotPoint struct {
+	Chrom string
+	Pos int64
+	Value float64
+}
+
+// The values of one sample, or the self values of one sample
+type PlotSeries struct {
+	Label string
+	Points []PlotPoint
+}
+
+// Everything needed to lay out a plot: the series, the chromosomes in plot
+// order, and their lengths
+type PlotData struct {
+	Series []*PlotSeries
+	Chroms []string
+	ChromLens map[string]int64
+	// The input chromosome of each plotted chromosome, which is named
+	// <chrom>_<genome> when all genomes are plotted
+	bare map[string]string
+}
+
+// Add the records of one input to d. Each Name in the input is a separate
+// sample, labelled with label if it is set, or else with the Name, or else
+// with def.
+func (d *PlotData) Add(it iter.Seq2[JsonOutStat, error], label, def string, flags PlotFlags) error {
+	my, alt := flags.Fields()
+	myi, err := metricIndex(my)
+	if err != nil {
+		return fmt.Errorf("PlotData.Add: %w", err)
+	}
+	alti, err := metricIndex(alt)
+	if err != nil {
+		return fmt.Errorf("PlotData.Add: %w", err)
+	}
+	if d.ChromLens == nil {
+		d.ChromLens = map[string]int64{}
+	}
+	if d.bare == nil {
+		d.bare = map[string]string{}
+	}
+
+	byname := map[string][2]*PlotSeries{}
+	var order []string
+	for j, err := range it {
+		if err != nil {
+			return fmt.Errorf("PlotData.Add: %w", err)
+		}
+		if flags.Genome != "" && j.Genome != flags.Genome {
+			continue
+		}
+		chrom := j.Chr + "_" + j.Genome
+		if flags.Genome != "" {
+			chrom = j.Chr
+		}
+		if flags.Chrom != "" && chrom != flags.Chrom && j.Chr != flags.Chrom {
+			continue
+		}
+		if _, ok := d.ChromLens[chrom]; !ok {
+			d.Chroms = append(d.Chroms, chrom)
+			d.ChromLens[chrom] = 0
+			d.bare[chrom] = j.Chr
+		}
+		if j.End > d.ChromLens[chrom] {
+			d.ChromLens[chrom] = j.End
+		}
+
+		s, ok := byname[j.Name]
+		if !ok {
+			name := label
+			if name == "" {
+				name = j.Name
+			}
+			if name == "" {
+				name = def
+			}
+			s = [2]*PlotSeries{{Label: name}, {Label: name + " self"}}
+			byname[j.Name] = s
+			order = append(order, j.Name)
+		}
+		for k, index := range [2][]int{myi, alti} {
+			if k == 1 && !flags.Self {
+				break
+			}
+			v, err := jsonMetricIndex(j, [2]string{my, alt}[k], index)
+			if err != nil {
+				return fmt.Errorf("PlotData.Add: %v:%v-%v: %w", j.Chr, j.Start, j.End, err)
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) || (flags.Log && v <= 0) {
+				continue
+			}
+			s[k].Points = append(s[k].Points, PlotPoint{chrom, j.Start, v})
+		}
+	}
+	for _, name := range order {
+		d.Series = append(d.Series, byname[name][0])
+		if flags.Self {
+			d.Series = append(d.Series, byname[name][1])
+		}
+	}
+	return nil
+}
+
+// Use the chromosome lengths in path, and their order, for the chromosomes
+// that are also in the data. A chromosome of the file matches a plotted
+// <chrom>_<genome> of every genome.
+func (d *PlotData) SetChromLens(path string) error {
+	chroms, err := readChromOrder(path, d.Chroms, d.ChromLens, d.bare)
+	if err != nil {
+		return fmt.Errorf("SetChromLens: %w", err)
+	}
+	d.Chroms = chroms
+	return nil
+}
+
+// Reorder chroms to follow the chromosome lengths file at path, with any
+// chromosomes missing from it at the end, and lengthen lens to the lengths in
+// the file. A name in the file that is not in chroms matches the chromosomes
+// whose name in bare is that name, in the order of chroms.
+func readChromOrder(path string, chroms []string, lens map[string]int64, bare map[string]string) ([]string, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	flens, err := ReadChromLens(path)
+	if err != nil {
+		return nil, err
+	}
+
+	byBare := map[string][]string{}
+	for _, chrom := range chroms {
+		if name, ok := bare[chrom]; ok {
+			byBare[name] = append(byBare[name], chrom)
+		}
+	}
+
+	var order []string
+	seen := map[string]bool{}
+	s := fasttsv.NewScanner(r)
+	for s.Scan() {
+		line := s.Line()
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+		matches := byBare[line[0]]
+		if _, ok := lens[line[0]]; ok {
+			matches = []string{line[0]}
+		}
+		for _, chrom := range matches {
+			if seen[chrom] {
+				continue
+			}
+			order = append(order, chrom)
+			seen[chrom] = true
+			if flens[line[0]] > lens[chrom] {
+				lens[chrom] = flens[line[0]]
+			}
+		}
+	}
+	for _, chrom := range chroms {
+		if !seen[chrom] {
+			order = append(order, chrom)
+		}
+	}
+	return order, nil
+}
+
+// The start of each chromosome along the x axis
+func (d *PlotData) Offsets(space int64) (map[string]int64, int64) {
+	offsets := map[string]int64{}
+	pos := int64(0)
+	for i, chrom := range d.Chroms {
+		if i > 0 {
+			pos += space
+		}
+		offsets[chrom] = pos
+		pos += d.ChromLens[chrom]
+	}
+	return offsets, pos
+}
+
+// A vertical line at a genome position, with an optional factor for its
+// color
+type PlotVLine struct {
+	Chrom string
+	Pos int64
+	Factor string
+}
+
+// Read vertical line positions from the first three or four columns of a
+// bed file
+func ReadPlotVLines(path string) ([]PlotVLine, error) {
+	regions, err := GetRegions(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPlotVLines: %w", err)
+	}
+	var out []PlotVLine
+	for _, r := range regions {
+		out = append(out, PlotVLine{r.Chrom, r.Start, r.Name})
+	}
+	return out, nil
+}
+
+// The colors of lines, points, and vertical lines, in order
+var plotPalette = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+	{0xbc, 0xbd, 0x22, 0xff},
+	{0x17, 0xbe, 0xcf, 0xff},
+}
+
+var plotBlack = color.RGBA{0, 0, 0, 0xff}
+var plotGray = color.RGBA{0xa0, 0xa0, 0xa0, 0xff}
+
+type textAnchor int
+
+const (
+	anchorStart textAnchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// The drawing operations a plot needs, in pixels from the top left
+type plotCanvas interface {
+	Line(x1, y1, x2, y2 float64, c color.RGBA, width float64)
+	Circle(x, y, r float64, c color.RGBA)
+	// Draw text centered vertically on y, or, if vertical, reading upward
+	// and centered on x and y
+	Text(x, y float64, s string, size float64, anchor textAnchor, vertical bool, c color.RGBA)
+}
+
+// Ticks at 1, 2, or 5 times a power of ten, about n of them between lo and
+// hi
+func niceTicks(lo, hi float64, n int) []float64 {
+	if !(hi > lo) {
+		return []float64{lo}
+	}
+	raw := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := mag
+	for _, m := range []float64{2, 5, 10} {
+		if step >= raw {
+			break
+		}
+		step = m * mag
+	}
+	var ticks []float64
+	for k := math.Ceil(lo / step); k * step <= hi + step * 1e-9; k++ {
+		ticks = append(ticks, k * step)
+	}
+	return ticks
+}
+
+func formatTick(t float64) string {
+	return strconv.FormatFloat(t, 'g', 6, 64)
+}
+
+// Draw the plot of d on c, which is width by height pixels
+func drawPlot(c plotCanvas, d *PlotData, vlines []PlotVLine, flags PlotFlags, width, height float64) error {
+	offsets, total := d.Offsets(flags.ChromSpace)
+	if flags.Chrom != "" {
+		offsets, total = d.Offsets(0)
+	}
+
+	ylo, yhi := math.Inf(1), math.Inf(-1)
+	for _, s := range d.Series {
+		for _, p := range s.Points {
+			v := p.Value
+			if flags.Log {
+				v = math.Log10(v)
+			}
+			ylo, yhi = math.Min(ylo, v), math.Max(yhi, v)
+		}
+	}
+	if math.IsInf(ylo, 1) || total <= 0 {
+		return fmt.Errorf("drawPlot: %w", ErrNoPlotData)
+	}
+	if flags.YLim != nil {
+		if flags.Log && flags.YLim[0] <= 0 {
+			return fmt.Errorf("drawPlot: %v: %w", flags.YLim, ErrBadLogYLim)
+		}
+		ylo, yhi = flags.YLim[0], flags.YLim[1]
+		if flags.Log {
+			ylo, yhi = math.Log10(ylo), math.Log10(yhi)
+		}
+	} else {
+		pad := (yhi - ylo) * 0.05
+		if pad == 0 {
+			pad = math.Max(math.Abs(yhi) * 0.05, 0.5)
+		}
+		ylo, yhi = ylo - pad, yhi + pad
+	}
+
+	fs := height / 60
+	left, right := fs * 7, width - fs * 2
+	top, bottom := fs * 4, height - fs * 5
+	xpix := func(x float64) float64 {
+		return left + x / float64(total) * (right - left)
+	}
+	ypix := func(y float64) float64 {
+		if flags.Log {
+			y = math.Log10(y)
+		}
+		return bottom - (y - ylo) / (yhi - ylo) * (bottom - top)
+	}
+
+	c.Text((left + right) / 2, fs * 2, flags.Title, fs * 1.5, anchorMiddle, false, plotBlack)
+	c.Text((left + right) / 2, height - fs * 1.5, flags.XName, fs, anchorMiddle, false, plotBlack)
+	c.Text(fs * 1.5, (top + bottom) / 2, flags.YName, fs, anchorMiddle, true, plotBlack)
+
+	for _, t := range niceTicks(ylo, yhi, 6) {
+		y := bottom - (t - ylo) / (yhi - ylo) * (bottom - top)
+		label := formatTick(t)
+		if flags.Log {
+			label = formatTick(math.Pow(10, t))
+		}
+		c.Line(left - fs / 2, y, left, y, plotBlack, 1)
+		c.Text(left - fs * 0.75, y, label, fs * 0.8, anchorEnd, false, plotBlack)
+	}
+	if flags.NamedXTicks {
+		for _, chrom := range d.Chroms {
+			x := xpix(float64(offsets[chrom]) + float64(d.ChromLens[chrom]) / 2)
+			c.Line(x, bottom, x, bottom + fs / 2, plotBlack, 1)
+			c.Text(x, bottom + fs * 1.5, chrom, fs * 0.8, anchorMiddle, false, plotBlack)
+		}
+	} else {
+		for _, t := range niceTicks(0, float64(total), 8) {
+			x := xpix(t)
+			c.Line(x, bottom, x, bottom + fs / 2, plotBlack, 1)
+			c.Text(x, bottom + fs * 1.5, formatTick(t), fs * 0.8, anchorMiddle, false, plotBlack)
+		}
+	}
+
+	factors := map[string]int{}
+	for _, v := range vlines {
+		off, ok := offsets[v.Chrom]
+		if !ok {
+			continue
+		}
+		col := plotGray
+		if flags.VColor {
+			if _, ok := factors[v.Factor]; !ok {
+				factors[v.Factor] = len(factors)
+			}
+			col = plotPalette[factors[v.Factor] % len(plotPalette)]
+		}
+		x := xpix(float64(off + v.Pos))
+		c.Line(x, top, x, bottom, col, 1)
+	}
+
+	clipped := func(y float64) bool {
+		return y < top || y > bottom
+	}
+	for i, s := range d.Series {
+		col := plotPalette[i % len(plotPalette)]
+		var px, py float64
+		for j, p := range s.Points {
+			x, y := xpix(float64(offsets[p.Chrom] + p.Pos)), ypix(p.Value)
+			if flags.Geom == "line" {
+				if j > 0 && s.Points[j - 1].Chrom == p.Chrom && !clipped(y) && !clipped(py) {
+					c.Line(px, py, x, y, col, 1.5)
+				}
+				px, py = x, y
+				continue
+			}
+			if !clipped(y) {
+				c.Circle(x, y, fs / 5, col)
+			}
+		}
+	}
+
+	c.Line(left, top, right, top, plotBlack, 1)
+	c.Line(right, top, right, bottom, plotBlack, 1)
+	c.Line(right, bottom, left, bottom, plotBlack, 1)
+	c.Line(left, bottom, left, top, plotBlack, 1)
+
+	if len(d.Series) > 1 {
+		for i, s := range d.Series {
+			y := top + fs * (1 + 1.2 * float64(i))
+			col := plotPalette[i % len(plotPalette)]
+			c.Line(right - fs * 12, y, right - fs * 10.5, y, col, 3)
+			c.Text(right - fs * 10, y, s.Label, fs * 0.8, anchorStart, false, plotBlack)
+		}
+	}
+	return nil
+}
+
+// Writes SVG elements
+type svgCanvas struct {
+	w *bufio.Writer
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func (s svgCanvas) Line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	fmt.Fprintf(s.w, "<line x1=\"%.2f\" y1=\"%.2f\" x2=\"%.2f\" y2=\"%.2f\" stroke=\"%s\" stroke-width=\"%g\"/>\n", x1, y1, x2, y2, svgColor(c), width)
+}
+
+func (s svgCanvas) Circle(x, y, r float64, c color.RGBA) {
+	fmt.Fprintf(s.w, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\" fill=\"%s\"/>\n", x, y, r, svgColor(c))
+}
+
+func (s svgCanvas) Text(x, y float64, text string, size float64, anchor textAnchor, vertical bool, c color.RGBA) {
+	anchors := [...]string{"start", "middle", "end"}
+	rotate := ""
+	if vertical {
+		rotate = fmt.Sprintf(" transform=\"rotate(-90 %.2f %.2f)\"", x, y)
+	}
+	var b strings.Builder
+	if err := xmlEscape(&b, text); err != nil {
+		return
+	}
+	fmt.Fprintf(s.w, "<text x=\"%.2f\" y=\"%.2f\" font-family=\"sans-serif\" font-size=\"%.1f\" text-anchor=\"%s\" dominant-baseline=\"middle\" fill=\"%s\"%s>%s</text>\n", x, y, size, anchors[anchor], svgColor(c), rotate, b.String())
+}
+
+func xmlEscape(w io.Writer, s string) error {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+	_, err := r.WriteString(w, s)
+	return err
+}
+
+// Draws into an image, antialiasing lines and points
+type pngCanvas struct {
+	img *image.RGBA
+	ras vector.Rasterizer
+}
+
+// Fill the polygon pts, drawing only over its bounding box
+func (p *pngCanvas) fill(pts [][2]float64, c color.RGBA) {
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, pt := range pts {
+		minx, miny = math.Min(minx, pt[0]), math.Min(miny, pt[1])
+		maxx, maxy = math.Max(maxx, pt[0]), math.Max(maxy, pt[1])
+	}
+	box := image.Rect(int(math.Floor(minx)), int(math.Floor(miny)), int(math.Ceil(maxx)) + 1, int(math.Ceil(maxy)) + 1)
+	box = box.Intersect(p.img.Bounds())
+	if box.Empty() {
+		return
+	}
+	p.ras.Reset(box.Dx(), box.Dy())
+	for i, pt := range pts {
+		x, y := float32(pt[0] - float64(box.Min.X)), float32(pt[1] - float64(box.Min.Y))
+		if i == 0 {
+			p.ras.MoveTo(x, y)
+		} else {
+			p.ras.LineTo(x, y)
+		}
+	}
+	p.ras.ClosePath()
+	p.ras.Draw(p.img, box, image.NewUniform(c), image.Point{})
+}
+
+func (p *pngCanvas) Line(x1, y1, x2, y2 float64, c color.RGBA, width float64) {
+	dx, dy := x2 - x1, y2 - y1
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return
+	}
+	nx, ny := -dy / l * width / 2, dx / l * width / 2
+	p.fill([][2]float64{{x1 + nx, y1 + ny}, {x2 + nx, y2 + ny}, {x2 - nx, y2 - ny}, {x1 - nx, y1 - ny}}, c)
+}
+
+func (p *pngCanvas) Circle(x, y, r float64, c color.RGBA) {
+	pts := make([][2]float64, 16)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(len(pts))
+		pts[i] = [2]float64{x + r * math.Cos(a), y + r * math.Sin(a)}
+	}
+	p.fill(pts, c)
+}
+
+// Draw text with a fixed bitmap font, scaled by whole pixels to about size
+func (p *pngCanvas) Text(x, y float64, s string, size float64, anchor textAnchor, vertical bool, c color.RGBA) {
+	face := basicfont.Face7x13
+	w := font.MeasureString(face, s).Ceil()
+	h := face.Metrics().Height.Ceil()
+	if w == 0 {
+		return
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face, Dot: fixed.P(0, face.Metrics().Ascent.Ceil())}
+	d.DrawString(s)
+
+	scale := int(math.Max(1, math.Round(size / float64(h))))
+	tw, th := float64(w * scale), float64(h * scale)
+	x0, y0 := x, y - th / 2
+	switch anchor {
+	case anchorMiddle: x0 -= tw / 2
+	case anchorEnd: x0 -= tw
+	default:
+	}
+	if vertical {
+		x0, y0 = x - th / 2, y + tw / 2
+	}
+
+	src := image.NewUniform(c)
+	for j := 0; j < h; j++ {
+		for i := 0; i < w; i++ {
+			a := mask.AlphaAt(i, j).A
+			if a == 0 {
+				continue
+			}
+			var r image.Rectangle
+			if vertical {
+				px, py := int(x0) + j * scale, int(y0) - (i + 1) * scale
+				r = image.Rect(px, py, px + scale, py + scale)
+			} else {
+				px, py := int(x0) + i * scale, int(y0) + j * scale
+				r = image.Rect(px, py, px + scale, py + scale)
+			}
+			draw.DrawMask(p.img, r, src, image.Point{}, image.NewUniform(color.Alpha{a}), image.Point{}, draw.Over)
+		}
+	}
+}
+
+// Write the plot as SVG
+func WritePlotSvg(w io.Writer, d *PlotData, vlines []PlotVLine, flags PlotFlags) error {
+	width, height := flags.XDim * flags.Dpi, flags.YDim * flags.Dpi
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%gin\" height=\"%gin\" viewBox=\"0 0 %.0f %.0f\">\n", flags.XDim, flags.YDim, width, height)
+	fmt.Fprintf(bw, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	if err := drawPlot(svgCanvas{bw}, d, vlines, flags, width, height); err != nil {
+		return fmt.Errorf("WritePlotSvg: %w", err)
+	}
+	fmt.Fprintf(bw, "</svg>\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("WritePlotSvg: %w", err)
+	}
+	return nil
+}
+
+// Write the plot as PNG
+func WritePlotPng(w io.Writer, d *PlotData, vlines []PlotVLine, flags PlotFlags) error {
+	width, height := int(flags.XDim * flags.Dpi), int(flags.YDim * flags.Dpi)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	if err := drawPlot(&pngCanvas{img: img}, d, vlines, flags, float64(width), float64(height)); err != nil {
+		return fmt.Errorf("WritePlotPng: %w", err)
+	}
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("WritePlotPng: %w", err)
+	}
+	return nil
+}
+
+// Write the plot to path, as PNG if it ends in .png and SVG otherwise
+func WritePlotPath(path string, d *PlotData, vlines []PlotVLine, flags PlotFlags) (err error) {
+	w, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("WritePlotPath: %w", err)
+	}
+	defer func() {
+		if e := w.Close(); err == nil && e != nil {
+			err = fmt.Errorf("WritePlotPath: %w", e)
+		}
+	}()
+	if strings.ToLower(filepath.Ext(path)) == ".png" {
+		return WritePlotPng(w, d, vlines, flags)
+	}
+	return WritePlotSvg(w, d, vlines, flags)
+}
+
+// Parse comma-separated y limits
+func ParseYLim(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Split(s, ",")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("ParseYLim: %q: %w", s, ErrBadYLim)
+	}
+	lim := make([]float64, 2)
+	for i, f := range fields {
+		var err error
+		if lim[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return nil, fmt.Errorf("ParseYLim: %q: %w", s, ErrBadYLim)
+		}
+	}
+	if !(lim[1] > lim[0]) {
+		return nil, fmt.Errorf("ParseYLim: %q: %w", s, ErrBadYLim)
+	}
+	return lim, nil
+}
+
+// The base name of path without its extensions, used to label an input
+// without names
+func plotInputName(path string) string {
+	base := filepath.Base(path)
+	if i := strings.Index(base, "."); i > 0 {
+		return base[:i]
+	}
+	return base
+}
+
+func FullPlot() {
+	var flags PlotFlags
+	chrlens := flag.String("L", "", "Chromosome lengths .bed file, also used for the chromosome order; its names match the chromosome of every genome (default: the ends of the last windows, in input order)")
+	outpath := flag.String("o", "out.svg", "Output path; .png paths are written as PNG, others as SVG")
+	stdin := flag.Bool("i", false, "Take input from stdin along with other inputs")
+	names := flag.String("names", "", "Comma-separated names of the input files (default: the Name of each record, or the file name)")
+	ylim := flag.String("ylim", "", "Comma-separated Y axis limits, which must be positive with -l (default: from the data)")
+	vlinesp := flag.String("vlines", "", "Bed file of positions to place vertical lines at")
+	split := flag.Bool("split", false, "Write one plot per chromosome, adding the chromosome name before the extension of -o")
+	flag.StringVar(&flags.Title, "t", "Pairing Rate", "Title of plot")
+	flag.BoolVar(&flags.Proportion, "p", false, "Plot as a proportion of total reads in the region, rather than absolute")
+	flag.BoolVar(&flags.Counts, "f", false, "Plot read counts rather than FPKM (can be combined with -p)")
+	flag.BoolVar(&flags.Self, "s", false, "Also plot self-interactions")
+	flag.Int64Var(&flags.ChromSpace, "c", 5000000, "bp of space to put between chromosomes in plot")
+	flag.BoolVar(&flags.Log, "l", false, "Log-scale the y-axis")
+	flag.StringVar(&flags.XName, "x", "Genome position (bp)", "X axis name")
+	flag.StringVar(&flags.YName, "y", "Hi-C contacts", "Y axis name")
+	flag.BoolVar(&flags.NamedXTicks, "N", false, "Use chromosome names for X axis ticks")
+	flag.StringVar(&flags.MyY, "my_y", "", "Arbitrary JSON field to plot, such as TargetPropGood (overrides -p and -f)")
+	flag.StringVar(&flags.AltY, "alt_y", "", "Arbitrary JSON field to plot for self-interactions (overrides -p and -f)")
+	flag.Float64Var(&flags.XDim, "X", 20, "Size in inches of plot (X dimension)")
+	flag.Float64Var(&flags.YDim, "Y", 10, "Size in inches of plot (Y dimension)")
+	flag.Float64Var(&flags.Dpi, "dpi", 100, "Pixels per inch")
+	flag.StringVar(&flags.Geom, "g", "point", "Geom to use for plotting, point or line")
+	flag.StringVar(&flags.Genome, "G", "", "Only plot this genome, keeping the original chromosome names (default: all genomes, with chromosomes named <chrom>_<genome>)")
+	flag.StringVar(&flags.Chrom, "chrom", "", "Only plot this chromosome, of every genome unless it is named <chrom>_<genome>")
+	flag.BoolVar(&flags.VColor, "vcolor", false, "Color vertical lines based on the factor values in column 4 of the -vlines bed file")
+	flag.Parse()
+
+	usage := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(2)
+		}
+	}
+	if flags.Geom != "point" && flags.Geom != "line" {
+		usage(fmt.Errorf("%q: %w", flags.Geom, ErrBadGeom))
+	}
+	if !(flags.XDim > 0 && flags.YDim > 0 && flags.Dpi > 0) {
+		usage(errors.New("-X, -Y, and -dpi must be positive"))
+	}
+	var e error
+	flags.YLim, e = ParseYLim(*ylim)
+	usage(e)
+	if flags.Log && flags.YLim != nil && flags.YLim[0] <= 0 {
+		usage(fmt.Errorf("-ylim %q: %w", *ylim, ErrBadLogYLim))
+	}
+	my, alt := flags.Fields()
+	_, e = metricIndex(my)
+	usage(e)
+	if flags.Self {
+		_, e = metricIndex(alt)
+		usage(e)
+	}
+	var labels []string
+	if *names != "" {
+		labels = strings.Split(*names, ",")
+		if len(labels) != flag.NArg() {
+			usage(fmt.Errorf("-names has %v names for %v inputs", len(labels), flag.NArg()))
+		}
+	}
+
+	h := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	d := &PlotData{}
+	if *stdin || flag.NArg() == 0 {
+		h(d.Add(ParsePairvizOut(os.Stdin), "", "stdin", flags))
+	}
+	for i, path := range flag.Args() {
+		r, e := OpenMaybeGz(path)
+		h(e)
+		label := ""
+		if labels != nil {
+			label = labels[i]
+		}
+		e = d.Add(ParsePairvizOut(r), label, plotInputName(path), flags)
+		r.Close()
+		h(e)
+	}
+	if *chrlens != "" {
+		h(d.SetChromLens(*chrlens))
+	}
+	var vlines []PlotVLine
+	if *vlinesp != "" {
+		vlines, e = ReadPlotVLines(*vlinesp)
+		h(e)
+	}
+
+	if !*split {
+		h(WritePlotPath(*outpath, d, vlines, flags))
+		return
+	}
+	for _, chrom := range d.Chroms {
+		cflags := flags
+		cflags.Chrom = chrom
+		cd := &PlotData{Chroms: []string{chrom}, ChromLens: d.ChromLens}
+		npoints := 0
+		for _, s := range d.Series {
+			cs := &PlotSeries{Label: s.Label}
+			for _, p := range s.Points {
+				if p.Chrom == chrom {
+					cs.Points = append(cs.Points, p)
+				}
+			}
+			cd.Series = append(cd.Series, cs)
+			npoints += len(cs.Points)
+		}
+		if npoints == 0 {
+			continue
+		}
+		if cflags.Title == "Pairing Rate" {
+			cflags.Title += " " + chrom
+		}
+		h(WritePlotPath(GenomeTrackPath(*outpath, chrom), cd, vlines, cflags))
+	}
+}
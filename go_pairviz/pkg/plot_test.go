@@ -0,0 +1,129 @@
+package pairviz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makePlotTestData(t *testing.T, flags PlotFlags) *PlotData {
+	var b strings.Builder
+	for _, name := range []string{"a", "b"} {
+		for _, chr := range []string{"X", "2L"} {
+			for i := int64(0); i < 20; i++ {
+				fmt.Fprintf(&b, `{"Genome":"ISO1","Chr":%q,"Start":%v,"End":%v,"TargetHits":%v,"AltHits":10,"TargetProp":%v,"TargetFpkm":%v,"AltFpkm":"NaN","Name":%q}`+"\n",
+					chr, i * 1000, i * 1000 + 1000, i, float64(i) / float64(i + 10), i * 2, name)
+			}
+		}
+	}
+	d := &PlotData{}
+	if e := d.Add(ParsePairvizOut(strings.NewReader(b.String())), "", "in", flags); e != nil {
+		t.Fatal(e)
+	}
+	return d
+}
+
+func TestPlot(t *testing.T) {
+	flags := PlotFlags{Title: "Pairing & more", Self: true, ChromSpace: 5000, XDim: 4, YDim: 3, Dpi: 50, Geom: "line"}
+	if my, alt := flags.Fields(); my != "TargetFpkm" || alt != "AltFpkm" {
+		t.Errorf("wrong default fields %v %v", my, alt)
+	}
+	flags.Counts, flags.Proportion = true, true
+	if my, alt := flags.Fields(); my != "TargetProp" || alt != "AltProp" {
+		t.Errorf("wrong proportion fields %v %v", my, alt)
+	}
+	flags.Counts, flags.Proportion = false, false
+
+	d := makePlotTestData(t, flags)
+	if len(d.Series) != 4 || d.Series[1].Label != "a self" || len(d.Series[0].Points) != 40 || len(d.Series[1].Points) != 0 {
+		t.Fatalf("wrong series: %v", d.Series)
+	}
+	if offsets, total := d.Offsets(flags.ChromSpace); offsets["2L_ISO1"] != 25000 || total != 45000 {
+		t.Errorf("wrong offsets %v %v", offsets, total)
+	}
+
+	var buf bytes.Buffer
+	if e := WritePlotSvg(&buf, d, []PlotVLine{{"2L_ISO1", 500, ""}}, flags); e != nil {
+		t.Fatal(e)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "Pairing &amp; more") || strings.Count(svg, "<line") < 2 * 38 {
+		t.Errorf("bad SVG:\n%.500v", svg)
+	}
+
+	buf.Reset()
+	flags.Geom = "point"
+	if e := WritePlotPng(&buf, d, nil, flags); e != nil {
+		t.Fatal(e)
+	}
+	img, e := png.Decode(&buf)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 150 {
+		t.Errorf("wrong PNG size %v", b)
+	}
+	colored := 0
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if r != g || g != b {
+				colored++
+			}
+		}
+	}
+	if colored < 40 {
+		t.Errorf("only %v colored pixels", colored)
+	}
+
+	flags.Chrom = "X_ISO1"
+	if d = makePlotTestData(t, flags); len(d.Chroms) != 1 || len(d.Series[0].Points) != 20 {
+		t.Errorf("chromosome not selected: %v", d.Chroms)
+	}
+
+	if ticks := niceTicks(0, 1, 5); len(ticks) != 6 || ticks[3] != 0.6000000000000001 && ticks[3] != 0.6 {
+		t.Errorf("wrong ticks %v", ticks)
+	}
+	if _, e = ParseYLim("1,0"); e == nil {
+		t.Errorf("reversed y limits accepted")
+	}
+	flags.Chrom, flags.Log, flags.YLim = "", true, []float64{0, 10}
+	if e = WritePlotSvg(&buf, makePlotTestData(t, flags), nil, flags); !errors.Is(e, ErrBadLogYLim) {
+		t.Errorf("non-positive log y limit accepted: %v", e)
+	}
+}
+
+func TestPlotChromLens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lens.bed")
+	if e := os.WriteFile(path, []byte("2L\t30000\nX\t25000\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	flags := PlotFlags{Chrom: "X"}
+	d := makePlotTestData(t, flags)
+	if len(d.Chroms) != 1 || d.Chroms[0] != "X_ISO1" || len(d.Series[0].Points) != 20 {
+		t.Errorf("chromosome not selected without -G: %v", d.Chroms)
+	}
+
+	flags.Chrom = ""
+	d = makePlotTestData(t, flags)
+	if e := d.SetChromLens(path); e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(d.Chroms, " ") != "2L_ISO1 X_ISO1" || d.ChromLens["2L_ISO1"] != 30000 || d.ChromLens["X_ISO1"] != 25000 {
+		t.Errorf("chromosome lengths not used without -G: %v %v", d.Chroms, d.ChromLens)
+	}
+
+	flags.Genome = "ISO1"
+	d = makePlotTestData(t, flags)
+	if e := d.SetChromLens(path); e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(d.Chroms, " ") != "2L X" || d.ChromLens["2L"] != 30000 {
+		t.Errorf("chromosome lengths not used with -G: %v %v", d.Chroms, d.ChromLens)
+	}
+}
@@ -1,7 +1,10 @@
 package pairviz
 
 import (
+	"encoding/json"
+	"sort"
 	"strconv"
+	"strings"
 	"github.com/jgbaldwinbrown/fasttsv"
 	"fmt"
 	"io"
@@ -14,7 +17,12 @@ type RegionStats struct {
 	TotalBadHits int64
 	TotalHits int64
 	Regions []Region
+	Genomes []string
+	BedNames bool
 	Fpkm bool
+	Orient bool
+	CI PropCI
+	Boot BootFlags
 	Name string
 }
 
@@ -23,17 +31,41 @@ type Region struct {
 	Chrom string
 	Start int64
 	End int64
-	SelfHits int64
-	PairHits int64
-	SelfFpkm float64
-	PairFpkm float64
+	Name string
+	Score string
+	HitSet
+	GenomeHits map[string]*HitSet
+	Boot BootReplicates
+	GenomeBoot map[string]BootReplicates
+}
+
+// The read totals in the form used for window statistics
+func (stats RegionStats) ReadTotals() ReadTotals {
+	return ReadTotals {
+		TotalBadReads: stats.TotalBadHits,
+		TotalGoodReads: stats.TotalGoodHits,
+		TotalReads: stats.TotalHits,
+	}
+}
+
+// Get the hits in a region for one genome, creating them if necessary
+func (r *Region) Genome(genome string) *HitSet {
+	if r.GenomeHits == nil {
+		r.GenomeHits = map[string]*HitSet{}
+	}
+	if _, ok := r.GenomeHits[genome]; !ok {
+		r.GenomeHits[genome] = new(HitSet)
+	}
+	return r.GenomeHits[genome]
 }
 
 // Calculate fpkm for one region and set in place
 func FpkmRegion(region *Region, total_chrom_hits int64) {
 	winsize := region.End - region.Start
-	region.SelfFpkm = Fpkm(region.SelfHits, total_chrom_hits, winsize)
-	region.PairFpkm = Fpkm(region.PairHits, total_chrom_hits, winsize)
+	region.SetFpkm(total_chrom_hits, winsize)
+	for _, ghits := range region.GenomeHits {
+		ghits.SetFpkm(total_chrom_hits, winsize)
+	}
 }
 
 // Check if read pair overlaps a region
@@ -44,6 +76,11 @@ func Overlap(p Pair, r Region) bool {
 	return true
 }
 
+// Check if a read falls inside a region
+func ReadInRegion(read Read, r *Region) bool {
+	return read.Chrom == r.Chrom && read.Pos >= r.Start && read.Pos < r.End
+}
+
 // Increment the self or pair hits for a region
 func IncrementRegion(p Pair, r *Region) {
 	if p.Read1.Parent == p.Read2.Parent {
@@ -53,17 +90,70 @@ func IncrementRegion(p Pair, r *Region) {
 	}
 }
 
-// Parse a bed file line to specify a region; must have first 3 columns
+// Increment the self or pair hits, the overlap hits if readlen != -1, and the
+// orientation hits if orient is set, for a region and for the genome of each
+// read inside it. Each genome is counted at most once per pair.
+func IncrementRegionGenomes(p Pair, r *Region, readlen int64, orient bool) {
+	hit_type := P
+	if p.Read1.Parent == p.Read2.Parent {
+		hit_type = S
+	}
+	ovl_type := HitType(-1)
+	if readlen != -1 {
+		ovl_type = NonOvl
+		if PairOverlaps(p, readlen) {
+			ovl_type = Ovl
+		}
+	}
+
+	facing_type := HitType(-1)
+	if orient {
+		if t, ok := FacingHitType(p); ok {
+			facing_type = t
+		}
+	}
+
+	r.Inc(hit_type)
+	r.Inc(ovl_type)
+	r.Inc(facing_type)
+	for _, genome := range regionPairGenomes(p, r) {
+		g := r.Genome(genome)
+		g.Inc(hit_type)
+		g.Inc(ovl_type)
+		g.Inc(facing_type)
+	}
+}
+
+// The genomes of the reads of a pair that fall in a region, each listed once
+func regionPairGenomes(p Pair, r *Region) []string {
+	var genomes []string
+	in1, in2 := ReadInRegion(p.Read1, r), ReadInRegion(p.Read2, r)
+	if in1 {
+		genomes = append(genomes, p.Read1.Parent)
+	}
+	if in2 && !(in1 && p.Read2.Parent == p.Read1.Parent) {
+		genomes = append(genomes, p.Read2.Parent)
+	}
+	return genomes
+}
+
+// Parse a bed file line to specify a region; must have first 3 columns, and
+// the optional name and score columns are kept
 func ParseRegion(line []string) (region Region, err error) {
-	region_err := fmt.Errorf("Region parse error")
 	if len(line) < 3 {
-		err = region_err
+		err = ErrShortLine
 		return
 	}
 	region.Chrom = line[0]
 	region.Start, err = strconv.ParseInt(line[1], 0, 64)
 	if err != nil { return }
 	region.End, err = strconv.ParseInt(line[2], 0, 64)
+	if len(line) > 3 {
+		region.Name = line[3]
+	}
+	if len(line) > 4 {
+		region.Score = line[4]
+	}
 	return
 }
 
@@ -74,36 +164,88 @@ func GetRegions(path string) (regions []Region, err error) {
 	defer r.Close()
 
 	s := fasttsv.NewScanner(r)
+	lineno := int64(0)
 	for s.Scan() {
+		lineno++
+		if len(s.Line()) == 0 || strings.HasPrefix(s.Line()[0], "#") || strings.HasPrefix(s.Line()[0], "track") || strings.HasPrefix(s.Line()[0], "browser") {
+			continue
+		}
 		var region Region
 		region, err = ParseRegion(s.Line())
-		if err != nil { return }
+		if err != nil {
+			return regions, fmt.Errorf("GetRegions: %v: %w", path, &ParseError{Line: lineno, Text: strings.Join(s.Line(), "\t"), Err: err})
+		}
 		regions = append(regions, region)
 	}
+	if e := s.InScanner.Err(); e != nil {
+		return regions, fmt.Errorf("GetRegions: %w", e)
+	}
 
 	return
 }
 
-func GetRegionStats(flags Flags, r io.Reader) (stats RegionStats, err error) {
+// Start region stats with the regions in the file flags.Region
+func newRegionStats(flags Flags) (stats RegionStats, err error) {
+	stats.Name = flags.Name
+	stats.Orient = flags.Orient
+	stats.CI = NewPropCI(flags)
+	stats.Boot = NewBootFlags(flags)
 	stats.Regions, err = GetRegions(flags.Region)
 	if err != nil { return }
-	s := fasttsv.NewScanner(r)
-	for s.Scan() {
-		pair, ok := ParsePair(s.Line())
+	for _, region := range stats.Regions {
+		if region.Name != "" {
+			stats.BedNames = true
+		}
+	}
+	return stats, nil
+}
+
+// Count the pairs of pr in the regions, returning the genomes seen. The
+// bootstrap weights of data line n of pr come from its ordinal in the whole
+// input, ordinal(n), or n if ordinal is nil, so that reading only part of the
+// input gives the same replicates.
+func (stats *RegionStats) addPairs(flags Flags, pr PairScanner, ordinal func(n int64) int64) (genomes map[string]struct{}, err error) {
+	index := NewRegionIndex(stats.Regions)
+	var hits []int
+	var weights []uint32
+	genomes = map[string]struct{}{}
+	n := int64(-1)
+	for pr.Scan() {
+		n++
+		pair, ok := pr.Pair()
 		if !ok { continue }
 
-		if IsAPair(s.Line()) {
-			stats.TotalHits++
-		}
-		if CheckGood(s.Line()) {
+		stats.TotalHits++
+		if pr.Good() {
 			stats.TotalGoodHits++
 		}
-		for i, _ := range stats.Regions {
-			if Overlap(pair, stats.Regions[i]) && !RangeBad(flags.Distance, flags.MinDistance, flags.PairMinDistance, flags.SelfInMinDistance, pair) {
-				IncrementRegion(pair, &stats.Regions[i])
+		if !pr.Accepted() { continue }
+		for _, read := range []Read{pair.Read1, pair.Read2} {
+			if read.Ok {
+				genomes[read.Parent] = struct{}{}
+			}
+		}
+		if RangeBad(flags.Distance, flags.MinDistance, flags.PairMinDistance, flags.SelfInMinDistance, pair) { continue }
+		hits = index.PairRegions(pair, hits[:0])
+		if stats.Boot.Reps > 0 && len(hits) > 0 {
+			o := n
+			if ordinal != nil {
+				o = ordinal(n)
+			}
+			weights = stats.Boot.Weights(o, weights)
+		}
+		for _, i := range hits {
+			IncrementRegionGenomes(pair, &stats.Regions[i], flags.ReadLen, flags.Orient)
+			if stats.Boot.Reps > 0 {
+				IncrementRegionBoot(pair, &stats.Regions[i], flags.ReadLen, weights)
 			}
 		}
 	}
+	return genomes, pr.Err()
+}
+
+// Calculate FPKMs and the genome list once all pairs are counted
+func (stats *RegionStats) finish(flags Flags, genomes map[string]struct{}) {
 	if !flags.NoFpkm {
 		stats.Fpkm = true
 		for i, _ := range stats.Regions {
@@ -111,41 +253,148 @@ func GetRegionStats(flags Flags, r io.Reader) (stats RegionStats, err error) {
 		}
 	}
 	stats.TotalBadHits = stats.TotalHits - stats.TotalGoodHits
+	for genome, _ := range genomes {
+		stats.Genomes = append(stats.Genomes, genome)
+	}
+	sort.Strings(stats.Genomes)
+}
+
+func GetRegionStats(flags Flags, r io.Reader) (stats RegionStats, err error) {
+	if stats, err = newRegionStats(flags); err != nil {
+		return
+	}
+	pr, err := NewPairScanner(flags, r)
+	if err != nil {
+		return stats, fmt.Errorf("GetRegionStats: %w", err)
+	}
+	genomes, err := stats.addPairs(flags, pr, nil)
+	if err != nil {
+		return stats, fmt.Errorf("GetRegionStats: %w", err)
+	}
+	stats.finish(flags, genomes)
 	return
 }
 
-// Write the stats for all regions as tab-separated text
-func FprintRegionStats(w io.Writer, stats RegionStats) {
-	FprintHeader(w, true, -1, false)
-	format_string := "%s\t%d\t%d\t%s\t%s\t%d\t%d\t%.8g\t%.8g\t%.8g\t%.8g\t%.8g\t%d\t%d"
-	fpkm_format_string := "\t%.8g\t%.8g\t%.8g\t%.8g"
-	name_format_string := "\t%s"
+// Get region stats from an indexed .pairs file, reading only the blocks that
+// hold pairs in the regions. The read totals come from the index.
+func GetRegionStatsIndexed(flags Flags, r io.ReadSeeker, idx *PairsIndex) (stats RegionStats, err error) {
+	if stats, err = newRegionStats(flags); err != nil {
+		return
+	}
+	res, err := flags.Resolver()
+	if err != nil {
+		return stats, fmt.Errorf("GetRegionStatsIndexed: %w", err)
+	}
+	cr := idx.ChunkReader(r, idx.RegionChunks(stats.Regions, res))
+	pr, err := NewPairsReaderFlags(flags, cr)
+	if err != nil {
+		return stats, fmt.Errorf("GetRegionStatsIndexed: %w", err)
+	}
+	if _, err = stats.addPairs(flags, pr, cr.Ordinal); err != nil {
+		return stats, fmt.Errorf("GetRegionStatsIndexed: %w", err)
+	}
+	total, good, genomes := idx.Totals(flags.AcceptTypes, res)
+	stats.TotalHits = total
+	stats.TotalGoodHits = good
+	stats.finish(flags, genomes)
+	return
+}
+
+// Get region stats for the input paths in flags, read from r. A single input
+// path with an index next to it is read through the index instead.
+func GetRegionStatsInputs(flags Flags, r io.Reader) (RegionStats, error) {
+	if len(flags.Inputs) != 1 || flags.Inputs[0] == "-" {
+		return GetRegionStats(flags, r)
+	}
+	path := flags.Inputs[0]
+	idx, ok, err := OpenPairsIndex(path)
+	if err != nil {
+		return RegionStats{}, fmt.Errorf("GetRegionStatsInputs: %w", err)
+	}
+	if !ok {
+		return GetRegionStats(flags, r)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return RegionStats{}, fmt.Errorf("GetRegionStatsInputs: %w", err)
+	}
+	defer f.Close()
+	return GetRegionStatsIndexed(flags, f, idx)
+}
+
+// Write the stats for all regions in the requested format
+func FprintRegionStats(w io.Writer, stats RegionStats, separategenomes bool, readlen int64, jsonOut bool) error {
+	if jsonOut {
+		return FprintRegionStatsJson(w, stats)
+	}
+	FprintRegionStatsPlain(w, stats, separategenomes, readlen)
+	return nil
+}
+
+// Make the JSON statistics for one genome in one region
+func MakeRegionJsonOutStat(genome string, stats RegionStats, region Region, win HitSet) JsonOutStat {
+	length := region.End - region.Start
+	j := MakeJsonOutStat(genome, region.Chrom, stats.Name, stats.ReadTotals(), region.Start, region.End, length, length, win)
+	j.RegionName = region.Name
+	j.RegionScore = region.Score
+	if stats.Orient {
+		j.AddFacing(win)
+	}
+	if len(stats.CI.Methods) > 0 {
+		j.AddCI(win, stats.CI)
+	}
+	if stats.Boot.Reps > 0 {
+		j.AddBoot(stats.Boot, region.GenomeBoot[genome])
+	}
+	return j
+}
+
+// Write the stats for each genome in each region as JSON
+func FprintRegionStatsJson(w io.Writer, stats RegionStats) error {
+	enc := json.NewEncoder(w)
 	for _, region := range stats.Regions {
-		fmt.Fprintf(w,
-			format_string,
-			region.Chrom,
-			region.Start,
-			region.End,
-			"paired",
-			"self",
-			region.PairHits,
-			region.SelfHits,
-			float64(region.PairHits) / (float64(region.PairHits) + float64(region.SelfHits)),
-			float64(region.SelfHits) / (float64(region.PairHits) + float64(region.SelfHits)),
-			float64(region.PairHits) / (float64(stats.TotalGoodHits) + float64(stats.TotalBadHits)),
-			float64(region.PairHits) / float64(stats.TotalGoodHits),
-			float64(region.PairHits) / float64(stats.TotalHits),
-			region.End - region.Start,
-			region.End - region.Start,
-		)
-		if stats.Fpkm {
-			fmt.Fprintf(w,
-				fpkm_format_string,
-				region.PairFpkm,
-				region.SelfFpkm,
-				region.PairFpkm / (region.SelfFpkm + region.PairFpkm),
-				region.SelfFpkm / (region.SelfFpkm + region.PairFpkm),
-			)
+		for _, genome := range stats.Genomes {
+			var win HitSet
+			if g, ok := region.GenomeHits[genome]; ok {
+				win = *g
+			}
+			if err := enc.Encode(MakeRegionJsonOutStat(genome, stats, region, win)); err != nil {
+				return fmt.Errorf("FprintRegionStatsJson: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Write the BED name and score of a region, using "." for missing values
+func fprintRegionBedCols(w io.Writer, region Region) {
+	name, score := region.Name, region.Score
+	if name == "" {
+		name = "."
+	}
+	if score == "" {
+		score = "."
+	}
+	fmt.Fprintf(w, "\t%s\t%s", name, score)
+}
+
+// Write the stats for all regions as tab-separated text, optionally with one
+// row per genome in each region
+func FprintRegionStatsPlain(w io.Writer, stats RegionStats, separategenomes bool, readlen int64) {
+	var extra []string
+	if stats.BedNames {
+		extra = []string{"region_name", "region_score"}
+	}
+	cols := StatCols{Fpkm: stats.Fpkm, ReadLen: readlen, Orient: stats.Orient, CI: stats.CI, Boot: stats.Boot}
+	FprintHeaderCols(w, cols, stats.Name != "", extra)
+	totals := stats.ReadTotals()
+	name_format_string := "\t%s"
+	fprintRow := func(chrom string, region Region, win HitSet, reps BootReplicates) {
+		length := region.End - region.Start
+		FprintStatsRow(w, chrom, region.Start, region.End, length, length, win, totals, cols)
+		FprintBootCols(w, cols.Boot, reps, readlen)
+		if stats.BedNames {
+			fprintRegionBedCols(w, region)
 		}
 		if stats.Name != "" {
 			fmt.Fprintf(w,
@@ -155,4 +404,18 @@ func FprintRegionStats(w io.Writer, stats RegionStats) {
 		}
 		fmt.Fprintln(w, "")
 	}
+
+	for _, region := range stats.Regions {
+		if !separategenomes {
+			fprintRow(region.Chrom, region, region.HitSet, region.Boot)
+			continue
+		}
+		for _, genome := range stats.Genomes {
+			var win HitSet
+			if g, ok := region.GenomeHits[genome]; ok {
+				win = *g
+			}
+			fprintRow(fmt.Sprintf("%s_%s", region.Chrom, genome), region, win, region.GenomeBoot[genome])
+		}
+	}
 }
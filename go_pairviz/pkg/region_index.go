@@ -0,0 +1,95 @@
+package pairviz
+
+import (
+	"sort"
+)
+
+// The regions on one chromosome, sorted by start, with the running maximum
+// end so that searches can stop once no earlier region can reach a position
+type chromRegionIndex struct {
+	Starts []int64
+	Ends []int64
+	MaxEnds []int64
+	Idxs []int
+}
+
+// An index of regions by chromosome for finding every region that contains a
+// position in logarithmic time plus the number of overlapping regions.
+// Overlapping and nested regions are supported.
+type RegionIndex struct {
+	Chroms map[string]*chromRegionIndex
+}
+
+// Build an index of regions; found regions are reported by their index in regions
+func NewRegionIndex(regions []Region) *RegionIndex {
+	byChrom := map[string][]int{}
+	for i, r := range regions {
+		byChrom[r.Chrom] = append(byChrom[r.Chrom], i)
+	}
+
+	ri := &RegionIndex{Chroms: map[string]*chromRegionIndex{}}
+	for chrom, idxs := range byChrom {
+		sort.SliceStable(idxs, func(i, j int) bool {
+			return regions[idxs[i]].Start < regions[idxs[j]].Start
+		})
+		c := &chromRegionIndex {
+			Starts: make([]int64, len(idxs)),
+			Ends: make([]int64, len(idxs)),
+			MaxEnds: make([]int64, len(idxs)),
+			Idxs: idxs,
+		}
+		for i, idx := range idxs {
+			c.Starts[i] = regions[idx].Start
+			c.Ends[i] = regions[idx].End
+			c.MaxEnds[i] = regions[idx].End
+			if i > 0 && c.MaxEnds[i-1] > c.MaxEnds[i] {
+				c.MaxEnds[i] = c.MaxEnds[i-1]
+			}
+		}
+		ri.Chroms[chrom] = c
+	}
+	return ri
+}
+
+// Append the index of every region that contains pos to out
+func (ri *RegionIndex) Containing(chrom string, pos int64, out []int) []int {
+	c, ok := ri.Chroms[chrom]
+	if !ok {
+		return out
+	}
+	// first region starting after pos
+	hi := sort.Search(len(c.Starts), func(i int) bool { return c.Starts[i] > pos })
+	for i := hi - 1; i >= 0 && c.MaxEnds[i] > pos; i-- {
+		if c.Ends[i] > pos {
+			out = append(out, c.Idxs[i])
+		}
+	}
+	return out
+}
+
+// Append the index of every region that either read of a same-chromosome pair
+// falls in to out, reporting each region only once
+func (ri *RegionIndex) PairRegions(p Pair, out []int) []int {
+	if p.Read1.Chrom != p.Read2.Chrom {
+		return out
+	}
+	out = ri.Containing(p.Read1.Chrom, p.Read1.Pos, out)
+	n1 := len(out)
+	out = ri.Containing(p.Read2.Chrom, p.Read2.Pos, out)
+
+	kept := n1
+	for _, idx := range out[n1:] {
+		dup := false
+		for _, idx1 := range out[:n1] {
+			if idx == idx1 {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out[kept] = idx
+			kept++
+		}
+	}
+	return out[:kept]
+}
@@ -0,0 +1,117 @@
+package pairviz
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func linearPairRegions(p Pair, regions []Region) []int {
+	var out []int
+	for i, r := range regions {
+		if Overlap(p, r) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func TestRegionIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	chroms := []string{"2L", "X"}
+	regions := []Region {
+		{Chrom: "2L", Start: 100, End: 1000},
+		{Chrom: "2L", Start: 200, End: 300},
+		{Chrom: "2L", Start: 250, End: 260},
+		{Chrom: "2L", Start: 100, End: 1000},
+	}
+	for i := 0; i < 200; i++ {
+		start := rng.Int63n(5000)
+		regions = append(regions, Region{Chrom: chroms[rng.Intn(2)], Start: start, End: start + 1 + rng.Int63n(800)})
+	}
+	index := NewRegionIndex(regions)
+
+	var got []int
+	for i := 0; i < 2000; i++ {
+		var p Pair
+		p.Read1.Chrom = chroms[rng.Intn(2)]
+		p.Read2.Chrom = p.Read1.Chrom
+		if i % 10 == 0 {
+			p.Read2.Chrom = "3R"
+		}
+		p.Read1.Pos = rng.Int63n(6000)
+		p.Read2.Pos = p.Read1.Pos + rng.Int63n(600) - 300
+
+		got = index.PairRegions(p, got[:0])
+		sort.Ints(got)
+		expect := linearPairRegions(p, regions)
+		if len(got) != len(expect) {
+			t.Fatalf("pair %v: got %v; expected %v", p, got, expect)
+		}
+		for j := range got {
+			if got[j] != expect[j] {
+				t.Fatalf("pair %v: got %v; expected %v", p, got, expect)
+			}
+		}
+	}
+}
+
+func TestIncrementRegionGenomes(t *testing.T) {
+	r, e := ParseRegion([]string{"X", "100", "200", "peak1", "7"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r.Name != "peak1" || r.Score != "7" {
+		t.Errorf("region %v missing name or score", r)
+	}
+
+	var self, paired, outside Pair
+	self.Read1 = Read{Chrom: "X", Parent: "ISO1", Pos: 110, Dir: 1}
+	self.Read2 = Read{Chrom: "X", Parent: "ISO1", Pos: 150, Dir: -1}
+	paired.Read1 = Read{Chrom: "X", Parent: "ISO1", Pos: 120, Dir: 1}
+	paired.Read2 = Read{Chrom: "X", Parent: "W501", Pos: 5000, Dir: -1}
+	outside = paired
+	outside.Read1.Pos = 10
+
+	IncrementRegionGenomes(self, &r, 100, true)
+	IncrementRegionGenomes(paired, &r, 100, true)
+
+	if r.SelfHits != 1 || r.PairHits != 1 || r.OvlHits != 1 || r.NonOvlHits != 1 {
+		t.Errorf("region hits %v wrong", r.HitSet)
+	}
+	if g := r.GenomeHits["ISO1"]; g == nil || g.SelfHits != 1 || g.PairHits != 1 {
+		t.Errorf("ISO1 hits %v wrong", g)
+	}
+	if g, ok := r.GenomeHits["W501"]; ok {
+		t.Errorf("W501 read outside region counted: %v", g)
+	}
+
+	stats := RegionStats{TotalHits: 4, TotalGoodHits: 4, Regions: []Region{r}, Genomes: []string{"ISO1", "W501"}, BedNames: true}
+	j := MakeRegionJsonOutStat("ISO1", stats, r, *r.GenomeHits["ISO1"])
+	if j.RegionName != "peak1" || j.RegionScore != "7" || j.TargetHits != 1 || j.AltOvlHits + j.AltNonOvlHits != 2 {
+		t.Errorf("json stat %v wrong", j)
+	}
+}
+
+func TestRegionGenomesUnmapped(t *testing.T) {
+	flags := gFlags
+	flags.Region = filepath.Join(t.TempDir(), "regions.bed")
+	if e := os.WriteFile(flags.Region, []byte("X\t0\t100\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	flags.AcceptTypes, _ = ParsePairTypes("all")
+	in := "#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type\n" +
+		"r1\t!\t0\tX_W501\t7\t-\t+\tNU\n" +
+		"r2\tX_ISO1\t12\tX_ISO1\t90\t+\t-\tUU\n"
+	stats, e := GetRegionStats(flags, strings.NewReader(in))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(stats.Genomes, []string{"ISO1", "W501"}) {
+		t.Errorf("wrong genomes %q", stats.Genomes)
+	}
+}
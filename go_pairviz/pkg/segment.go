@@ -0,0 +1,474 @@
+package pairviz
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+var ErrBadStates = errors.New("The number of states must be 2 or 3")
+var ErrNoWindows = errors.New("No windows with hits")
+
+// The state names of two- and three-state models, from least to most paired
+var hmmStateNames = map[int][]string{
+	2: {"unpaired", "paired"},
+	3: {"unpaired", "intermediate", "paired"},
+}
+
+// A hidden Markov model of pairing along a chromosome. Each state emits the
+// paired hits of a window as binomial draws from the window's paired and
+// self hits, with paired proportion Prop. States are sorted by Prop.
+type PairHMM struct {
+	Names []string
+	Start []float64
+	Trans [][]float64
+	Prop []float64
+	LogLik float64
+	Iters int
+}
+
+// Make a k-state model with paired proportions spread across the window
+// proportions in series
+func NewPairHMM(k int, series []WinSeries) (*PairHMM, error) {
+	names, ok := hmmStateNames[k]
+	if !ok {
+		return nil, fmt.Errorf("NewPairHMM: %v: %w", k, ErrBadStates)
+	}
+	var props []float64
+	for _, s := range series {
+		for _, w := range s.Wins {
+			if w.Pair + w.Self > 0 {
+				props = append(props, w.Prop())
+			}
+		}
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("NewPairHMM: %w", ErrNoWindows)
+	}
+	sort.Float64s(props)
+
+	h := &PairHMM{Names: names, Start: make([]float64, k), Trans: make([][]float64, k), Prop: make([]float64, k)}
+	for i := 0; i < k; i++ {
+		h.Start[i] = 1 / float64(k)
+		h.Trans[i] = make([]float64, k)
+		for j := range h.Trans[i] {
+			h.Trans[i][j] = 0.01 / float64(k - 1)
+		}
+		h.Trans[i][i] = 0.99
+		h.Prop[i] = clampProp(props[int(float64(len(props) - 1) * (float64(i) + 0.5) / float64(k))])
+	}
+	return h, nil
+}
+
+// Keep proportions away from 0 and 1, so that every state can emit every
+// window
+func clampProp(p float64) float64 {
+	return clamp(p, 1e-6, 1 - 1e-6)
+}
+
+// The log emission probabilities of every state for every window, without
+// the binomial coefficients, which are the same for all states
+func (h *PairHMM) logEmissions(wins []WinCounts) [][]float64 {
+	le := make([][]float64, len(wins))
+	for t, w := range wins {
+		le[t] = make([]float64, len(h.Prop))
+		for k, p := range h.Prop {
+			le[t][k] = w.Pair * math.Log(p) + w.Self * math.Log(1 - p)
+		}
+	}
+	return le
+}
+
+// The scaled forward-backward algorithm. Returns the posterior state
+// probabilities of each window, the expected transition counts, and the
+// log-likelihood.
+func (h *PairHMM) forwardBackward(wins []WinCounts) (post [][]float64, trans [][]float64, loglik float64) {
+	k := len(h.Prop)
+	n := len(wins)
+	le := h.logEmissions(wins)
+	em := make([][]float64, n)
+	for t := range le {
+		max := math.Inf(-1)
+		for _, x := range le[t] {
+			max = math.Max(max, x)
+		}
+		em[t] = make([]float64, k)
+		for j, x := range le[t] {
+			em[t][j] = math.Exp(x - max)
+		}
+		loglik += max
+	}
+
+	alpha := make([][]float64, n)
+	scale := make([]float64, n)
+	for t := 0; t < n; t++ {
+		alpha[t] = make([]float64, k)
+		for j := 0; j < k; j++ {
+			if t == 0 {
+				alpha[t][j] = h.Start[j] * em[t][j]
+				continue
+			}
+			for i := 0; i < k; i++ {
+				alpha[t][j] += alpha[t - 1][i] * h.Trans[i][j]
+			}
+			alpha[t][j] *= em[t][j]
+		}
+		for _, a := range alpha[t] {
+			scale[t] += a
+		}
+		for j := range alpha[t] {
+			alpha[t][j] /= scale[t]
+		}
+		loglik += math.Log(scale[t])
+	}
+
+	beta := make([]float64, k)
+	next := make([]float64, k)
+	for j := range beta {
+		beta[j] = 1
+	}
+	post = make([][]float64, n)
+	trans = make([][]float64, k)
+	for i := range trans {
+		trans[i] = make([]float64, k)
+	}
+	for t := n - 1; t >= 0; t-- {
+		post[t] = make([]float64, k)
+		for j := range post[t] {
+			post[t][j] = alpha[t][j] * beta[j]
+		}
+		if t == 0 {
+			break
+		}
+		for i := 0; i < k; i++ {
+			next[i] = 0
+			for j := 0; j < k; j++ {
+				x := h.Trans[i][j] * em[t][j] * beta[j] / scale[t]
+				trans[i][j] += alpha[t - 1][i] * x
+				next[i] += x
+			}
+		}
+		beta, next = next, beta
+	}
+	return post, trans, loglik
+}
+
+// Fit the model to series with the Baum-Welch algorithm, stopping after
+// maxiter iterations or when the log-likelihood improves by less than tol
+func (h *PairHMM) Fit(series []WinSeries, maxiter int, tol float64) {
+	k := len(h.Prop)
+	h.LogLik = math.Inf(-1)
+	for h.Iters = 0; h.Iters < maxiter; h.Iters++ {
+		start := make([]float64, k)
+		trans := make([][]float64, k)
+		for i := range trans {
+			trans[i] = make([]float64, k)
+		}
+		pair := make([]float64, k)
+		total := make([]float64, k)
+		loglik := 0.0
+		nseq := 0.0
+
+		for _, s := range series {
+			if len(s.Wins) == 0 {
+				continue
+			}
+			post, strans, sloglik := h.forwardBackward(s.Wins)
+			loglik += sloglik
+			nseq++
+			for j := range start {
+				start[j] += post[0][j]
+			}
+			for i := range trans {
+				for j := range trans[i] {
+					trans[i][j] += strans[i][j]
+				}
+			}
+			for t, w := range s.Wins {
+				for j, p := range post[t] {
+					pair[j] += p * w.Pair
+					total[j] += p * (w.Pair + w.Self)
+				}
+			}
+		}
+
+		for j := 0; j < k; j++ {
+			h.Start[j] = start[j] / nseq
+			rowsum := 0.0
+			for _, x := range trans[j] {
+				rowsum += x
+			}
+			if rowsum > 0 {
+				for i, x := range trans[j] {
+					h.Trans[j][i] = x / rowsum
+				}
+			}
+			if total[j] > 0 {
+				h.Prop[j] = clampProp(pair[j] / total[j])
+			}
+		}
+		h.sortStates()
+
+		done := loglik - h.LogLik < tol
+		h.LogLik = loglik
+		if done {
+			h.Iters++
+			break
+		}
+	}
+}
+
+// Reorder the states by paired proportion
+func (h *PairHMM) sortStates() {
+	k := len(h.Prop)
+	order := make([]int, k)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return h.Prop[order[i]] < h.Prop[order[j]]
+	})
+	start := make([]float64, k)
+	prop := make([]float64, k)
+	trans := make([][]float64, k)
+	for i, oi := range order {
+		start[i] = h.Start[oi]
+		prop[i] = h.Prop[oi]
+		trans[i] = make([]float64, k)
+		for j, oj := range order {
+			trans[i][j] = h.Trans[oi][oj]
+		}
+	}
+	h.Start, h.Prop, h.Trans = start, prop, trans
+}
+
+// The most likely state path through wins
+func (h *PairHMM) Viterbi(wins []WinCounts) []int {
+	k := len(h.Prop)
+	n := len(wins)
+	if n == 0 {
+		return nil
+	}
+	le := h.logEmissions(wins)
+	back := make([][]int, n)
+	score := make([]float64, k)
+	next := make([]float64, k)
+	for j := range score {
+		score[j] = math.Log(h.Start[j]) + le[0][j]
+	}
+	for t := 1; t < n; t++ {
+		back[t] = make([]int, k)
+		for j := 0; j < k; j++ {
+			best, bi := math.Inf(-1), 0
+			for i := 0; i < k; i++ {
+				if s := score[i] + math.Log(h.Trans[i][j]); s > best {
+					best, bi = s, i
+				}
+			}
+			next[j] = best + le[t][j]
+			back[t][j] = bi
+		}
+		score, next = next, score
+	}
+
+	path := make([]int, n)
+	for j := range score {
+		if score[j] > score[path[n - 1]] {
+			path[n - 1] = j
+		}
+	}
+	for t := n - 1; t > 0; t-- {
+		path[t - 1] = back[t][path[t]]
+	}
+	return path
+}
+
+// A run of windows in the same state. Posterior is the mean posterior
+// probability of the state over the windows, and Prop is the pooled paired
+// proportion of the windows.
+type Segment struct {
+	Chrom string
+	Start int64
+	End int64
+	State int
+	Name string
+	Posterior float64
+	Prop float64
+	Wins int
+}
+
+// The segments of one chromosome along the Viterbi path, and the posterior
+// probability of the most paired state in each window. Where sliding windows
+// in neighbouring segments overlap, the boundary is the middle of the
+// overlap.
+func (h *PairHMM) Segment(s WinSeries) ([]Segment, []TrackRecord) {
+	path := h.Viterbi(s.Wins)
+	post, _, _ := h.forwardBackward(s.Wins)
+	top := len(h.Prop) - 1
+
+	var segs []Segment
+	var pair, total float64
+	recs := make([]TrackRecord, 0, len(s.Wins))
+	for t, w := range s.Wins {
+		recs = append(recs, TrackRecord{s.Chrom, w.Start, w.End, post[t][top]})
+		state := path[t]
+		if t == 0 || state != path[t - 1] {
+			start := w.Start
+			if len(segs) > 0 {
+				prev := &segs[len(segs) - 1]
+				prev.Prop = pair / total
+				start = winBoundary(s.Wins[t - 1], w)
+				if prev.End > start {
+					prev.End = start
+				}
+			}
+			segs = append(segs, Segment{Chrom: s.Chrom, Start: start, State: state, Name: h.Names[state]})
+			pair, total = 0, 0
+		}
+		seg := &segs[len(segs) - 1]
+		seg.End = w.End
+		seg.Posterior += post[t][state]
+		seg.Wins++
+		pair += w.Pair
+		total += w.Pair + w.Self
+	}
+	if len(segs) > 0 {
+		segs[len(segs) - 1].Prop = pair / total
+	}
+	for i := range segs {
+		segs[i].Posterior /= float64(segs[i].Wins)
+	}
+	return segs, recs
+}
+
+// Write segments as BED6 plus two columns: chromosome, start, end, state
+// name, 1000 times the mean posterior as the score, no strand, the mean
+// posterior, and the paired proportion, which is "." for segments without hits
+func WriteSegmentBed(w io.Writer, segs []Segment) error {
+	for _, s := range segs {
+		prop := "."
+		if !math.IsNaN(s.Prop) {
+			prop = strconv.FormatFloat(s.Prop, 'g', 6, 64)
+		}
+		score := int(math.Round(1000 * s.Posterior))
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t.\t%.6g\t%s\n", s.Chrom, s.Start, s.End, s.Name, score, s.Posterior, prop); err != nil {
+			return fmt.Errorf("WriteSegmentBed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Options for HMM segmentation
+type SegmentFlags struct {
+	WinCountsFlags
+	States int
+	MaxIter int
+	Tol float64
+}
+
+// Fit a model to the windows in r and segment every chromosome. The track
+// holds the posterior probability of the most paired state in each window.
+func SegmentPairing(r io.Reader, flags SegmentFlags) (*PairHMM, []Segment, *Track, error) {
+	series, err := ReadWinCounts(r, flags.WinCountsFlags)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("SegmentPairing: %w", err)
+	}
+	h, err := NewPairHMM(flags.States, series)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("SegmentPairing: %w", err)
+	}
+	h.Fit(series, flags.MaxIter, flags.Tol)
+
+	var segs []Segment
+	track := &Track{Name: "posterior " + h.Names[len(h.Names) - 1]}
+	for _, s := range series {
+		ssegs, recs := h.Segment(s)
+		segs = append(segs, ssegs...)
+		track.Records = append(track.Records, recs...)
+	}
+	track.Sort()
+	track.TrimOverlaps()
+	return h, segs, track, nil
+}
+
+func FullSegment() {
+	var flags SegmentFlags
+	inpath := flag.String("i", "", "Input path of pairviz window output, JSON or tab-separated (default stdin)")
+	outpath := flag.String("o", "", "Segment BED output path (default stdout)")
+	postpath := flag.String("post", "", "Write a track of the posterior probability of the most paired state in each window to this path")
+	formatp := flag.String("pf", "", "Posterior track format, bedgraph or bigwig (default from the -post extension: .bw and .bigwig are bigwig)")
+	chrlens := flag.String("chrlens", "", "Tab-separated file of chromosome lengths, used as the chromosome sizes of bigwig output")
+	modelpath := flag.String("model", "", "Write the fitted model as JSON to this path")
+	flag.StringVar(&flags.Format, "f", "", "Input format, json or tsv (default: detected from the input)")
+	flag.StringVar(&flags.Name, "n", "", "Only use records with this Name")
+	flag.StringVar(&flags.Genome, "g", "", "Only use JSON records from this genome, keeping the original chromosome names")
+	flag.IntVar(&flags.States, "k", 2, "Number of states, 2 (unpaired, paired) or 3 (unpaired, intermediate, paired)")
+	flag.IntVar(&flags.MaxIter, "iter", 200, "Maximum number of Baum-Welch iterations")
+	flag.Float64Var(&flags.Tol, "tol", 1e-6, "Stop fitting when the log-likelihood improves by less than this")
+	flag.Parse()
+
+	if _, ok := hmmStateNames[flags.States]; !ok {
+		fmt.Fprintln(os.Stderr, ErrBadStates)
+		os.Exit(2)
+	}
+	if flags.MaxIter < 1 {
+		fmt.Fprintln(os.Stderr, "-iter must be at least 1")
+		os.Exit(2)
+	}
+	format, e := ParseTrackFormat(*formatp, *postpath)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	h := func(e error) {
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	var lens map[string]int64
+	if *chrlens != "" {
+		lens, e = ReadChromLens(*chrlens)
+		h(e)
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if *inpath != "" {
+		r, e = OpenMaybeGz(*inpath)
+		h(e)
+	}
+	hmm, segs, track, e := SegmentPairing(r, flags)
+	r.Close()
+	h(e)
+
+	out := os.Stdout
+	if *outpath != "" {
+		out, e = os.Create(*outpath)
+		h(e)
+	}
+	w := bufio.NewWriter(out)
+	h(WriteSegmentBed(w, segs))
+	h(w.Flush())
+	h(out.Close())
+
+	if *postpath != "" {
+		h(WriteTrackPath(*postpath, track, format, lens))
+	}
+	if *modelpath != "" {
+		mw, e := os.Create(*modelpath)
+		h(e)
+		enc := json.NewEncoder(mw)
+		enc.SetIndent("", "\t")
+		h(enc.Encode(hmm))
+		h(mw.Close())
+	}
+}
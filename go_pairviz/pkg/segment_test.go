@@ -0,0 +1,120 @@
+package pairviz
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Binomial windows of width 100 and step 50, with paired proportion props[i]
+// from each change in changes[i]
+func makeSegmentTestWins(chrom string, n int, changes []int, props []float64, rng *rand.Rand) []WinCounts {
+	var wins []WinCounts
+	p := props[0]
+	for i := 0; i < n; i++ {
+		for c, at := range changes {
+			if i == at {
+				p = props[c]
+			}
+		}
+		w := WinCounts{Chrom: chrom, Start: int64(i) * 50, End: int64(i) * 50 + 100}
+		for j := 0; j < 40; j++ {
+			if rng.Float64() < p {
+				w.Pair++
+			} else {
+				w.Self++
+			}
+		}
+		wins = append(wins, w)
+	}
+	return wins
+}
+
+func TestSegmentPairing(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	wins := append(
+		makeSegmentTestWins("X_ISO1", 200, []int{0, 60, 140}, []float64{0.1, 0.6, 0.1}, rng),
+		makeSegmentTestWins("2L_ISO1", 100, []int{0, 50}, []float64{0.6, 0.1}, rng)...,
+	)
+	var tsv bytes.Buffer
+	fmt.Fprintf(&tsv, "chrom\tstart\tend\thit_type\talt_hit_type\thits\talt_hits\tpair_prop\n")
+	for _, w := range wins {
+		fmt.Fprintf(&tsv, "%v\t%v\t%v\tpaired\tself\t%v\t%v\t%v\n", w.Chrom, w.Start, w.End, w.Pair, w.Self, w.Prop())
+	}
+	var js bytes.Buffer
+	for _, w := range wins {
+		chr, genome, _ := strings.Cut(w.Chrom, "_")
+		fmt.Fprintf(&js, `{"Genome":%q,"Chr":%q,"Start":%v,"End":%v,"TargetHits":%v,"AltHits":%v}`+"\n", genome, chr, w.Start, w.End, w.Pair, w.Self)
+	}
+
+	flags := SegmentFlags{States: 2, MaxIter: 100, Tol: 1e-6}
+	h, segs, track, e := SegmentPairing(strings.NewReader(tsv.String()), flags)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if math.Abs(h.Prop[0] - 0.1) > 0.02 || math.Abs(h.Prop[1] - 0.6) > 0.03 {
+		t.Errorf("fitted proportions %v", h.Prop)
+	}
+	type seg struct {
+		chrom, name string
+		start, end int64
+	}
+	var got []seg
+	for _, s := range segs {
+		got = append(got, seg{s.Chrom, s.Name, s.Start, s.End})
+	}
+	want := []seg{
+		{"2L_ISO1", "paired", 0, 2525},
+		{"2L_ISO1", "unpaired", 2525, 5050},
+		{"X_ISO1", "unpaired", 0, 3025},
+		{"X_ISO1", "paired", 3025, 7025},
+		{"X_ISO1", "unpaired", 7025, 10050},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("segments %v != %v", got, want)
+	}
+	for _, s := range segs {
+		if s.Posterior < 0.9 || s.Posterior > 1 {
+			t.Errorf("low posterior: %v", s)
+		}
+	}
+	if len(track.Records) != len(wins) || track.Records[0].Value < 0.99 || track.Records[len(wins) - 1].Value > 0.01 {
+		t.Errorf("wrong posterior track: %v", track.Records[:3])
+	}
+
+	_, jsegs, _, e := SegmentPairing(strings.NewReader(js.String()), flags)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !reflect.DeepEqual(segs, jsegs) {
+		t.Errorf("JSON segments differ from tab-separated segments")
+	}
+
+	flags.States = 3
+	h3, _, _, e := SegmentPairing(strings.NewReader(js.String()), flags)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(h3.Prop) != 3 || !(h3.Prop[0] <= h3.Prop[1] && h3.Prop[1] <= h3.Prop[2]) || h3.LogLik < h.LogLik - 1e-6 {
+		t.Errorf("bad three-state model: %v, log-likelihood %v vs %v", h3.Prop, h3.LogLik, h.LogLik)
+	}
+}
+
+func TestWriteSegmentBed(t *testing.T) {
+	segs := []Segment{
+		{Chrom: "X", Start: 0, End: 500, State: 1, Name: "paired", Posterior: 0.9876, Prop: 0.6, Wins: 9},
+		{Chrom: "X", Start: 500, End: 800, State: 0, Name: "unpaired", Posterior: 0.5, Prop: math.NaN(), Wins: 5},
+	}
+	var buf bytes.Buffer
+	if e := WriteSegmentBed(&buf, segs); e != nil {
+		t.Fatal(e)
+	}
+	want := "X\t0\t500\tpaired\t988\t.\t0.9876\t0.6\nX\t500\t800\tunpaired\t500\t.\t0.5\t.\n"
+	if buf.String() != want {
+		t.Errorf("wrong BED:\n%v", buf.String())
+	}
+}
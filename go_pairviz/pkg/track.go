@@ -0,0 +1,311 @@
+package pairviz
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var ErrBadMetric = errors.New("Metric is not a numeric pairviz output field")
+var ErrMissingMetric = errors.New("Metric is not present in this record")
+var ErrBadTrackFormat = errors.New("Unknown track format")
+
+// One interval of a track
+type TrackRecord struct {
+	Chrom string
+	Start int64
+	End int64
+	Value float64
+}
+
+// Intervals sorted by chromosome and position, ready to write as a track
+type Track struct {
+	Name string
+	Records []TrackRecord
+}
+
+// Check that metric names a numeric field of JsonOutStat, including the
+// optional fields, and return its index
+func metricIndex(metric string) ([]int, error) {
+	return structMetricIndex(reflect.TypeOf(JsonOutStat{}), metric)
+}
+
+// Check that metric names a numeric field of the struct type typ, and return
+// its index
+func structMetricIndex(typ reflect.Type, metric string) ([]int, error) {
+	f, ok := typ.FieldByName(metric)
+	if !ok {
+		return nil, fmt.Errorf("metricIndex: %q: %w", metric, ErrBadMetric)
+	}
+	switch f.Type.Kind() {
+	case reflect.Float64, reflect.Int64:
+		return f.Index, nil
+	default:
+	}
+	return nil, fmt.Errorf("metricIndex: %q: %w", metric, ErrBadMetric)
+}
+
+// Get the value of a metric, such as TargetProp or AltHits, from one record
+func JsonMetric(j JsonOutStat, metric string) (float64, error) {
+	index, err := metricIndex(metric)
+	if err != nil {
+		return 0, fmt.Errorf("JsonMetric: %w", err)
+	}
+	return jsonMetricIndex(j, metric, index)
+}
+
+func jsonMetricIndex(j JsonOutStat, metric string, index []int) (float64, error) {
+	v, err := reflect.ValueOf(j).FieldByIndexErr(index)
+	if err != nil {
+		return 0, fmt.Errorf("JsonMetric: %q: %w", metric, ErrMissingMetric)
+	}
+	if v.Kind() == reflect.Int64 {
+		return float64(v.Int()), nil
+	}
+	return v.Float(), nil
+}
+
+// Options for building tracks from pairviz JSON output
+type TrackFlags struct {
+	Metric string
+	Name string
+	SeparateGenomes bool
+}
+
+// Collect the chosen metric from pairviz JSON records into tracks. Without
+// SeparateGenomes, there is one track, and chromosomes are named
+// <chrom>_<genome> as in the tab-separated output with -G. With
+// SeparateGenomes, there is one track per genome, keyed by genome, with the
+// original chromosome names. Records whose Name is not flags.Name are
+// skipped if flags.Name is set, and NaN or infinite values are left out.
+func CollectTracks(it iter.Seq2[JsonOutStat, error], flags TrackFlags) (map[string]*Track, error) {
+	index, err := metricIndex(flags.Metric)
+	if err != nil {
+		return nil, fmt.Errorf("CollectTracks: %w", err)
+	}
+	tracks := map[string]*Track{}
+	for j, err := range it {
+		if err != nil {
+			return nil, fmt.Errorf("CollectTracks: %w", err)
+		}
+		if flags.Name != "" && j.Name != flags.Name {
+			continue
+		}
+		val, err := jsonMetricIndex(j, flags.Metric, index)
+		if err != nil {
+			return nil, fmt.Errorf("CollectTracks: %v:%v-%v: %w", j.Chr, j.Start, j.End, err)
+		}
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+
+		key := ""
+		chrom := j.Chr + "_" + j.Genome
+		if flags.SeparateGenomes {
+			key = j.Genome
+			chrom = j.Chr
+		}
+		if _, ok := tracks[key]; !ok {
+			tracks[key] = &Track{Name: flags.Metric}
+			if key != "" {
+				tracks[key].Name = flags.Metric + " " + key
+			}
+		}
+		tracks[key].Records = append(tracks[key].Records, TrackRecord{Chrom: chrom, Start: j.Start, End: j.End, Value: val})
+	}
+	for _, t := range tracks {
+		t.Sort()
+		t.TrimOverlaps()
+	}
+	return tracks, nil
+}
+
+// Sort records by chromosome name, then position
+func (t *Track) Sort() {
+	sort.SliceStable(t.Records, func(i, j int) bool {
+		a, b := t.Records[i], t.Records[j]
+		if a.Chrom != b.Chrom {
+			return a.Chrom < b.Chrom
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.End < b.End
+	})
+}
+
+// Tracks cannot contain overlapping intervals, so split the overlap between
+// neighbouring sliding windows at its midpoint. Windows that are left empty
+// are removed. The records must be sorted.
+func (t *Track) TrimOverlaps() {
+	recs := t.Records
+	for i := 0; i+1 < len(recs); i++ {
+		a, b := &recs[i], &recs[i+1]
+		if a.Chrom != b.Chrom || b.Start >= a.End {
+			continue
+		}
+		mid := (a.End + b.Start) / 2
+		a.End = mid
+		b.Start = mid
+	}
+	out := recs[:0]
+	for _, rec := range recs {
+		if rec.End > rec.Start {
+			out = append(out, rec)
+		}
+	}
+	t.Records = out
+}
+
+// The end of the last interval on each chromosome, replaced by the lengths in
+// chromlens where given
+func (t *Track) ChromSizes(chromlens map[string]int64) map[string]int64 {
+	sizes := map[string]int64{}
+	for _, rec := range t.Records {
+		setMaxLen(sizes, rec.Chrom, rec.End)
+	}
+	for chrom, size := range sizes {
+		if l, ok := chromlens[chrom]; ok && l > size {
+			sizes[chrom] = l
+		}
+	}
+	return sizes
+}
+
+// Write a track as bedGraph, with a track line
+func WriteBedGraph(w io.Writer, t *Track) error {
+	if _, err := fmt.Fprintf(w, "track type=bedGraph name=%q\n", t.Name); err != nil {
+		return fmt.Errorf("WriteBedGraph: %w", err)
+	}
+	for _, rec := range t.Records {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%.8g\n", rec.Chrom, rec.Start, rec.End, rec.Value); err != nil {
+			return fmt.Errorf("WriteBedGraph: %w", err)
+		}
+	}
+	return nil
+}
+
+// The output track formats
+type TrackFormat int
+
+const (
+	BedGraphFormat TrackFormat = iota
+	BigWigFormat
+)
+
+// Parse a track format name: "bedgraph" or "bigwig". An empty name picks
+// the format from the extension of path.
+func ParseTrackFormat(name, path string) (TrackFormat, error) {
+	if name == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".bw", ".bigwig": return BigWigFormat, nil
+		default:
+		}
+		return BedGraphFormat, nil
+	}
+	switch strings.ToLower(name) {
+	case "bedgraph", "bg": return BedGraphFormat, nil
+	case "bigwig", "bw": return BigWigFormat, nil
+	default:
+	}
+	return BedGraphFormat, fmt.Errorf("ParseTrackFormat: %q: %w", name, ErrBadTrackFormat)
+}
+
+// The output path for one genome's track: the genome is added before the
+// extension of path
+func GenomeTrackPath(path, genome string) string {
+	if genome == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + genome + ext
+}
+
+// Write a track to path in the requested format
+func WriteTrackPath(path string, t *Track, format TrackFormat, chromlens map[string]int64) (err error) {
+	w, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("WriteTrackPath: %w", err)
+	}
+	defer func() {
+		if e := w.Close(); err == nil && e != nil {
+			err = fmt.Errorf("WriteTrackPath: %w", e)
+		}
+	}()
+
+	if format == BigWigFormat {
+		return WriteBigWig(w, t, t.ChromSizes(chromlens))
+	}
+	bw := bufio.NewWriter(w)
+	if err = WriteBedGraph(bw, t); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Read pairviz JSON output and write one track, or one track per genome, to
+// outpath
+func MakeTracks(r io.Reader, outpath string, format TrackFormat, chromlens map[string]int64, flags TrackFlags) error {
+	tracks, err := CollectTracks(ParsePairvizOut(r), flags)
+	if err != nil {
+		return fmt.Errorf("MakeTracks: %w", err)
+	}
+	for _, key := range sortedKeys(tracks) {
+		if err = WriteTrackPath(GenomeTrackPath(outpath, key), tracks[key], format, chromlens); err != nil {
+			return fmt.Errorf("MakeTracks: %w", err)
+		}
+	}
+	return nil
+}
+
+func FullTrack() {
+	var flags TrackFlags
+	inpath := flag.String("i", "", "Input path of pairviz JSON output (default stdin)")
+	outpath := flag.String("o", "", "Output path (required); with -G, the genome name is added before the extension")
+	formatp := flag.String("f", "", "Output format, bedgraph or bigwig (default from the -o extension: .bw and .bigwig are bigwig)")
+	chrlens := flag.String("chrlens", "", "Tab-separated file of chromosome lengths, used as the chromosome sizes of bigwig output")
+	flag.StringVar(&flags.Metric, "m", "TargetProp", "Field of the JSON output to write, such as TargetProp, TargetFpkm, or AltHits")
+	flag.StringVar(&flags.Name, "n", "", "Only use records with this Name")
+	flag.BoolVar(&flags.SeparateGenomes, "G", false, "Write one track per genome, with the original chromosome names")
+	flag.Parse()
+	if *outpath == "" {
+		fmt.Fprintln(os.Stderr, "missing -o")
+		os.Exit(2)
+	}
+	format, e := ParseTrackFormat(*formatp, *outpath)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+
+	var lens map[string]int64
+	if *chrlens != "" {
+		if lens, e = ReadChromLens(*chrlens); e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if *inpath != "" {
+		if r, e = OpenMaybeGz(*inpath); e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			os.Exit(1)
+		}
+	}
+	defer r.Close()
+
+	if e = MakeTracks(r, *outpath, format, lens, flags); e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,154 @@
+package pairviz
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCollectTracks(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, j := range []JsonOutStat {
+		{Genome: "ISO1", Chr: "2L", Start: 10, End: 30, TargetProp: 0.5, AltHits: 3},
+		{Genome: "ISO1", Chr: "2L", Start: 0, End: 20, TargetProp: 0.25, AltHits: 1},
+		{Genome: "W501", Chr: "2L", Start: 0, End: 20, TargetProp: JsonFloat(math.NaN()), AltHits: 2},
+	} {
+		enc.Encode(j)
+	}
+	in := buf.String()
+
+	tracks, err := CollectTracks(ParsePairvizOut(strings.NewReader(in)), TrackFlags{Metric: "TargetProp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TrackRecord{{"2L_ISO1", 0, 15, 0.25}, {"2L_ISO1", 15, 30, 0.5}}
+	if len(tracks) != 1 || fmt.Sprint(tracks[""].Records) != fmt.Sprint(want) {
+		t.Errorf("tracks %v != %v", tracks[""], want)
+	}
+
+	tracks, err = CollectTracks(ParsePairvizOut(strings.NewReader(in)), TrackFlags{Metric: "AltHits", SeparateGenomes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || fmt.Sprint(tracks["W501"].Records) != fmt.Sprint([]TrackRecord{{"2L", 0, 20, 2}}) {
+		t.Errorf("separate genome tracks wrong: %v", tracks)
+	}
+
+	var out bytes.Buffer
+	WriteBedGraph(&out, tracks["W501"])
+	if out.String() != "track type=bedGraph name=\"AltHits W501\"\n2L\t0\t20\t2\n" {
+		t.Errorf("bedGraph wrong: %q", out.String())
+	}
+
+	if _, err = CollectTracks(ParsePairvizOut(strings.NewReader(in)), TrackFlags{Metric: "Chr"}); err == nil {
+		t.Errorf("non-numeric metric accepted")
+	}
+	if _, err = CollectTracks(ParsePairvizOut(strings.NewReader(in)), TrackFlags{Metric: "TransHits"}); err == nil {
+		t.Errorf("metric missing from records accepted")
+	}
+}
+
+// Read the data records of a bigWig file by walking its chromosome tree and
+// R tree index
+func readBigWig(p []byte) (chroms map[uint32]string, recs []TrackRecord, hdr bbiHeader, err error) {
+	le := binary.LittleEndian
+	if err = binary.Read(bytes.NewReader(p), le, &hdr); err != nil {
+		return
+	}
+	if hdr.Magic != bigWigMagic || le.Uint32(p[len(p)-4:]) != bigWigMagic {
+		return nil, nil, hdr, fmt.Errorf("bad magic")
+	}
+
+	chroms = map[uint32]string{}
+	ct := p[hdr.ChromTreeOffset:]
+	keySize := int(le.Uint32(ct[8:]))
+	count := int(le.Uint16(ct[34:]))
+	for i := 0; i < count; i++ {
+		item := ct[36 + i * (keySize + 8):]
+		chroms[le.Uint32(item[keySize:])] = strings.TrimRight(string(item[:keySize]), "\x00")
+	}
+
+	var walk func(off uint64) error
+	walk = func(off uint64) error {
+		node := p[off:]
+		leaf := node[0] == 1
+		n := int(le.Uint16(node[2:]))
+		for i := 0; i < n; i++ {
+			if !leaf {
+				if err := walk(le.Uint64(node[4 + i * 24 + 16:])); err != nil {
+					return err
+				}
+				continue
+			}
+			item := node[4 + i * 32:]
+			off, size := le.Uint64(item[16:]), le.Uint64(item[24:])
+			zr, err := zlib.NewReader(bytes.NewReader(p[off:off + size]))
+			if err != nil {
+				return err
+			}
+			raw, err := io.ReadAll(zr)
+			if err != nil {
+				return err
+			}
+			if len(raw) > int(hdr.UncompressBufSize) {
+				return fmt.Errorf("block larger than uncompressBufSize")
+			}
+			chrom := chroms[le.Uint32(raw)]
+			for k := 0; k < int(le.Uint16(raw[22:])); k++ {
+				r := raw[24 + k * 12:]
+				var v float32
+				binary.Read(bytes.NewReader(r[8:12]), le, &v)
+				recs = append(recs, TrackRecord{chrom, int64(le.Uint32(r)), int64(le.Uint32(r[4:])), float64(v)})
+			}
+		}
+		return nil
+	}
+	if le.Uint32(p[hdr.FullIndexOffset:]) != cirTreeMagic {
+		return nil, nil, hdr, fmt.Errorf("bad index magic")
+	}
+	err = walk(hdr.FullIndexOffset + 48)
+	return
+}
+
+func TestWriteBigWig(t *testing.T) {
+	var track Track
+	sizes := map[string]int64{}
+	// Enough chromosomes for more than one node in the index
+	for i := 0; i < 300; i++ {
+		chrom := fmt.Sprintf("chr%03d", i)
+		sizes[chrom] = 100000
+		for start := int64(0); start < 5000; start += 100 {
+			track.Records = append(track.Records, TrackRecord{chrom, start, start + 100, float64(start) / 100})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBigWig(&buf, &track, sizes); err != nil {
+		t.Fatal(err)
+	}
+	chroms, recs, hdr, err := readBigWig(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chroms) != 300 || chroms[299] != "chr299" {
+		t.Errorf("chromosomes wrong: %v", len(chroms))
+	}
+	if fmt.Sprint(recs) != fmt.Sprint(track.Records) {
+		t.Errorf("records do not match: %v != %v", len(recs), len(track.Records))
+	}
+	if hdr.ZoomLevels < 1 {
+		t.Errorf("no zoom levels")
+	}
+
+	covered := binary.LittleEndian.Uint64(buf.Bytes()[hdr.TotalSummaryOffset:])
+	if covered != 300 * 5000 {
+		t.Errorf("bases covered %v != %v", covered, 300 * 5000)
+	}
+}
@@ -0,0 +1,62 @@
+package pairviz
+
+import (
+	"fmt"
+	"io"
+)
+
+// Check if both reads of a pair are aligned, but to different chromosomes
+func IsTrans(p Pair) bool {
+	return p.Read1.Ok && p.Read2.Ok && p.Read1.Chrom != p.Read2.Chrom
+}
+
+// The trans hit type of a pair: trans-self if both reads come from the same
+// parent, otherwise trans-paired
+func TransHitType(p Pair) HitType {
+	if p.Read1.Parent == p.Read2.Parent {
+		return TS
+	}
+	return TP
+}
+
+// The proportion of trans hits that are trans-paired
+func (h HitSet) TransPairProp() float64 {
+	return float64(h.TransPairHits) / (float64(h.TransPairHits) + float64(h.TransSelfHits))
+}
+
+// The proportion of all cis and trans hits that are trans
+func (h HitSet) TransProp() float64 {
+	trans := float64(h.TransPairHits) + float64(h.TransSelfHits)
+	return trans / (trans + float64(h.PairHits) + float64(h.SelfHits))
+}
+
+// Trans hit statistics for one window, only included in JSON output when
+// trans hits are counted
+type TransJsonStat struct {
+	TransSelfHits JsonFloat
+	TransPairHits JsonFloat
+	TransPairProp JsonFloat
+	TransProp JsonFloat
+	TransSelfFpkm JsonFloat
+	TransPairFpkm JsonFloat
+}
+
+// Add the trans hit statistics for win to j
+func (j *JsonOutStat) AddTrans(win HitSet) {
+	j.TransJsonStat = &TransJsonStat {
+		TransSelfHits: JsonFloat(win.TransSelfHits),
+		TransPairHits: JsonFloat(win.TransPairHits),
+		TransPairProp: JsonFloat(win.TransPairProp()),
+		TransProp: JsonFloat(win.TransProp()),
+		TransSelfFpkm: JsonFloat(win.TransSelfFpkm),
+		TransPairFpkm: JsonFloat(win.TransPairFpkm),
+	}
+}
+
+// Write the trans hit columns for one window
+func FprintTransCols(w io.Writer, win HitSet, fpkm bool) {
+	fmt.Fprintf(w, "\t%d\t%d\t%.8g\t%.8g", win.TransSelfHits, win.TransPairHits, win.TransPairProp(), win.TransProp())
+	if fpkm {
+		fmt.Fprintf(w, "\t%.8g\t%.8g", win.TransSelfFpkm, win.TransPairFpkm)
+	}
+}
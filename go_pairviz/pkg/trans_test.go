@@ -0,0 +1,58 @@
+package pairviz
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const gTransIn = `#columns: readID chrom1 pos1 chrom2 pos2 strand1 strand2 pair_type
+r1	X_ISO1	1	4_ISO1	3	+	-	UU
+r2	X_ISO1	2	4_W501	4	+	-	UU
+r3	X_ISO1	3	X_ISO1	8	+	-	UU
+r4	X_ISO1	4	!	0	+	-	UN
+`
+
+func TestTransWinStats(t *testing.T) {
+	flags := gFlags
+	flags.WinSize = 10
+	flags.WinStep = 10
+	flags.ReadLen = -1
+
+	stats, e := WinStats(flags, strings.NewReader(gTransIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if x := (*stats.Hits.Hits["X"])[0]; x.TransSelfHits != 0 || x.SelfHits != 2 {
+		t.Errorf("trans counted without -trans: %v", x)
+	}
+
+	flags.Trans = true
+	stats, e = WinStats(flags, strings.NewReader(gTransIn))
+	if e != nil {
+		t.Fatal(e)
+	}
+	x := (*stats.Hits.Hits["X"])[0]
+	if x.TransSelfHits != 1 || x.TransPairHits != 1 || x.SelfHits != 2 {
+		t.Errorf("X hits %v wrong", x)
+	}
+	if x.TransProp() != 0.5 || x.TransPairProp() != 0.5 {
+		t.Errorf("trans props %v, %v wrong", x.TransProp(), x.TransPairProp())
+	}
+	if w := (*stats.GenomeHits.Ghits["W501"].Hits["4"])[0]; w.TransPairHits != 1 {
+		t.Errorf("W501 4 hits %v wrong", w)
+	}
+
+	var buf bytes.Buffer
+	if e = FprintWinStatsJson(&buf, stats, -1); e != nil {
+		t.Fatal(e)
+	}
+	var j map[string]any
+	if e = json.Unmarshal([]byte(strings.Split(buf.String(), "\n")[0]), &j); e != nil {
+		t.Fatal(e)
+	}
+	if _, ok := j["TransSelfHits"]; !ok {
+		t.Errorf("json %v missing trans fields", j)
+	}
+}
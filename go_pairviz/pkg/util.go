@@ -1,21 +1,26 @@
 package pairviz
 
 import (
+	"bufio"
+	"errors"
 	"os"
 	"io"
 	"flag"
 	"fmt"
-	"strings"
 	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
 )
 
+var ErrMissingFlag = errors.New("Missing required flag")
+
 type Flags struct {
 	WinSize int64
 	WinStep int64
 	Distance int64
 	Chromosome bool
 	Name string
-	NameCol bool
+	NameCol bool `json:"-"`
 	Stdin bool
 	NoFpkm bool
 	Region string
@@ -25,6 +30,31 @@ type Flags struct {
 	SelfInMinDistance int64
 	ReadLen int64
 	JsonOut bool
+	ParentRegex string
+	ParentMap string
+	UnmatchedParent string
+	FullChroms bool
+	ChromLens string
+	Threads int
+	Trans bool
+	Orient bool
+	Bands string
+	PairTypes string
+	Samples string
+	AcceptTypes PairTypeSet `json:"-"`
+	BandEdges []int64 `json:"-"`
+	BadLines string
+	RejectPath string
+	Rejecter *Rejecter `json:"-"`
+	Inputs []string
+	OutPath string
+	OutCompression string
+	CI string
+	CILevel float64
+	CIMethods []CIMethod `json:"-"`
+	BootReps int
+	BootSeed int64
+	Analyses []Analysis `json:"-"`
 }
 
 // Data associated with a single read from a read pair
@@ -93,75 +123,222 @@ func Fpkm(count int64, total_sample_reads int64, window_length int64) float64 {
 	return myfpkm
 }
 
-func GetFlags() (f Flags) {
-	err := fmt.Errorf("Argument parsing error")
-	var wintemp, steptemp, disttemp, mindisttemp, pairmindisttemp, selfinmindisttemp, readlentemp int
-	flag.StringVar(&f.Name, "n", "", "Name to add to end of table.")
-	flag.IntVar(&wintemp, "w", -1, "Window size.")
-	flag.IntVar(&steptemp, "s", -1, "Window step distance.")
-	flag.IntVar(&disttemp, "d", -1, "Distance between two paired reads before they are ignored.")
-	flag.IntVar(&mindisttemp, "m", -1, "Minimum distance between two self reads reads.")
-	flag.IntVar(&pairmindisttemp, "pm", -1, "Minimum distance between two paired reads.")
-	flag.IntVar(&selfinmindisttemp, "sim", -1, "Minimum distance between inward-facing self reads.")
-	flag.BoolVar(&f.Stdin, "i", false, "Use Stdin as input (ignored; always do this anyway).")
-	flag.BoolVar(&f.Chromosome, "c", false, "Calculate whole-chromosome statistics, not sliding windows.")
-	flag.BoolVar(&f.NoFpkm, "f", false, "Do not compute fpkm statistics.")
-	flag.StringVar(&f.Region, "r", "", "Calculate statistics in a set of regions specified by this bedfile (not compatible with whole-chromosome statistics or window statistics).")
-	flag.BoolVar(&f.SeparateGenomes, "G", false, "Print two entries for each chromosome location, one for each genome, correctly distinguishing self and paired reads (default = false).")
-	flag.IntVar(&readlentemp, "rlen", -1, "Length of reads in pairs (used to calculate overlapping or not; skipped otherwise).")
-	flag.BoolVar(&f.JsonOut, "j", false, "Output as JSON")
-
-	_ = flag.Int("g", 0, "unused")
-	flag.Parse()
-
-	f.WinSize = int64(wintemp)
-	f.WinStep = int64(steptemp)
-	f.Distance = int64(disttemp)
-	f.MinDistance = int64(mindisttemp)
-	f.PairMinDistance = int64(pairmindisttemp)
-	f.SelfInMinDistance = int64(selfinmindisttemp)
-	f.ReadLen = int64(readlentemp)
-	f.NameCol = f.Name != ""
+// Define the go_pairviz flags on a new FlagSet, storing their values in f and
+// the -config path in config
+func newFlagSet(f *Flags, config *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("go_pairviz", flag.ContinueOnError)
+	fs.StringVar(config, "config", "", "JSON or TOML (.toml) config file setting any of the Flags fields by name, and optionally several named analyses to run in one pass over the input; other flags override it.")
+	fs.StringVar(&f.Name, "n", "", "Name to add to end of table.")
+	fs.Int64Var(&f.WinSize, "w", -1, "Window size.")
+	fs.Int64Var(&f.WinStep, "s", -1, "Window step distance.")
+	fs.Int64Var(&f.Distance, "d", -1, "Distance between two paired reads before they are ignored.")
+	fs.Int64Var(&f.MinDistance, "m", -1, "Minimum distance between two self reads reads.")
+	fs.Int64Var(&f.PairMinDistance, "pm", -1, "Minimum distance between two paired reads.")
+	fs.Int64Var(&f.SelfInMinDistance, "sim", -1, "Minimum distance between inward-facing self reads.")
+	fs.BoolVar(&f.Stdin, "i", false, "Use Stdin as input (ignored; stdin is read if no input paths are given).")
+	fs.BoolVar(&f.Chromosome, "c", false, "Calculate whole-chromosome statistics, not sliding windows.")
+	fs.BoolVar(&f.NoFpkm, "f", false, "Do not compute fpkm statistics.")
+	fs.StringVar(&f.Region, "r", "", "Calculate statistics in a set of regions specified by this bedfile (not compatible with whole-chromosome statistics or window statistics). The bed name and score columns, if present, are added to the output.")
+	fs.BoolVar(&f.SeparateGenomes, "G", false, "Print two entries for each chromosome location, one for each genome, correctly distinguishing self and paired reads (default = false).")
+	fs.Int64Var(&f.ReadLen, "rlen", -1, "Length of reads in pairs (used to calculate overlapping or not; skipped otherwise).")
+	fs.BoolVar(&f.JsonOut, "j", false, "Output as JSON")
+	fs.StringVar(&f.ParentRegex, "parentre", "", "Regular expression with (?P<chrom>...) and (?P<parent>...) groups for splitting contig names into chromosome and parent (default split on first '_').")
+	fs.StringVar(&f.ParentMap, "parentmap", "", "Tab-separated file of contig, chromosome, and parent names; takes precedence over -parentre.")
+	fs.StringVar(&f.UnmatchedParent, "spikein", "ecoli", "Parent name for contigs that match no naming rule.")
+	fs.BoolVar(&f.Trans, "trans", false, "Count pairs with reads on different chromosomes as trans-self and trans-paired hits in window and chromosome statistics.")
+	fs.BoolVar(&f.Orient, "orient", false, "Split self and paired hits by read orientation (in, out, or match) in window, region, and chromosome statistics.")
+	fs.StringVar(&f.Bands, "bands", "", "Comma-separated, increasing distance band edges (the last may be \"inf\"); print self and paired hits per band for every window in long format.")
+	fs.StringVar(&f.PairTypes, "pairtypes", DefaultPairTypes, "Comma-separated pairtools pair_type codes to count, or \"all\"; other pairs are skipped and do not count as good reads.")
+	fs.StringVar(&f.Samples, "samples", "", "Tab-separated file of sample names and .pairs paths; calculate windows for every sample and print them as one matrix (or long JSON with -j) instead of reading stdin.")
+	fs.BoolVar(&f.FullChroms, "full", false, "Print every window to the end of each chromosome, using the #chromsize: header lines for chromosome lengths.")
+	fs.IntVar(&f.Threads, "t", 1, "Number of threads to use for window statistics and bgzip decompression; plain gzip is decompressed on one thread.")
+	fs.StringVar(&f.OutPath, "o", "", "Path to write output to (default stdout).")
+	fs.StringVar(&f.OutCompression, "oz", "auto", "Compression of the -o output: none, gzip, bgzip, zstd, or auto (by the extension .gz, .bgz, or .zst).")
+	fs.StringVar(&f.ChromLens, "chrlens", "", "Chromosome lengths (bed or chrom-length format) for printing every window to the end of each chromosome; implies -full.")
+	fs.StringVar(&f.BadLines, "bad", "fail", "What to do with malformed .pairs lines: fail, skip (and count), or log (skip, count, and write to -rejects).")
+	fs.StringVar(&f.RejectPath, "rejects", "", "File to write malformed .pairs lines to when -bad is log.")
+	fs.StringVar(&f.CI, "ci", "", "Comma-separated confidence intervals to add for the paired and overlapping proportions: wilson, jeffreys, or exact (Clopper-Pearson).")
+	fs.Float64Var(&f.CILevel, "cilevel", 0.95, "Confidence level of -ci intervals and -boot percentile intervals.")
+	fs.IntVar(&f.BootReps, "boot", 0, "Number of Poisson bootstrap replicates of the read pairs; adds standard errors and percentile intervals for the paired and self hits and the paired and overlap proportions of each window or region. FPKMs and proportions of the input totals are not bootstrapped.")
+	fs.Int64Var(&f.BootSeed, "bootseed", 1, "Random seed of the -boot replicates.")
+
+	_ = fs.Int("g", 0, "unused")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of go_pairviz: go_pairviz [flags] [input.pairs ...]\n")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func ParseFlags(args []string) (f Flags, err error) {
+	var config string
+	fs := newFlagSet(&f, &config)
+	if err = fs.Parse(args); err != nil {
+		return f, fmt.Errorf("ParseFlags: %w", err)
+	}
+	f.Inputs = fs.Args()
+	if config != "" {
+		f, err = ParseConfigFlags(config, args)
+	} else {
+		err = f.Validate()
+	}
 	fmt.Fprintf(os.Stderr, "flag Name: %v; NameCol: %v\n", f.Name, f.NameCol)
+	return f, err
+}
+
+// Check the flags, reporting every problem at once, and set the fields parsed
+// from other fields: NameCol, BandEdges, AcceptTypes, and CIMethods
+func (f *Flags) Validate() error {
+	if errs := f.validate(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (f *Flags) validate() FlagErrors {
+	var errs FlagErrors
+	bad := func(err error) {
+		errs = append(errs, err)
+	}
+	var err error
 
+	f.NameCol = f.Name != ""
 	if (f.WinSize == -1 || f.WinStep == -1) && !f.Chromosome && f.Region == "" {
+		var missing []string
 		if f.WinSize == -1 {
-			fmt.Fprintln(os.Stderr, "Missing -w, winsize")
+			missing = append(missing, "-w, winsize")
 		}
-
 		if f.WinStep == -1 {
-			fmt.Fprintln(os.Stderr, "Missing -s, winstep")
+			missing = append(missing, "-s, winstep")
 		}
+		bad(fmt.Errorf("missing %v, or -c, chromosome analysis, or -r, region: %w", strings.Join(missing, " and "), ErrMissingFlag))
+	}
+	if f.WinSize == 0 || f.WinSize < -1 {
+		bad(fmt.Errorf("-w %v: window size must be positive", f.WinSize))
+	}
+	if f.WinStep == 0 || f.WinStep < -1 {
+		bad(fmt.Errorf("-s %v: window step must be positive", f.WinStep))
+	}
+	if f.Threads < 1 {
+		bad(fmt.Errorf("-t %v: need at least one thread", f.Threads))
+	}
+	if f.Samples != "" && (f.Chromosome || f.Region != "" || f.Bands != "") {
+		bad(fmt.Errorf("-samples cannot be combined with -c, -r, or -bands"))
+	}
+	if f.Samples != "" && len(f.Inputs) > 0 {
+		bad(fmt.Errorf("-samples cannot be combined with input paths"))
+	}
+	if f.BandEdges, err = ParseBandEdges(f.Bands); err != nil {
+		bad(fmt.Errorf("-bands: %w", err))
+	}
+	if f.AcceptTypes, err = ParsePairTypes(f.PairTypes); err != nil {
+		bad(fmt.Errorf("-pairtypes: %w", err))
+	}
+	if f.CIMethods, err = ParseCIMethods(f.CI); err != nil {
+		bad(fmt.Errorf("-ci: %w", err))
+	}
+	if f.CILevel <= 0 || f.CILevel >= 1 {
+		bad(fmt.Errorf("-cilevel %v: %w", f.CILevel, ErrBadCILevel))
+	}
+	if f.BootReps < 0 {
+		bad(fmt.Errorf("-boot %v: negative number of replicates", f.BootReps))
+	}
+	if f.BootReps > 0 && (f.Samples != "" || f.Chromosome || f.Bands != "") {
+		bad(fmt.Errorf("-boot cannot be combined with -samples, -c, or -bands"))
+	}
+	if policy, err := ParseBadLinePolicy(f.BadLines); err != nil {
+		bad(fmt.Errorf("-bad: %w", err))
+	} else if policy == LogBad && f.RejectPath == "" {
+		bad(fmt.Errorf("-bad log without -rejects: %w", ErrMissingFlag))
+	}
+	if _, err = ParseOutputCompression(f.OutCompression, f.OutPath); err != nil {
+		bad(fmt.Errorf("-oz: %w", err))
+	}
+	if _, err = f.Resolver(); err != nil {
+		bad(fmt.Errorf("-parentre or -parentmap: %w", err))
+	}
 
-		if !f.Chromosome {
-			fmt.Fprintln(os.Stderr, "Missing -c, chromosome analysis")
+	paths := [][2]string{{"-r", f.Region}, {"-samples", f.Samples}, {"-chrlens", f.ChromLens}}
+	for _, in := range f.Inputs {
+		paths = append(paths, [2]string{"input", in})
+	}
+	for _, p := range paths {
+		if p[1] == "" || p[1] == "-" {
+			continue
 		}
-
-		if f.Region == "" {
-			fmt.Fprintln(os.Stderr, "Missing -r, region")
+		if _, err = os.Stat(p[1]); err != nil {
+			bad(fmt.Errorf("%v: %w", p[0], err))
 		}
+	}
+	return errs
+}
 
-		panic(err)
+// Parse the command line flags, exiting with a usage error if they are invalid
+func GetFlags() Flags {
+	f, err := ParseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	return
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return f
+}
+
+// Set up f.Rejecter according to the -bad and -rejects flags. The returned
+// function closes the reject file, if any.
+func (f *Flags) OpenRejecter() (closefunc func() error, err error) {
+	closefunc = func() error { return nil }
+	policy, err := ParseBadLinePolicy(f.BadLines)
+	if err != nil {
+		return closefunc, fmt.Errorf("OpenRejecter: %w", err)
+	}
+	if policy != LogBad {
+		f.Rejecter = NewRejecter(policy, nil)
+		return closefunc, nil
+	}
+	if f.RejectPath == "" {
+		return closefunc, fmt.Errorf("OpenRejecter: -bad log without -rejects: %w", ErrMissingFlag)
+	}
+	w, err := os.Create(f.RejectPath)
+	if err != nil {
+		return closefunc, fmt.Errorf("OpenRejecter: %w", err)
+	}
+	bw := bufio.NewWriter(w)
+	f.Rejecter = NewRejecter(policy, bw)
+	return func() error {
+		if e := bw.Flush(); e != nil {
+			w.Close()
+			return e
+		}
+		return w.Close()
+	}, nil
+}
+
+// Build the chromosome and parent naming scheme specified by the flags
+func (f Flags) Resolver() (parents.Resolver, error) {
+	return parents.New(f.ParentRegex, f.ParentMap, f.UnmatchedParent)
+}
+
+// Parse a .pairs file read using the default chrom_parent naming scheme
+func ParseRead(fields []string) (read Read, err error) {
+	return ParseReadResolve(fields, parents.Default())
 }
 
-// Parse a .pairs file read
-func ParseRead(fields []string) (read Read) {
+// Parse a .pairs file read, splitting the contig name with res
+func ParseReadResolve(fields []string, res parents.Resolver) (read Read, err error) {
+	if len(fields) < 3 {
+		return read, fmt.Errorf("ParseReadResolve: %w", ErrShortLine)
+	}
 	read.Ok = fields[0] != "!"
 	if !read.Ok {
 		return
 	}
-	chrparent := strings.Split(fields[0], "_")
-	read.Chrom = chrparent[0]
-	read.Parent = "ecoli"
-	if len(chrparent) >= 2 {
-		read.Parent = chrparent[1]
-	}
-	var err error
+	read.Chrom, read.Parent = res.Resolve(fields[0])
 	read.Pos, err = strconv.ParseInt(fields[1], 10, 64)
 	if err != nil {
-		panic(err)
+		return read, fmt.Errorf("ParseReadResolve: position %q: %w", fields[1], err)
 	}
 
 	switch fields[2] {
@@ -173,15 +350,12 @@ func ParseRead(fields []string) (read Read) {
 	return
 }
 
-// Parse an entire .pairs file pair
-func ParsePair(line []string) (pair Pair, ok bool) {
+// Parse an entire .pairs file pair, assuming the default column order
+func ParsePair(line []string) (pair Pair, err error) {
 	if !IsAPair(line) {
-		ok = false
-		return
+		return pair, fmt.Errorf("ParsePair: %w", ErrShortLine)
 	}
-	pair.Read1 = ParseRead(append([]string{}, line[1], line[2], line[5]))
-	pair.Read2 = ParseRead(append([]string{}, line[3], line[4], line[6]))
-	return pair, true
+	return ParsePairCols(line, DefaultPairsColumns(), parents.Default())
 }
 
 func Abs(x int64) int64 {
@@ -233,6 +407,13 @@ func RangeBad(maxdist int64, mindist int64, pairmindist int64, selfinmindist int
 
 // Print the header for a standard pairviz output tab-separated table
 func FprintHeader(w io.Writer, fpkm bool, readlen int64, namecol bool) {
+	FprintHeaderCols(w, StatCols{Fpkm: fpkm, ReadLen: readlen}, namecol, nil)
+}
+
+// Write the header for the optional column groups in cols, with extra
+// columns before the name column
+func FprintHeaderCols(w io.Writer, cols StatCols, namecol bool, extra []string) {
+	fpkm, readlen := cols.Fpkm, cols.ReadLen
 	fmt.Fprintf(os.Stderr, "Header namecol: %v\n", namecol)
 	fmt.Fprint(w, "chrom\tstart\tend\thit_type\talt_hit_type\thits\talt_hits\tpair_prop\talt_prop\tpair_totprop\tpair_totgoodprop\tpair_totcloseprop\twinsize\twinstep")
 	if fpkm {
@@ -244,6 +425,20 @@ func FprintHeader(w io.Writer, fpkm bool, readlen int64, namecol bool) {
 			fmt.Fprint(w, "\tovl_fpkm\tnon_ovl_fpkm\tovl_prop_fpkm\tnon_ovl_prop_fpkm")
 		}
 	}
+	if cols.Trans {
+		fmt.Fprint(w, "\ttrans_self\ttrans_pair\ttrans_pair_prop\ttrans_prop")
+		if fpkm {
+			fmt.Fprint(w, "\ttrans_self_fpkm\ttrans_pair_fpkm")
+		}
+	}
+	if cols.Orient {
+		fmt.Fprint(w, "\tself_in\tself_out\tself_match\tpair_in\tpair_out\tpair_match\tpair_prop_outmatch")
+	}
+	fmt.Fprint(w, cols.CI.HeaderCols(readlen))
+	fmt.Fprint(w, cols.Boot.HeaderCols(readlen))
+	for _, col := range extra {
+		fmt.Fprint(w, "\t" + col)
+	}
 	if namecol {
 		fmt.Fprint(w, "\tname")
 	}
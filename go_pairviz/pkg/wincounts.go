@@ -0,0 +1,211 @@
+package pairviz
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/jgbaldwinbrown/fasttsv"
+)
+
+var ErrBadWinFormat = errors.New("Unknown window input format")
+
+// The paired and self hits of one window, read from pairviz window output
+type WinCounts struct {
+	Chrom string
+	Start int64
+	End int64
+	Pair float64
+	Self float64
+}
+
+// The paired proportion of a window, NaN without hits
+func (w WinCounts) Prop() float64 {
+	return w.Pair / (w.Pair + w.Self)
+}
+
+// Windows of one chromosome, sorted by position
+type WinSeries struct {
+	Chrom string
+	Wins []WinCounts
+}
+
+// Options for reading window counts. Format is "json", "tsv", or empty to
+// detect the format from the first character of the input. Records whose
+// Name is not Name are skipped if Name is set. JSON chromosomes are named
+// <chrom>_<genome>, as in the tab-separated output with -G, unless Genome is
+// set, in which case only that genome is read, with the original chromosome
+// names.
+type WinCountsFlags struct {
+	Format string
+	Name string
+	Genome string
+}
+
+// Read the windows of pairviz JSON or tab-separated output, grouped by
+// chromosome in name order and sorted by position. Windows with NaN hits are
+// left out.
+func ReadWinCounts(r io.Reader, flags WinCountsFlags) ([]WinSeries, error) {
+	br := bufio.NewReader(r)
+	format := flags.Format
+	if format == "" {
+		format = "tsv"
+		for {
+			b, err := br.Peek(1)
+			if err != nil {
+				break
+			}
+			if b[0] == ' ' || b[0] == '\t' || b[0] == '\n' || b[0] == '\r' {
+				br.ReadByte()
+				continue
+			}
+			if b[0] == '{' {
+				format = "json"
+			}
+			break
+		}
+	}
+
+	var wins []WinCounts
+	var err error
+	switch format {
+	case "json": wins, err = readWinCountsJson(br, flags)
+	case "tsv": wins, err = readWinCountsTsv(br, flags)
+	default:
+		return nil, fmt.Errorf("ReadWinCounts: %q: %w", format, ErrBadWinFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ReadWinCounts: %w", err)
+	}
+
+	bychrom := map[string][]WinCounts{}
+	for _, w := range wins {
+		bychrom[w.Chrom] = append(bychrom[w.Chrom], w)
+	}
+	series := make([]WinSeries, 0, len(bychrom))
+	for _, chrom := range sortedKeys(bychrom) {
+		s := bychrom[chrom]
+		sort.SliceStable(s, func(i, j int) bool {
+			if s[i].Start != s[j].Start {
+				return s[i].Start < s[j].Start
+			}
+			return s[i].End < s[j].End
+		})
+		series = append(series, WinSeries{chrom, s})
+	}
+	return series, nil
+}
+
+func readWinCountsJson(r io.Reader, flags WinCountsFlags) ([]WinCounts, error) {
+	var wins []WinCounts
+	for j, err := range ParsePairvizOut(r) {
+		if err != nil {
+			return nil, err
+		}
+		if flags.Name != "" && j.Name != flags.Name {
+			continue
+		}
+		if flags.Genome != "" && j.Genome != flags.Genome {
+			continue
+		}
+		if IsInfOrNaN(j.TargetHits) || IsInfOrNaN(j.AltHits) {
+			continue
+		}
+		chrom := j.Chr + "_" + j.Genome
+		if flags.Genome != "" {
+			chrom = j.Chr
+		}
+		wins = append(wins, WinCounts{chrom, j.Start, j.End, float64(j.TargetHits), float64(j.AltHits)})
+	}
+	return wins, nil
+}
+
+// The tab-separated columns needed for window counts
+var winCountsCols = []string{"chrom", "start", "end", "hits", "alt_hits"}
+
+func readWinCountsTsv(r io.Reader, flags WinCountsFlags) ([]WinCounts, error) {
+	var wins []WinCounts
+	var cols []int
+	namecol := -1
+	s := fasttsv.NewScanner(r)
+	lineno := int64(0)
+	for s.Scan() {
+		lineno++
+		line := s.Line()
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == "chrom" {
+			cols = cols[:0]
+			for _, name := range winCountsCols {
+				i := indexOf(line, name)
+				if i < 0 {
+					return nil, fmt.Errorf("readWinCountsTsv: %q: %w", name, ErrMissingColumn)
+				}
+				cols = append(cols, i)
+			}
+			namecol = indexOf(line, "name")
+			continue
+		}
+		if cols == nil {
+			return nil, fmt.Errorf("readWinCountsTsv: line %v: %w", lineno, ErrMissingColumn)
+		}
+		if flags.Name != "" && (namecol < 0 || namecol >= len(line) || line[namecol] != flags.Name) {
+			continue
+		}
+		w, err := parseWinCountsLine(line, cols)
+		if err != nil {
+			return nil, fmt.Errorf("readWinCountsTsv: %w", &ParseError{Line: lineno, Text: strings.Join(line, "\t"), Err: err})
+		}
+		if math.IsNaN(w.Pair) || math.IsNaN(w.Self) {
+			continue
+		}
+		wins = append(wins, w)
+	}
+	if e := s.InScanner.Err(); e != nil {
+		return nil, fmt.Errorf("readWinCountsTsv: %w", e)
+	}
+	return wins, nil
+}
+
+func indexOf(line []string, name string) int {
+	for i, field := range line {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseWinCountsLine(line []string, cols []int) (w WinCounts, err error) {
+	for _, c := range cols {
+		if c >= len(line) {
+			return w, ErrShortLine
+		}
+	}
+	w.Chrom = line[cols[0]]
+	if w.Start, err = strconv.ParseInt(line[cols[1]], 0, 64); err != nil {
+		return w, err
+	}
+	if w.End, err = strconv.ParseInt(line[cols[2]], 0, 64); err != nil {
+		return w, err
+	}
+	if w.Pair, err = strconv.ParseFloat(line[cols[3]], 64); err != nil {
+		return w, err
+	}
+	w.Self, err = strconv.ParseFloat(line[cols[4]], 64)
+	return w, err
+}
+
+// The boundary between neighbouring windows: the start of next, or the middle
+// of their overlap if they overlap
+func winBoundary(prev, next WinCounts) int64 {
+	if prev.End > next.Start {
+		return (prev.End + next.Start) / 2
+	}
+	return next.Start
+}
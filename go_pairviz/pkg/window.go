@@ -7,20 +7,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"github.com/jgbaldwinbrown/fasttsv"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
 )
 
+// Counts of all reads in the input, used as denominators for proportions
+type ReadTotals struct {
+	TotalBadReads int64
+	TotalGoodReads int64
+	TotalReads int64
+}
+
 // All statistics associated with one window
 type AllWinStats struct {
 	Hits Hits
 	GenomeHits GenomeHits
 	TotalSelfHits int64
 	TotalPairHits int64
-	TotalBadReads int64
-	TotalGoodReads int64
-	TotalReads int64
+	ReadTotals
 	Fpkm bool
+	Trans bool
+	Orient bool
+	CI PropCI
+	Boot *WinBoot
 	Name string
+	Bands []DistBand
 }
 
 // The counts of hits in a single window
@@ -29,10 +39,20 @@ type HitSet struct {
 	PairHits int64
 	OvlHits int64
 	NonOvlHits int64
+	TransSelfHits int64
+	TransPairHits int64
+	SelfInHits int64
+	SelfOutHits int64
+	SelfMatchHits int64
+	PairInHits int64
+	PairOutHits int64
+	PairMatchHits int64
 	SelfFpkm float64
 	PairFpkm float64
 	OvlFpkm float64
 	NonOvlFpkm float64
+	TransSelfFpkm float64
+	TransPairFpkm float64
 }
 
 // Types are self, pair, overlapped, and non-overlapped
@@ -43,27 +63,66 @@ const (
 	P
 	Ovl
 	NonOvl
+	TS
+	TP
+	SIn
+	SOut
+	SMatch
+	PIn
+	POut
+	PMatch
 )
 
 // The raw slice of all hits in all windows along a chromosome
 type WinHitList []HitSet
 
-// Increment the correct hit type for the specified index of the WinHitList
-func (h WinHitList) IncWin(index int64, hit_type HitType) WinHitList {
-	if index < 0 { return h }
-	for len(h) <= int(index) {
-		h = append(h, HitSet{})
-	}
+// Increment the count for the specified hit type
+func (h *HitSet) Inc(hit_type HitType) {
 	switch hit_type {
 	case S:
-		h[index].SelfHits++
+		h.SelfHits++
 	case P:
-		h[index].PairHits++
+		h.PairHits++
 	case Ovl:
-		h[index].OvlHits++
+		h.OvlHits++
 	case NonOvl:
-		h[index].NonOvlHits++
+		h.NonOvlHits++
+	case TS:
+		h.TransSelfHits++
+	case TP:
+		h.TransPairHits++
+	case SIn:
+		h.SelfInHits++
+	case SOut:
+		h.SelfOutHits++
+	case SMatch:
+		h.SelfMatchHits++
+	case PIn:
+		h.PairInHits++
+	case POut:
+		h.PairOutHits++
+	case PMatch:
+		h.PairMatchHits++
+	}
+}
+
+// Calculate fpkm for all hit types given the total reads and the window length
+func (h *HitSet) SetFpkm(total_reads int64, length int64) {
+	h.SelfFpkm = Fpkm(h.SelfHits, total_reads, length)
+	h.PairFpkm = Fpkm(h.PairHits, total_reads, length)
+	h.OvlFpkm = Fpkm(h.OvlHits, total_reads, length)
+	h.NonOvlFpkm = Fpkm(h.NonOvlHits, total_reads, length)
+	h.TransSelfFpkm = Fpkm(h.TransSelfHits, total_reads, length)
+	h.TransPairFpkm = Fpkm(h.TransPairHits, total_reads, length)
+}
+
+// Increment the correct hit type for the specified index of the WinHitList
+func (h WinHitList) IncWin(index int64, hit_type HitType) WinHitList {
+	if index < 0 { return h }
+	for len(h) <= int(index) {
+		h = append(h, HitSet{})
 	}
+	h[index].Inc(hit_type)
 	return h
 }
 
@@ -72,6 +131,7 @@ func (h WinHitList) IncWin(index int64, hit_type HitType) WinHitList {
 // hits.
 type Hits struct {
 	Hits map[string]*WinHitList
+	ChromLens map[string]int64
 	WinSize int64
 	WinStep int64
 }
@@ -92,6 +152,7 @@ type Range struct {
 
 func (h *Hits) Init(winsize int64, winstep int64) {
 	h.Hits = make(map[string]*WinHitList)
+	h.ChromLens = make(map[string]int64)
 	h.WinSize = winsize
 	h.WinStep = winstep
 }
@@ -105,6 +166,16 @@ func (h *Hits) WinsHit(pos int64) (out Range) {
 	return
 }
 
+// The start and end of a window, with the end clipped to the chromosome length if it is known
+func (h *Hits) WinSpan(chrom string, index int64) (start, end int64) {
+	start = index * h.WinStep
+	end = start + h.WinSize
+	if chromlen, ok := h.ChromLens[chrom]; ok && end > chromlen {
+		end = chromlen
+	}
+	return start, end
+}
+
 func (h *Hits) AddHit(chrom string, pos int64, hit_type HitType) {
 	// if hit_type == Ovl || hit_type == NonOvl {
 	// 	log.Printf("Hits AddHit: chrom %v; pos %v; hit_type %v\n", chrom, pos, hit_type)
@@ -123,12 +194,7 @@ func (g *GenomeHits) AddHit(genome string, chrom string, pos int64, hit_type Hit
 	// if hit_type == Ovl || hit_type == NonOvl {
 	// 	log.Printf("GenomeHits AddHit: genome %v; chrom %v; pos %v; hit_type %v\n", genome, chrom, pos, hit_type)
 	// }
-	if _, ok := g.Ghits[genome]; !ok {
-		h := new(Hits)
-		h.Init(g.WinSize, g.WinStep)
-		g.Ghits[genome] = h
-	}
-	g.Ghits[genome].AddHit(chrom, pos, hit_type)
+	g.Genome(genome).AddHit(chrom, pos, hit_type)
 }
 
 func (g *GenomeHits) Init(winsize, winstep int64) {
@@ -137,88 +203,184 @@ func (g *GenomeHits) Init(winsize, winstep int64) {
 	g.WinStep = winstep
 }
 
-func WinStats(flags Flags, r io.Reader) (stats AllWinStats) {
+// Make an empty set of window statistics
+func NewAllWinStats(flags Flags) (stats AllWinStats) {
 	stats.Name = flags.Name
+	stats.Trans = flags.Trans
+	stats.Orient = flags.Orient
+	stats.CI = NewPropCI(flags)
+	if flags.BootReps > 0 {
+		stats.Boot = NewWinBoot(NewBootFlags(flags))
+	}
 	stats.Hits.Init(flags.WinSize, flags.WinStep)
 	stats.GenomeHits.Init(flags.WinSize, flags.WinStep)
-	s := fasttsv.NewScanner(r)
-	for s.Scan() {
-		if IsAPair(s.Line()) {
-			stats.TotalReads++
-			// log.Printf("Current total reads: %v", stats.TotalReads)
-		}
-		if CheckGood(s.Line()) {
-			stats.TotalGoodReads++
-			// log.Printf("Current total good reads: %v", stats.TotalGoodReads)
-		}
+	stats.Bands = NewDistBands(flags)
+	return stats
+}
 
-		pair, ok := ParsePair(s.Line())
-		if !ok {
-			continue
+func WinStats(flags Flags, r io.Reader) (stats AllWinStats, err error) {
+	if flags.Threads > 1 {
+		return WinStatsParallel(flags, r)
+	}
+	stats = NewAllWinStats(flags)
+	pr, err := NewPairScanner(flags, r)
+	if err != nil {
+		return stats, fmt.Errorf("WinStats: %w", err)
+	}
+	for pr.Scan() {
+		stats.TotalReads++
+		if pr.Good() {
+			stats.TotalGoodReads++
 		}
-		if RangeBad(flags.Distance, flags.MinDistance, flags.PairMinDistance, flags.SelfInMinDistance, pair) {
-			continue
+		if !pr.Accepted() { continue }
+		if pair, ok := pr.Pair(); ok {
+			stats.CountPair(flags, pair)
 		}
+	}
+	if err = pr.Err(); err != nil {
+		return stats, fmt.Errorf("WinStats: %w", err)
+	}
+	if err = stats.Finish(flags, pr); err != nil {
+		return stats, fmt.Errorf("WinStats: %w", err)
+	}
+	return stats, nil
+}
+
+// Count one .pairs data line toward the read totals and the window hits,
+// returning the parse error if the line is malformed
+func (stats *AllWinStats) AddLine(flags Flags, line []string, cols PairsColumns, res parents.Resolver) error {
+	stats.TotalReads++
+	if CheckGoodTypes(line, cols, flags.AcceptTypes) {
+		stats.TotalGoodReads++
+	}
+	if !flags.AcceptTypes.AcceptsLine(line, cols) {
+		return nil
+	}
+
+	pair, err := ParsePairCols(line, cols, res)
+	if err != nil {
+		return err
+	}
+	stats.CountPair(flags, pair)
+	return nil
+}
+
+// Add the hits for a parsed pair whose pair type is accepted, skipping pairs
+// outside the distance limits
+func (stats *AllWinStats) CountPair(flags Flags, pair Pair) {
+	if flags.Trans && IsTrans(pair) {
+		stats.AddTransPair(pair)
+		return
+	}
+	if RangeBad(flags.Distance, flags.MinDistance, flags.PairMinDistance, flags.SelfInMinDistance, pair) {
+		return
+	}
+	stats.AddPair(flags, pair)
+}
+
+// Add the hits for both reads of a pair to all windows they fall in
+func (stats *AllWinStats) AddPair(flags Flags, pair Pair) {
+	AddPairHits(&stats.Hits, &stats.GenomeHits, flags, pair)
+	if stats.Boot != nil {
+		stats.Boot.AddPair(flags, pair, stats.TotalReads - 1, &stats.Hits)
+	}
+	if band := stats.Band(pair.AbsPosDist()); band != nil {
+		AddPairHits(&band.Hits, &band.GenomeHits, flags, pair)
+	}
+}
+
+// Add one hit of the specified type for each read of a pair
+func (h *Hits) AddPairHit(pair Pair, hit_type HitType) {
+	h.AddHit(pair.Read1.Chrom, pair.Read1.Pos, hit_type)
+	h.AddHit(pair.Read2.Chrom, pair.Read2.Pos, hit_type)
+}
+
+// Add one hit of the specified type for each read of a pair to its genome
+func (g *GenomeHits) AddPairHit(pair Pair, hit_type HitType) {
+	g.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, hit_type)
+	g.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, hit_type)
+}
+
+// Add the self or paired hits for a pair, plus the overlap and orientation
+// hits if the flags request them, to a set of windows and genome windows
+func AddPairHits(hits *Hits, ghits *GenomeHits, flags Flags, pair Pair) {
+	add := func(hit_type HitType) {
+		hits.AddPairHit(pair, hit_type)
+		ghits.AddPairHit(pair, hit_type)
+	}
+
+	if pair.Read1.Parent == pair.Read2.Parent {
+		add(S)
+	} else {
+		add(P)
+	}
 
-		// fmt.Println(pair)
-		if pair.Read1.Parent == pair.Read2.Parent {
-			stats.Hits.AddHit(pair.Read1.Chrom, pair.Read1.Pos, S)
-			stats.Hits.AddHit(pair.Read2.Chrom, pair.Read2.Pos, S)
-			stats.GenomeHits.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, S)
-			stats.GenomeHits.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, S)
+	if flags.ReadLen != -1 {
+		if PairOverlaps(pair, flags.ReadLen) {
+			add(Ovl)
 		} else {
-			stats.Hits.AddHit(pair.Read1.Chrom, pair.Read1.Pos, P)
-			stats.Hits.AddHit(pair.Read2.Chrom, pair.Read2.Pos, P)
-			stats.GenomeHits.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, P)
-			stats.GenomeHits.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, P)
+			add(NonOvl)
 		}
+	}
 
-		if flags.ReadLen != -1 {
-			// log.Println("checking overlaps")
-			if PairOverlaps(pair, flags.ReadLen) {
-				// log.Println("overlapped")
-				stats.Hits.AddHit(pair.Read1.Chrom, pair.Read1.Pos, Ovl)
-				stats.Hits.AddHit(pair.Read2.Chrom, pair.Read2.Pos, Ovl)
-				stats.GenomeHits.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, Ovl)
-				stats.GenomeHits.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, Ovl)
-			} else {
-				// log.Println("nonoverlapped")
-				stats.Hits.AddHit(pair.Read1.Chrom, pair.Read1.Pos, NonOvl)
-				stats.Hits.AddHit(pair.Read2.Chrom, pair.Read2.Pos, NonOvl)
-				stats.GenomeHits.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, NonOvl)
-				stats.GenomeHits.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, NonOvl)
-			}
+	if flags.Orient {
+		if facing_type, ok := FacingHitType(pair); ok {
+			add(facing_type)
 		}
-		// fmt.Println(stats)
-		// for key, val := range stats.Hits.Hits {
-		// 	fmt.Println(key, *val)
-		// }
 	}
+}
+
+// Add trans hits for both reads of a pair on different chromosomes
+func (stats *AllWinStats) AddTransPair(pair Pair) {
+	hit_type := TransHitType(pair)
+	stats.Hits.AddHit(pair.Read1.Chrom, pair.Read1.Pos, hit_type)
+	stats.Hits.AddHit(pair.Read2.Chrom, pair.Read2.Pos, hit_type)
+	stats.GenomeHits.AddHit(pair.Read1.Parent, pair.Read1.Chrom, pair.Read1.Pos, hit_type)
+	stats.GenomeHits.AddHit(pair.Read2.Parent, pair.Read2.Chrom, pair.Read2.Pos, hit_type)
+}
+
+// Calculate the totals, chromosome lengths, and fpkm values that depend on
+// all lines having been counted
+func (stats *AllWinStats) Finish(flags Flags, pr PairScanner) error {
 	stats.TotalBadReads = stats.TotalReads - stats.TotalGoodReads
 
+	if flags.FullChroms || flags.ChromLens != "" {
+		if err := stats.FillChroms(flags, pr); err != nil {
+			return err
+		}
+	}
+
+	for i, _ := range stats.Bands {
+		stats.Bands[i].ShareChromLens(stats)
+	}
+
 	if !flags.NoFpkm {
 		stats.Fpkm = true
-		for chrom, chromentries := range stats.Hits.Hits {
-			for index, win := range *chromentries {
-				(*stats.Hits.Hits[chrom])[index].SelfFpkm = Fpkm(win.SelfHits, stats.TotalReads, stats.Hits.WinSize)
-				(*stats.Hits.Hits[chrom])[index].PairFpkm = Fpkm(win.PairHits, stats.TotalReads, stats.Hits.WinSize)
-				(*stats.Hits.Hits[chrom])[index].OvlFpkm = Fpkm(win.OvlHits, stats.TotalReads, stats.Hits.WinSize)
-				(*stats.Hits.Hits[chrom])[index].NonOvlFpkm = Fpkm(win.NonOvlHits, stats.TotalReads, stats.Hits.WinSize)
-			}
+		stats.Hits.SetFpkm(stats.TotalReads)
+		stats.GenomeHits.SetFpkm(stats.TotalReads)
+		for i, _ := range stats.Bands {
+			stats.Bands[i].Hits.SetFpkm(stats.TotalReads)
+			stats.Bands[i].GenomeHits.SetFpkm(stats.TotalReads)
 		}
+	}
+	return nil
+}
 
-		for genome, genomeentries := range stats.GenomeHits.Ghits {
-			for chrom, chromentries := range genomeentries.Hits {
-				for index, win := range *chromentries {
-					(*stats.GenomeHits.Ghits[genome].Hits[chrom])[index].SelfFpkm = Fpkm(win.SelfHits, stats.TotalReads, stats.Hits.WinSize)
-					(*stats.GenomeHits.Ghits[genome].Hits[chrom])[index].PairFpkm = Fpkm(win.PairHits, stats.TotalReads, stats.Hits.WinSize)
-					(*stats.GenomeHits.Ghits[genome].Hits[chrom])[index].OvlFpkm = Fpkm(win.OvlHits, stats.TotalReads, stats.Hits.WinSize)
-					(*stats.GenomeHits.Ghits[genome].Hits[chrom])[index].NonOvlFpkm = Fpkm(win.NonOvlHits, stats.TotalReads, stats.Hits.WinSize)
-				}
-			}
+// Calculate fpkm for every window
+func (h *Hits) SetFpkm(total_reads int64) {
+	for chrom, chromentries := range h.Hits {
+		for index, _ := range *chromentries {
+			start, end := h.WinSpan(chrom, int64(index))
+			(*chromentries)[index].SetFpkm(total_reads, end - start)
 		}
 	}
-	return
+}
+
+// Calculate fpkm for every window of every genome
+func (g *GenomeHits) SetFpkm(total_reads int64) {
+	for _, genomeentries := range g.Ghits {
+		genomeentries.SetFpkm(total_reads)
+	}
 }
 
 // A special variant of float64 that can marshal and unmarshal NaN and Inf values
@@ -292,26 +454,33 @@ type JsonOutStat struct {
 	AltOvlFpkmProp JsonFloat
 	AltNonOvlFpkmProp JsonFloat
 	Name string
+	*TransJsonStat
+	*FacingJsonStat
+	*BandJsonStat
+	*PropCIJsonStat
+	*BootJsonStat
+	RegionName string `json:",omitempty"`
+	RegionScore string `json:",omitempty"`
 }
 
 // Generate the statistics for one window for JSON output
-func MakeJsonOutStat(genome, chr, name string, stats AllWinStats, winsize, winstep, index int64, win HitSet) JsonOutStat {
+func MakeJsonOutStat(genome, chr, name string, totals ReadTotals, start, end, winsize, winstep int64, win HitSet) JsonOutStat {
 	var j JsonOutStat
 
 	j.Genome = genome
 	j.Chr = chr
 
-	j.Start = int64(index) * winstep
-	j.End = (int64(index) * winstep) + winsize
+	j.Start = start
+	j.End = end
 	j.TargetType = "paired"
 	j.AltType = "self"
 	j.TargetHits = JsonFloat(float64(win.PairHits))
 	j.AltHits = JsonFloat(float64(win.SelfHits))
 	j.TargetProp = JsonFloat(float64(win.PairHits) / (float64(win.PairHits) + float64(win.SelfHits)))
 	j.AltProp = JsonFloat(float64(win.SelfHits) / (float64(win.PairHits) + float64(win.SelfHits)))
-	j.TargetPropGoodBad = JsonFloat(float64(win.PairHits) / (float64(stats.TotalGoodReads) + float64(stats.TotalBadReads)))
-	j.TargetPropGood = JsonFloat(float64(win.PairHits) / float64(stats.TotalGoodReads))
-	j.TargetPropTotal = JsonFloat(float64(win.PairHits) / float64(stats.TotalReads))
+	j.TargetPropGoodBad = JsonFloat(float64(win.PairHits) / (float64(totals.TotalGoodReads) + float64(totals.TotalBadReads)))
+	j.TargetPropGood = JsonFloat(float64(win.PairHits) / float64(totals.TotalGoodReads))
+	j.TargetPropTotal = JsonFloat(float64(win.PairHits) / float64(totals.TotalReads))
 	j.WinSize = winsize
 	j.WinStep = winstep
 
@@ -343,84 +512,134 @@ func Must(err error) {
 }
 
 // Write all stats for all windows as JSON
-func FprintWinStatsJson(w io.Writer, stats AllWinStats, readlen int64) {
+func FprintWinStatsJson(w io.Writer, stats AllWinStats, readlen int64) error {
 	enc := json.NewEncoder(w)
 
-	for genome, genomeentries := range stats.GenomeHits.Ghits {
-		for chrom, chromentries := range genomeentries.Hits {
-			for index, win := range *chromentries {
-				j := MakeJsonOutStat(genome, chrom, stats.Name, stats, genomeentries.WinSize, genomeentries.WinStep, int64(index), win)
-				err := enc.Encode(j)
-				Must(err)
+	for _, genome := range sortedKeys(stats.GenomeHits.Ghits) {
+		genomeentries := stats.GenomeHits.Ghits[genome]
+		for _, chrom := range sortedKeys(genomeentries.Hits) {
+			for index, win := range *genomeentries.Hits[chrom] {
+				start, end := genomeentries.WinSpan(chrom, int64(index))
+				j := MakeJsonOutStat(genome, chrom, stats.Name, stats.ReadTotals, start, end, genomeentries.WinSize, genomeentries.WinStep, win)
+				if stats.Trans {
+					j.AddTrans(win)
+				}
+				if stats.Orient {
+					j.AddFacing(win)
+				}
+				if len(stats.CI.Methods) > 0 {
+					j.AddCI(win, stats.CI)
+				}
+				if stats.Boot != nil {
+					j.AddBoot(stats.Boot.BootFlags, stats.Boot.GenomeWin(genome, chrom, index))
+				}
+				if err := enc.Encode(j); err != nil {
+					return fmt.Errorf("FprintWinStatsJson: %w", err)
+				}
 			}
 		}
 	}
+	return nil
 }
 
 // Write all stats for all windows (wrapper of other Fprint functions)
-func FprintWinStats(w io.Writer, stats AllWinStats, separategenomes bool, readlen int64, jsonOut bool) {
+func FprintWinStats(w io.Writer, stats AllWinStats, separategenomes bool, readlen int64, jsonOut bool) error {
+	if len(stats.Bands) > 0 {
+		return FprintBandStats(w, stats, separategenomes, readlen, jsonOut)
+	}
 	if jsonOut {
-		FprintWinStatsJson(w, stats, readlen)
+		return FprintWinStatsJson(w, stats, readlen)
 	} else if separategenomes {
 		FprintWinStatsSeparateGenomes(w, stats, readlen)
 	} else {
 		FprintWinStatsPlain(w, stats, readlen)
 	}
+	return nil
 }
 
-// Write all stats as tab-separated text
-func FprintWinStatsPlain(w io.Writer, stats AllWinStats, readlen int64) {
-	fmt.Fprintf(os.Stderr, "WinStatsPlain name: %v\n", stats.Name)
-	FprintHeader(w, stats.Fpkm, readlen, stats.Name != "")
+// The optional groups of columns in tab-separated output
+type StatCols struct {
+	Fpkm bool
+	ReadLen int64
+	Trans bool
+	Orient bool
+	CI PropCI
+	Boot BootFlags
+}
+
+// Write one row of tab-separated statistics for a window or region, without
+// any trailing columns or newline
+func FprintStatsRow(w io.Writer, chrom string, start, end, winsize, winstep int64, win HitSet, totals ReadTotals, cols StatCols) {
+	fpkm, readlen := cols.Fpkm, cols.ReadLen
 	format_string := "%s\t%d\t%d\t%s\t%s\t%d\t%d\t%.8g\t%.8g\t%.8g\t%.8g\t%.8g\t%d\t%d"
 	fpkm_format_string := "\t%.8g\t%.8g\t%.8g\t%.8g"
-	name_format_string := "\t%s"
-	for chrom, chromentries := range stats.Hits.Hits {
-		for index, win := range *chromentries {
+	fmt.Fprintf(w,
+		format_string,
+		chrom,
+		start,
+		end,
+		"paired",
+		"self",
+		win.PairHits,
+		win.SelfHits,
+		float64(win.PairHits) / (float64(win.PairHits) + float64(win.SelfHits)),
+		float64(win.SelfHits) / (float64(win.PairHits) + float64(win.SelfHits)),
+		float64(win.PairHits) / (float64(totals.TotalGoodReads) + float64(totals.TotalBadReads)),
+		float64(win.PairHits) / float64(totals.TotalGoodReads),
+		float64(win.PairHits) / float64(totals.TotalReads),
+		winsize,
+		winstep,
+	)
+	if fpkm {
+		fmt.Fprintf(w,
+			fpkm_format_string,
+			win.PairFpkm,
+			win.SelfFpkm,
+			win.PairFpkm / (win.SelfFpkm + win.PairFpkm),
+			win.SelfFpkm / (win.SelfFpkm + win.PairFpkm),
+		)
+	}
+
+	if readlen != -1 {
+		fmt.Fprintf(w,
+			"\t%v\t%v\t%v\t%v",
+			win.OvlHits,
+			win.NonOvlHits,
+			float64(win.OvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
+			float64(win.NonOvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
+		)
+		if fpkm {
 			fmt.Fprintf(w,
-				format_string,
-				chrom,
-				int64(index) * stats.Hits.WinStep,
-				(int64(index) * stats.Hits.WinStep) + stats.Hits.WinSize,
-				"paired",
-				"self",
-				win.PairHits,
-				win.SelfHits,
-				float64(win.PairHits) / (float64(win.PairHits) + float64(win.SelfHits)),
-				float64(win.SelfHits) / (float64(win.PairHits) + float64(win.SelfHits)),
-				float64(win.PairHits) / (float64(stats.TotalGoodReads) + float64(stats.TotalBadReads)),
-				float64(win.PairHits) / float64(stats.TotalGoodReads),
-				float64(win.PairHits) / float64(stats.TotalReads),
-				stats.Hits.WinSize,
-				stats.Hits.WinStep,
+				"\t%v\t%v\t%v\t%v",
+				win.OvlFpkm,
+				win.NonOvlFpkm,
+				float64(win.OvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
+				float64(win.NonOvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
 			)
-			if stats.Fpkm {
-				fmt.Fprintf(w,
-					fpkm_format_string,
-					win.PairFpkm,
-					win.SelfFpkm,
-					win.PairFpkm / (win.SelfFpkm + win.PairFpkm),
-					win.SelfFpkm / (win.SelfFpkm + win.PairFpkm),
-				)
-			}
+		}
+	}
 
-			if readlen != -1 {
-				fmt.Fprintf(w,
-					"\t%v\t%v\t%v\t%v",
-					win.OvlHits,
-					win.NonOvlHits,
-					float64(win.OvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
-					float64(win.NonOvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
-				)
-				if stats.Fpkm {
-					fmt.Fprintf(w,
-						"\t%v\t%v\t%v\t%v",
-						win.OvlFpkm,
-						win.NonOvlFpkm,
-						float64(win.OvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
-						float64(win.NonOvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
-					)
-				}
+	if cols.Trans {
+		FprintTransCols(w, win, fpkm)
+	}
+	if cols.Orient {
+		FprintFacingCols(w, win)
+	}
+	FprintCICols(w, win, cols.CI, readlen)
+}
+
+// Write all stats as tab-separated text
+func FprintWinStatsPlain(w io.Writer, stats AllWinStats, readlen int64) {
+	fmt.Fprintf(os.Stderr, "WinStatsPlain name: %v\n", stats.Name)
+	cols := StatCols{Fpkm: stats.Fpkm, ReadLen: readlen, Trans: stats.Trans, Orient: stats.Orient, CI: stats.CI, Boot: stats.BootFlags()}
+	FprintHeaderCols(w, cols, stats.Name != "", nil)
+	name_format_string := "\t%s"
+	for _, chrom := range sortedKeys(stats.Hits.Hits) {
+		for index, win := range *stats.Hits.Hits[chrom] {
+			start, end := stats.Hits.WinSpan(chrom, int64(index))
+			FprintStatsRow(w, chrom, start, end, stats.Hits.WinSize, stats.Hits.WinStep, win, stats.ReadTotals, cols)
+			if stats.Boot != nil {
+				FprintBootCols(w, cols.Boot, stats.Boot.Hits.Win(chrom, index), readlen)
 			}
 
 			if stats.Name != "" {
@@ -437,58 +656,17 @@ func FprintWinStatsPlain(w io.Writer, stats AllWinStats, readlen int64) {
 // Write all stats as tab-separated text, and write stats separately for each genome
 func FprintWinStatsSeparateGenomes(w io.Writer, stats AllWinStats, readlen int64) {
 	fmt.Fprintf(os.Stderr, "WinStatsSeparateGenomes name: %v\n", stats.Name)
-	FprintHeader(w, stats.Fpkm, readlen, stats.Name != "")
-	format_string := "%s\t%d\t%d\t%s\t%s\t%d\t%d\t%.8g\t%.8g\t%.8g\t%.8g\t%.8g\t%d\t%d"
-	fpkm_format_string := "\t%.8g\t%.8g\t%.8g\t%.8g"
+	cols := StatCols{Fpkm: stats.Fpkm, ReadLen: readlen, Trans: stats.Trans, Orient: stats.Orient, CI: stats.CI, Boot: stats.BootFlags()}
+	FprintHeaderCols(w, cols, stats.Name != "", nil)
 	name_format_string := "\t%s"
-	for genome, genomeentries := range stats.GenomeHits.Ghits {
-		for chrom, chromentries := range genomeentries.Hits {
-			for index, win := range *chromentries {
-				fmt.Fprintf(w,
-					format_string,
-					fmt.Sprintf("%s_%s", chrom, genome),
-					int64(index) * genomeentries.WinStep,
-					(int64(index) * genomeentries.WinStep) + genomeentries.WinSize,
-					"paired",
-					"self",
-					win.PairHits,
-					win.SelfHits,
-					float64(win.PairHits) / (float64(win.PairHits) + float64(win.SelfHits)),
-					float64(win.SelfHits) / (float64(win.PairHits) + float64(win.SelfHits)),
-					float64(win.PairHits) / (float64(stats.TotalGoodReads) + float64(stats.TotalBadReads)),
-					float64(win.PairHits) / float64(stats.TotalGoodReads),
-					float64(win.PairHits) / float64(stats.TotalReads),
-					genomeentries.WinSize,
-					genomeentries.WinStep,
-				)
-
-				if stats.Fpkm {
-					fmt.Fprintf(w,
-						fpkm_format_string,
-						win.PairFpkm,
-						win.SelfFpkm,
-						win.PairFpkm / (win.SelfFpkm + win.PairFpkm),
-						win.SelfFpkm / (win.SelfFpkm + win.PairFpkm),
-					)
-				}
-
-				if readlen != -1 {
-					fmt.Fprintf(w,
-						"\t%v\t%v\t%v\t%v",
-						win.OvlHits,
-						win.NonOvlHits,
-						float64(win.OvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
-						float64(win.NonOvlHits) / (float64(win.OvlHits) + float64(win.NonOvlHits)),
-					)
-					if stats.Fpkm {
-						fmt.Fprintf(w,
-							"\t%v\t%v\t%v\t%v",
-							win.OvlFpkm,
-							win.NonOvlFpkm,
-							float64(win.OvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
-							float64(win.NonOvlFpkm) / (float64(win.OvlFpkm) + float64(win.NonOvlFpkm)),
-						)
-					}
+	for _, genome := range sortedKeys(stats.GenomeHits.Ghits) {
+		genomeentries := stats.GenomeHits.Ghits[genome]
+		for _, chrom := range sortedKeys(genomeentries.Hits) {
+			for index, win := range *genomeentries.Hits[chrom] {
+				start, end := genomeentries.WinSpan(chrom, int64(index))
+				FprintStatsRow(w, fmt.Sprintf("%s_%s", chrom, genome), start, end, genomeentries.WinSize, genomeentries.WinStep, win, stats.ReadTotals, cols)
+				if stats.Boot != nil {
+					FprintBootCols(w, cols.Boot, stats.Boot.GenomeWin(genome, chrom, index), readlen)
 				}
 
 				if stats.Name != "" {
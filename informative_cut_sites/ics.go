@@ -8,6 +8,7 @@ import (
 	"os"
 	"flag"
 	"encoding/csv"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
 )
 
 func handle(format string) func(...any) error {
@@ -63,7 +64,13 @@ type Pairs struct {
 }
 
 func ParsePairsLine(line []string) (Pairs, error) {
-	h := handle("ParsePairsLine: %w")
+	return ParsePairsLineResolve(line, nil)
+}
+
+// Parse a pairs line, replacing contig names with their chromosome names from
+// res; contig names are kept as-is if res is nil
+func ParsePairsLineResolve(line []string, res parents.Resolver) (Pairs, error) {
+	h := handle("ParsePairsLineResolve: %w")
 	var p Pairs
 	var e error
 
@@ -89,6 +96,15 @@ func ParsePairsLine(line []string) (Pairs, error) {
 		p.Reverse.Start--
 	}
 
+	if res != nil {
+		if p.ForwardGood {
+			p.Forward.Chr, _ = res.Resolve(p.Forward.Chr)
+		}
+		if p.ReverseGood {
+			p.Reverse.Chr, _ = res.Resolve(p.Reverse.Chr)
+		}
+	}
+
 	return p, nil
 }
 
@@ -129,7 +145,7 @@ func CountHitsOld(counter map[Pos]int64, r io.Reader) error {
 	return nil
 }
 
-func CountHits(counter map[Pos]int64, r io.Reader, leeway int) error {
+func CountHits(counter map[Pos]int64, r io.Reader, leeway int, res parents.Resolver) error {
 	h := handle("CountHits: %w")
 
 	cr := csv.NewReader(r)
@@ -147,7 +163,7 @@ func CountHits(counter map[Pos]int64, r io.Reader, leeway int) error {
 			continue
 		}
 
-		p, e := ParsePairsLine(line)
+		p, e := ParsePairsLineResolve(line, res)
 		if e != nil { return h(e) }
 
 		if p.ForwardGood {
@@ -200,16 +216,25 @@ func FprintHits(w io.Writer, ps []Pos, counter map[Pos]int64) (int, error) {
 func main() {
 	cutpathp := flag.String("c", "", "Path to bed file containing cut sites")
 	leewayp := flag.Int("l", 0, "Allowed distance from cut site")
+	parentrep := flag.String("parentre", "", "Regular expression with (?P<chrom>...) and (?P<parent>...) groups; if set (or -parentmap is set), match pairs to cut sites by chromosome rather than contig name")
+	parentmapp := flag.String("parentmap", "", "Tab-separated file of contig, chromosome, and parent names")
 	flag.Parse()
 
 	if *cutpathp == "" {
 		panic(fmt.Errorf("missing -c"))
 	}
 
+	var res parents.Resolver
+	if *parentrep != "" || *parentmapp != "" {
+		var e error
+		res, e = parents.New(*parentrep, *parentmapp, "")
+		if e != nil { panic(e) }
+	}
+
 	poses, cutsites, e := ReadCutsiteBed(*cutpathp)
 	if e != nil { panic(e) }
 
-	e = CountHits(cutsites, os.Stdin, *leewayp)
+	e = CountHits(cutsites, os.Stdin, *leewayp, res)
 	if e != nil { panic(e) }
 
 	// fmt.Fprintln(os.Stderr, cutsites)
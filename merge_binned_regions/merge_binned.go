@@ -13,8 +13,14 @@ import (
 	"flag"
 	"log"
 	"encoding/csv"
+	"errors"
+	"sort"
+	"strings"
 )
 
+var ErrNoChangePointMatch = errors.New("no chromosome of the intervals matches a chromosome of the change-points")
+var ErrAmbiguousChangePoints = errors.New("chromosome matches the change-points of several genomes")
+
 func handle(format string) func(...any) error {
 	return func(args ...any) error {
 		return fmt.Errorf(format, args...)
@@ -182,7 +188,7 @@ func JoinSplitsFlex(bins []string, inpre, insuf, opre, osuf string) error {
 		inpath := inpre + bin + insuf
 		outpath := opre + bin + osuf
 		e := JoinSplit(inpath, outpath)
-		if e != nil { return fmt.Errorf("JoinSplits: %w") }
+		if e != nil { return fmt.Errorf("JoinSplits: %w", e) }
 	}
 	return nil
 }
@@ -230,6 +236,7 @@ type ChopArgs struct {
 	Bg bool
 	Chop int64
 	Breakwidth int64
+	ChangePoints map[string][]CpInterval
 }
 
 func ParseBedCoords(line []string) (start, end int64, err error) {
@@ -302,7 +309,7 @@ func RunChop(args ChopArgs) error {
 		if e != nil { return h(e) }
 	}
 
-	if args.Breakwidth != -1 {
+	if args.Breakwidth != -1 || args.ChangePoints != nil {
 		// fmt.Println("running chop on breakpoints")
 		e = ChopBedFlex(args.Bins, pre, "_joined_break.bed", pre, "_joined_break", args.Chop)
 		if e != nil { return h(e) }
@@ -325,7 +332,7 @@ func RunChop(args ChopArgs) error {
 			if e != nil { return h(e) }
 		}
 
-		if args.Breakwidth != -1 {
+		if args.Breakwidth != -1 || args.ChangePoints != nil {
 			suf := fmt.Sprintf("_joined_break_chopped%v", args.Chop)
 			e = GetFastasFlex( args.Fa, args.Bins, pre, suf + ".bed", pre, suf + ".fa")
 			if e != nil { return h(e) }
@@ -335,7 +342,137 @@ func RunChop(args ChopArgs) error {
 	return nil
 }
 
-func GetBreakpointsOne(inpath, outpath string, breakwidth int64) error {
+// A change-point confidence interval, as written by pairviz_changepoint
+type CpInterval struct {
+	Start int64
+	End int64
+}
+
+// Read the intervals of a pairviz_changepoint BED file, by chromosome
+func ReadChangePoints(path string) (map[string][]CpInterval, error) {
+	h := handle("ReadChangePoints: %w")
+
+	r, cr, e := OpenCsv(path)
+	if e != nil { return nil, h(e) }
+	defer r.Close()
+
+	cps := map[string][]CpInterval{}
+	for line, e := cr.Read(); e != io.EOF; line, e = cr.Read() {
+		if e != nil { return nil, h(e) }
+		start, end, e := ParseBedCoords(line)
+		if e != nil { return nil, h(e) }
+		cps[line[0]] = append(cps[line[0]], CpInterval{start, end})
+	}
+	return cps, nil
+}
+
+// A chromosome name without the "_<genome>" suffix that pairviz_changepoint
+// adds when it is run without -g
+func bareChrom(name string) string {
+	if i := strings.LastIndex(name, "_"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// Key the change-points by the chromosome names used in the intervals at
+// inpath. A chromosome matches change-points of the same name, or, failing
+// that, of the same name once the genome is removed from one side, so that
+// "X" matches "X_ISO1" and "X_ISO1" matches "X". A chromosome that matches
+// several genomes is an error, as is a change-point file of which no
+// chromosome matches.
+func MatchChangePoints(cps map[string][]CpInterval, inpath string) (map[string][]CpInterval, error) {
+	h := handle("MatchChangePoints: %w")
+
+	r, cr, e := OpenCsv(inpath)
+	if e != nil { return nil, h(e) }
+	defer r.Close()
+
+	matched := map[string][]CpInterval{}
+	done := map[string]bool{}
+	for line, e := cr.Read(); e != io.EOF; line, e = cr.Read() {
+		if e != nil { return nil, h(e) }
+		chrom := line[0]
+		if done[chrom] || strings.HasPrefix(chrom, "#") {
+			continue
+		}
+		done[chrom] = true
+
+		if c, ok := cps[chrom]; ok {
+			matched[chrom] = c
+			continue
+		}
+		var names []string
+		for name := range cps {
+			if bareChrom(name) == chrom || name == bareChrom(chrom) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if len(names) > 1 {
+			return nil, h(fmt.Errorf("%q matches %v: %w; run pairviz_changepoint with -g", chrom, strings.Join(names, ", "), ErrAmbiguousChangePoints))
+		}
+		if len(names) == 1 {
+			matched[chrom] = cps[names[0]]
+		}
+	}
+
+	if len(matched) == 0 && len(cps) > 0 {
+		var names []string
+		for name := range cps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, h(fmt.Errorf("%v: %w: change-points are on %v", inpath, ErrNoChangePointMatch, strings.Join(names, ", ")))
+	}
+	return matched, nil
+}
+
+// Find the change-point interval that holds pos once widened by pad on each
+// side, taking the one whose middle is closest to pos if several do
+func FindChangePoint(cps []CpInterval, pos, pad int64) (CpInterval, bool) {
+	var best CpInterval
+	found := false
+	bestdist := int64(-1)
+	for _, cp := range cps {
+		if pos < cp.Start - pad || pos >= cp.End + pad {
+			continue
+		}
+		dist := (cp.Start + cp.End) / 2 - pos
+		if dist < 0 {
+			dist = -dist
+		}
+		if !found || dist < bestdist {
+			best, bestdist, found = cp, dist, true
+		}
+	}
+	return best, found
+}
+
+// Write the breakpoint span around one interval end: the interval of a
+// change-point near pos if there is one, otherwise breakwidth on each side
+// of pos, or nothing if breakwidth is -1
+func WriteBreakpoint(w io.Writer, chrom string, pos, breakwidth int64, cps map[string][]CpInterval) error {
+	pad := breakwidth
+	if pad < 0 {
+		pad = 0
+	}
+	if cp, ok := FindChangePoint(cps[chrom], pos, pad); ok {
+		_, e := fmt.Fprintf(w, "%v\t%v\t%v\n", chrom, cp.Start, cp.End)
+		return e
+	}
+	if breakwidth == -1 {
+		return nil
+	}
+	start := pos - breakwidth
+	if start < 0 {
+		start = 0
+	}
+	_, e := fmt.Fprintf(w, "%v\t%v\t%v\n", chrom, start, pos + breakwidth)
+	return e
+}
+
+func GetBreakpointsOne(inpath, outpath string, breakwidth int64, cps map[string][]CpInterval) error {
 	h := handle("GetBreakpointsOne: %w")
 
 	r, cr, e := OpenCsv(inpath)
@@ -352,6 +489,14 @@ func GetBreakpointsOne(inpath, outpath string, breakwidth int64) error {
 		start, end, e := ParseBedCoords(line)
 		if e != nil { return h(e) }
 
+		if cps != nil {
+			e = WriteBreakpoint(bw, line[0], start, breakwidth, cps)
+			if e != nil { return h(e) }
+			e = WriteBreakpoint(bw, line[0], end, breakwidth, cps)
+			if e != nil { return h(e) }
+			continue
+		}
+
 		newstart := start - breakwidth
 		if newstart < 0 {
 			newstart = 0
@@ -372,6 +517,7 @@ type BreakArgs struct {
 	Bins []string
 	Opre string
 	Breakwidth int64
+	ChangePoints map[string][]CpInterval
 }
 
 type BreakFlexArgs struct {
@@ -381,6 +527,7 @@ type BreakFlexArgs struct {
 	Opre string
 	Osuf string
 	Breakwidth int64
+	ChangePoints map[string][]CpInterval
 }
 
 func GetBreakpointsFlex(args BreakFlexArgs) error {
@@ -389,6 +536,7 @@ func GetBreakpointsFlex(args BreakFlexArgs) error {
 			args.Inpre + bin + args.Insuf,
 			args.Opre + bin + args.Osuf,
 			args.Breakwidth,
+			args.ChangePoints,
 		)
 		if e != nil { return fmt.Errorf("GetBreakpointsFlex: %w", e) }
 	}
@@ -396,7 +544,7 @@ func GetBreakpointsFlex(args BreakFlexArgs) error {
 }
 
 func GetBreakpoints(args BreakArgs) error {
-	if args.Breakwidth == -1 {
+	if args.Breakwidth == -1 && args.ChangePoints == nil {
 		return nil
 	}
 	return GetBreakpointsFlex(BreakFlexArgs{
@@ -406,6 +554,7 @@ func GetBreakpoints(args BreakArgs) error {
 		args.Opre + "_",
 		"_joined_break.bed",
 		args.Breakwidth,
+		args.ChangePoints,
 	})
 }
 
@@ -417,11 +566,21 @@ func main() {
 	bgp := flag.Bool("bg", false, "Generate a background file that contains the opposite of the binned files")
 	chopp := flag.Int("chop", -1, "Chop fasta files into pieces no larger than specified size")
 	breakwidthp := flag.Int("breakpoint", -1, "Width of span to identify around breakpoints")
+	cpp := flag.String("cp", "", "Change-point BED from pairviz_changepoint; breakpoint spans are the confidence intervals of change-points within -breakpoint of interval ends")
 	flag.Parse()
 	if *bincolp == -1 { log.Fatal("missing -c") }
 	if *inpathp == "" { log.Fatal("missing -i") }
 	if *oprep == "" { log.Fatal("missing -o") }
 
+	var cps map[string][]CpInterval
+	if *cpp != "" {
+		var e error
+		cps, e = ReadChangePoints(*cpp)
+		if e != nil { panic(e) }
+		cps, e = MatchChangePoints(cps, *inpathp)
+		if e != nil { panic(e) }
+	}
+
 	bins, e := FindBins(*bincolp, *inpathp)
 	if e != nil { panic(e) }
 
@@ -431,7 +590,7 @@ func main() {
 	e = JoinSplits(bins, *oprep)
 	if e != nil { panic(e) }
 
-	e = GetBreakpoints(BreakArgs{bins, *oprep, int64(*breakwidthp)})
+	e = GetBreakpoints(BreakArgs{bins, *oprep, int64(*breakwidthp), cps})
 	if e != nil { panic(e) }
 
 	if *fap != "" {
@@ -455,7 +614,7 @@ func main() {
 		}
 	}
 
-	args := ChopArgs{bins, *oprep, *fap, *bgp, int64(*chopp), int64(*breakwidthp)}
+	args := ChopArgs{bins, *oprep, *fap, *bgp, int64(*chopp), int64(*breakwidthp), cps}
 	e = RunChop(args)
 	if e != nil { panic(e) }
 }
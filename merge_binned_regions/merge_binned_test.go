@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/jgbaldwinbrown/pairviz/go_pairviz/pkg"
+)
+
+// Run pairviz_changepoint on JSON windows of the genomes, whose paired
+// proportion changes at 5025, and write its BED output to path
+func writeTestChangePoints(t *testing.T, path string, genomes ...string) {
+	var in strings.Builder
+	for _, genome := range genomes {
+		for i := 0; i < 200; i++ {
+			pair := 10
+			if i >= 100 {
+				pair = 60
+			}
+			fmt.Fprintf(&in, `{"Genome":"%v","Chr":"X","Start":%v,"End":%v,"TargetHits":%v,"AltHits":%v,"Name":""}`+"\n", genome, i * 50, i * 50 + 100, pair, 100 - pair)
+		}
+	}
+	cps, e := pairviz.ChangePoints(strings.NewReader(in.String()), pairviz.ChangePointFlags{Method: "pelt", Penalty: 2, MinWins: 2, Level: 0.95})
+	if e != nil {
+		t.Fatal(e)
+	}
+	w, e := os.Create(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.Close()
+	if e = pairviz.WriteChangePointBed(w, cps); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestChangePointBreakpoints(t *testing.T) {
+	dir := t.TempDir()
+	cppath := filepath.Join(dir, "cp.bed")
+	writeTestChangePoints(t, cppath, "ISO1")
+	inpath := filepath.Join(dir, "in.bed")
+	if e := os.WriteFile(inpath, []byte("X\t0\t5000\tunpaired\nX\t5000\t10050\tpaired\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	cps, e := ReadChangePoints(cppath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(cps["X_ISO1"]) != 1 {
+		t.Fatalf("wrong change-points %v", cps)
+	}
+	cps, e = MatchChangePoints(cps, inpath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	outpath := filepath.Join(dir, "out.bed")
+	if e = GetBreakpointsOne(inpath, outpath, 100, cps); e != nil {
+		t.Fatal(e)
+	}
+	out, e := os.ReadFile(outpath)
+	if e != nil {
+		t.Fatal(e)
+	}
+	cp := cps["X"][0]
+	want := fmt.Sprintf("X\t0\t100\nX\t%v\t%v\n", cp.Start, cp.End)
+	if !strings.HasPrefix(string(out), want) || cp.Start > 5025 || cp.End <= 5025 {
+		t.Errorf("breakpoints do not use the change-point %v:\n%v", cp, string(out))
+	}
+
+	writeTestChangePoints(t, cppath, "ISO1", "W501")
+	cps, _ = ReadChangePoints(cppath)
+	if _, e = MatchChangePoints(cps, inpath); !errors.Is(e, ErrAmbiguousChangePoints) {
+		t.Errorf("change-points of two genomes matched: %v", e)
+	}
+	if e = os.WriteFile(inpath, []byte("2L\t0\t5000\tunpaired\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = MatchChangePoints(cps, inpath); !errors.Is(e, ErrNoChangePointMatch) {
+		t.Errorf("unmatched change-points accepted: %v", e)
+	}
+}
@@ -0,0 +1,150 @@
+// Resolvers for splitting .pairs contig names into a chromosome and the
+// parent (haplotype) that the contig came from.
+package parents
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The parent assigned to contigs that do not match any naming rule
+const DefaultParent = "ecoli"
+
+// Splits a contig name into its chromosome and parent names
+type Resolver interface {
+	Resolve(contig string) (chrom, parent string)
+}
+
+// The original pairviz naming scheme: contigs are named chrom_parent, and any
+// contig without a suffix belongs to the Unmatched parent
+type SuffixResolver struct {
+	Sep string
+	Unmatched string
+}
+
+// The default suffix resolver, splitting on "_" and labeling unsuffixed contigs "ecoli"
+func Default() SuffixResolver {
+	return SuffixResolver{Sep: "_", Unmatched: DefaultParent}
+}
+
+func (s SuffixResolver) Resolve(contig string) (chrom, parent string) {
+	chrparent := strings.Split(contig, s.Sep)
+	chrom = chrparent[0]
+	parent = s.Unmatched
+	if len(chrparent) >= 2 {
+		parent = chrparent[1]
+	}
+	return chrom, parent
+}
+
+// Resolve contig names with a regular expression containing named "chrom" and
+// "parent" groups; contigs that do not match belong to the Unmatched parent
+type RegexResolver struct {
+	Re *regexp.Regexp
+	Unmatched string
+	chromIdx int
+	parentIdx int
+}
+
+func NewRegexResolver(expr string, unmatched string) (*RegexResolver, error) {
+	re, e := regexp.Compile(expr)
+	if e != nil {
+		return nil, fmt.Errorf("NewRegexResolver: %w", e)
+	}
+	r := &RegexResolver{Re: re, Unmatched: unmatched}
+	r.chromIdx = re.SubexpIndex("chrom")
+	r.parentIdx = re.SubexpIndex("parent")
+	if r.chromIdx == -1 || r.parentIdx == -1 {
+		return nil, fmt.Errorf("NewRegexResolver: regex %q must contain (?P<chrom>...) and (?P<parent>...) groups", expr)
+	}
+	return r, nil
+}
+
+func (r *RegexResolver) Resolve(contig string) (chrom, parent string) {
+	m := r.Re.FindStringSubmatch(contig)
+	if m == nil {
+		return contig, r.Unmatched
+	}
+	return m[r.chromIdx], m[r.parentIdx]
+}
+
+// The chromosome and parent that a contig belongs to
+type ChromParent struct {
+	Chrom string
+	Parent string
+}
+
+// Resolve contig names with an explicit table, falling back to another
+// resolver for contigs that are not in the table
+type MapResolver struct {
+	Contigs map[string]ChromParent
+	Fallback Resolver
+}
+
+func (m *MapResolver) Resolve(contig string) (chrom, parent string) {
+	if cp, ok := m.Contigs[contig]; ok {
+		return cp.Chrom, cp.Parent
+	}
+	return m.Fallback.Resolve(contig)
+}
+
+// Read a tab-separated table with the columns contig, chromosome, and parent
+func ReadMap(r io.Reader, fallback Resolver) (*MapResolver, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = rune('\t')
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	m := &MapResolver{Contigs: map[string]ChromParent{}, Fallback: fallback}
+	for line, e := cr.Read(); e != io.EOF; line, e = cr.Read() {
+		if e != nil {
+			return nil, fmt.Errorf("ReadMap: %w", e)
+		}
+		if len(line) < 3 {
+			return nil, fmt.Errorf("ReadMap: line %v has fewer than 3 columns", line)
+		}
+		m.Contigs[line[0]] = ChromParent{Chrom: line[1], Parent: line[2]}
+	}
+	return m, nil
+}
+
+func ReadMapPath(path string, fallback Resolver) (*MapResolver, error) {
+	r, e := os.Open(path)
+	if e != nil {
+		return nil, fmt.Errorf("ReadMapPath: %w", e)
+	}
+	defer r.Close()
+	return ReadMap(r, fallback)
+}
+
+// Build a resolver from an optional regex and an optional mapping table. The
+// table takes precedence, then the regex, then the default suffix scheme.
+// Unmatched contigs are assigned to the parent named unmatched, or "ecoli" if
+// unmatched is empty.
+func New(regex, mappath, unmatched string) (Resolver, error) {
+	if unmatched == "" {
+		unmatched = DefaultParent
+	}
+
+	var res Resolver = SuffixResolver{Sep: "_", Unmatched: unmatched}
+	if regex != "" {
+		rr, e := NewRegexResolver(regex, unmatched)
+		if e != nil {
+			return nil, e
+		}
+		res = rr
+	}
+	if mappath != "" {
+		mr, e := ReadMapPath(mappath, res)
+		if e != nil {
+			return nil, e
+		}
+		res = mr
+	}
+	return res, nil
+}
@@ -0,0 +1,58 @@
+package parents
+
+import (
+	"strings"
+	"testing"
+)
+
+type resolveCase struct {
+	Contig string
+	Chrom string
+	Parent string
+}
+
+func checkResolve(t *testing.T, res Resolver, cases []resolveCase) {
+	for _, c := range cases {
+		chrom, parent := res.Resolve(c.Contig)
+		if chrom != c.Chrom || parent != c.Parent {
+			t.Errorf("%v: got (%v, %v); expected (%v, %v)", c.Contig, chrom, parent, c.Chrom, c.Parent)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	checkResolve(t, Default(), []resolveCase {
+		{"2L_ISO1", "2L", "ISO1"},
+		{"NC_000913", "NC", "000913"},
+		{"ecolichr", "ecolichr", "ecoli"},
+	})
+}
+
+func TestRegex(t *testing.T) {
+	res, e := NewRegexResolver(`^(?P<chrom>.*)_(?P<parent>[^_]+)$`, "spikein")
+	if e != nil {
+		t.Fatal(e)
+	}
+	checkResolve(t, res, []resolveCase {
+		{"chr2L_random_ISO1", "chr2L_random", "ISO1"},
+		{"2L_W501", "2L", "W501"},
+		{"lambda", "lambda", "spikein"},
+	})
+
+	if _, e = NewRegexResolver(`^(?P<chrom>.*)$`, "spikein"); e == nil {
+		t.Errorf("regex without a parent group accepted")
+	}
+}
+
+func TestMap(t *testing.T) {
+	in := "# contig\tchrom\tparent\nchr2L_random_ISO1\t2L\tISO1\nNC_000913\tNC_000913\tecoli\n"
+	res, e := ReadMap(strings.NewReader(in), Default())
+	if e != nil {
+		t.Fatal(e)
+	}
+	checkResolve(t, res, []resolveCase {
+		{"chr2L_random_ISO1", "2L", "ISO1"},
+		{"NC_000913", "NC_000913", "ecoli"},
+		{"3R_W501", "3R", "W501"},
+	})
+}
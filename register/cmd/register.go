@@ -4,21 +4,31 @@ import (
 	"os"
 	"bufio"
 	"github.com/jgbaldwinbrown/pairviz/register/pkg"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
 	"flag"
 )
 
 type Flags struct {
 	Maxdist int
+	ParentRegex string
+	ParentMap string
+	UnmatchedParent string
 }
 
 func main() {
 	var f Flags
 	flag.IntVar(&f.Maxdist, "m", 30000, "Maximum distance to plot")
+	flag.StringVar(&f.ParentRegex, "parentre", "", "Regular expression with (?P<chrom>...) and (?P<parent>...) groups for splitting contig names (default split on first '_')")
+	flag.StringVar(&f.ParentMap, "parentmap", "", "Tab-separated file of contig, chromosome, and parent names")
+	flag.StringVar(&f.UnmatchedParent, "spikein", "ecoli", "Parent name for contigs that match no naming rule")
 	flag.Parse()
 
+	res, e := parents.New(f.ParentRegex, f.ParentMap, f.UnmatchedParent)
+	if e != nil { panic(e) }
+
 	stdout := bufio.NewWriter(os.Stdout)
 	defer stdout.Flush()
 
-	e := register.Run(int64(f.Maxdist), os.Stdin, stdout)
+	e = register.RunResolve(int64(f.Maxdist), res, os.Stdin, stdout)
 	if e != nil { panic(e) }
 }
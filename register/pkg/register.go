@@ -2,12 +2,12 @@ package register
 
 import (
 	"io"
-	"strings"
 	"log"
 	"os"
 	"encoding/csv"
 	"strconv"
 	"fmt"
+	"github.com/jgbaldwinbrown/pairviz/parents/pkg"
 )
 
 func handle(format string) func(...any) error {
@@ -78,18 +78,18 @@ func (p Pair) ReadType() ReadType {
 	return PairType
 }
 
-// Parse a .pairs file read into a Read; panic on error
+// Parse a .pairs file read into a Read using the default chrom_parent naming; panic on error
 func ParseRead(fields []string) (read Read) {
+	return ParseReadResolve(fields, parents.Default())
+}
+
+// Parse a .pairs file read into a Read, splitting the contig name with res; panic on error
+func ParseReadResolve(fields []string, res parents.Resolver) (read Read) {
 	read.Ok = fields[0] != "!"
 	if !read.Ok {
 		return
 	}
-	chrparent := strings.Split(fields[0], "_")
-	read.Chrom = chrparent[0]
-	read.Parent = "ecoli"
-	if len(chrparent) >= 2 {
-		read.Parent = chrparent[1]
-	}
+	read.Chrom, read.Parent = res.Resolve(fields[0])
 	var err error
 	read.Pos, err = strconv.ParseInt(fields[1], 10, 64)
 	if err != nil {
@@ -107,12 +107,17 @@ func ParseRead(fields []string) (read Read) {
 
 // Parse both reads for a line into a read pair; panic on error
 func ParsePair(line []string) (pair Pair, ok bool) {
+	return ParsePairResolve(line, parents.Default())
+}
+
+// Parse both reads for a line into a read pair, splitting contig names with res; panic on error
+func ParsePairResolve(line []string, res parents.Resolver) (pair Pair, ok bool) {
 	if !IsAPair(line) {
 		ok = false
 		return
 	}
-	pair.Read1 = ParseRead(append([]string{}, line[1], line[2], line[5]))
-	pair.Read2 = ParseRead(append([]string{}, line[3], line[4], line[6]))
+	pair.Read1 = ParseReadResolve(append([]string{}, line[1], line[2], line[5]), res)
+	pair.Read2 = ParseReadResolve(append([]string{}, line[3], line[4], line[6]), res)
 	return pair, true
 }
 
@@ -181,7 +186,12 @@ func SliceIncMax(sl *[]int64, idx int64, max int64) {
 // pairedOut selfOut transOut selfTransOut pairedTransOut
 // pairedMatched selfMatched transMatched selfTransMatched pairedTransMatched
 func Run(maxdist int64, r io.Reader, w io.Writer) error {
-	h := handle("Run: %w")
+	return RunResolve(maxdist, parents.Default(), r, w)
+}
+
+// Run, but split contig names into chromosome and parent with res
+func RunResolve(maxdist int64, res parents.Resolver, r io.Reader, w io.Writer) error {
+	h := handle("RunResolve: %w")
 	cr := csv.NewReader(r)
 	cr.ReuseRecord = true
 	cr.Comma = rune('\t')
@@ -215,7 +225,7 @@ func Run(maxdist int64, r io.Reader, w io.Writer) error {
 	for line, e := cr.Read(); e != io.EOF; line, e = cr.Read() {
 		if e != nil { return h(e) }
 
-		p, ok := ParsePair(line)
+		p, ok := ParsePairResolve(line, res)
 		if !ok { log.Printf("pair %v not ok", p); continue }
 
 		if !p.Read1.Ok || !p.Read2.Ok { continue }